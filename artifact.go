@@ -0,0 +1,195 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EnvArtifactDir is the name of the environment variable that contains
+// the directory to collect the artifacts of failed tests into.
+const EnvArtifactDir = "TESTKIT_ARTIFACT_DIR"
+
+// ArtifactDir sets the directory to collect the artifacts of failed tests into.
+// The artifacts of a failed test are collected into <dir>/<run ID>/<test name>.
+// Defaults to DefaultArtifactDir().
+func ArtifactDir(dir string) Option {
+	return func(tk *Config) {
+		tk.ArtifactDir = dir
+	}
+}
+
+// DefaultArtifactDir returns the directory to collect the artifacts of failed tests into,
+// which is $TESTKIT_ARTIFACT_DIR if set, or testkit/artifacts in the temporary directory.
+func DefaultArtifactDir() string {
+	if dir := os.Getenv(EnvArtifactDir); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(os.TempDir(), "testkit", "artifacts")
+}
+
+// Artifact is a piece of evidence of a failed test, like the logs of the application under test.
+type Artifact struct {
+	// Name is the path to the file of the artifact, relative to the artifact directory of the test.
+	Name string
+	// Data is the content of the file.
+	Data []byte
+}
+
+// ArtifactCollector is implemented by providers that can collect the evidence of failed tests,
+// like the logs of the Kubernetes clusters they have created.
+//
+// The harness calls CollectArtifacts when the test fails, before cleaning up the resources.
+type ArtifactCollector interface {
+	// CollectArtifacts writes the artifacts into dir.
+	// A provider should write them into a subdirectory named after the provider, like dir/kind,
+	// so that it does not overwrite the artifacts of the other providers.
+	CollectArtifacts(ctx context.Context, dir string) error
+}
+
+// OnFailure registers the hook that collects an artifact when the test fails.
+// Hooks are run in the order they are registered, before the resources are cleaned up
+// and regardless of RetainResources and RetainResourcesOnFailure.
+// The hooks registered on a child harness returned by Sub run when the subtest fails.
+//
+//	tk.OnFailure(func(ctx context.Context) testkit.Artifact {
+//		return testkit.Artifact{Name: "app.log", Data: app.Logs()}
+//	})
+func (tk *TestKit) OnFailure(hook func(ctx context.Context) Artifact) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	tk.failureHooks = append(tk.failureHooks, hook)
+}
+
+// CollectArtifacts runs the hooks registered via OnFailure and the providers implementing ArtifactCollector,
+// and writes the artifacts into dir.
+// It also collects the status and the history of the Helm releases installed via the Helm returned by tk.Helm.
+// It returns the errors that occurred, without stopping at the first one.
+//
+// The harness calls this automatically when the test fails.
+// This is useful when you share the harness across tests via Build.
+func (tk *TestKit) CollectArtifacts(ctx context.Context, dir string) []error {
+	return tk.collectArtifacts(ctx, dir, func(Provider) bool { return true })
+}
+
+// collectArtifacts is CollectArtifacts that collects the artifacts of the providers for which collect returns true.
+func (tk *TestKit) collectArtifacts(ctx context.Context, dir string, collect func(Provider) bool) []error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return []error{fmt.Errorf("unable to create artifact directory %s: %v", dir, err)}
+	}
+
+	ctx = trace.ContextWithSpan(ctx, tk.span)
+
+	var errs []error
+
+	tk.mu.Lock()
+	hooks := tk.failureHooks
+	tk.mu.Unlock()
+
+	for _, hook := range hooks {
+		a := hook(ctx)
+		if err := writeArtifact(dir, a.Name, a.Data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, p := range tk.availableProviders {
+		c, ok := p.(ArtifactCollector)
+		if !ok || !collect(p) {
+			continue
+		}
+
+		ctx, span := startSpan(ctx, "collect artifacts "+providerName(p))
+		err := c.CollectArtifacts(ctx, dir)
+		endSpan(span, err)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to collect artifacts from provider %v: %v", p, err))
+		}
+	}
+
+	if err := tk.helmReleases.collectArtifacts(ctx, dir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to collect artifacts of helm releases: %v", err))
+	}
+
+	return errs
+}
+
+// collectArtifactsOnFailure collects the artifacts of the failed test into its artifact directory.
+//
+// The artifacts of a provider shared with the other tests, like the logs of a whole kind cluster,
+// are collected only on the first failure in the run, as every failing subtest would collect the same ones again.
+// The providers scoped to a child harness, like the one of the namespaces of the subtest, are collected on every failure.
+func (tk *TestKit) collectArtifactsOnFailure(ctx context.Context, t *testing.T) {
+	base := tk.ArtifactDir
+	if base == "" {
+		base = DefaultArtifactDir()
+	}
+
+	dir := filepath.Join(base, tk.RunID(), artifactDirName(t.Name()))
+
+	root := tk
+	for root.parent != nil {
+		root = root.parent
+	}
+
+	collect := func(p Provider) bool {
+		root.mu.Lock()
+		defer root.mu.Unlock()
+
+		if prev, ok := root.collectedArtifacts[p]; ok {
+			t.Logf("skipped collecting artifacts of provider %v already collected into %s", p, prev)
+			return false
+		}
+
+		if root.collectedArtifacts == nil {
+			root.collectedArtifacts = map[Provider]string{}
+		}
+		root.collectedArtifacts[p] = dir
+
+		return true
+	}
+
+	for _, err := range tk.collectArtifacts(ctx, dir, collect) {
+		t.Logf("%v", err)
+	}
+
+	t.Logf("collected artifacts of failed test %s into %s", t.Name(), dir)
+}
+
+// artifactDirName returns the name of the artifact directory of the test,
+// flattening the subtests into a single directory name.
+func artifactDirName(testName string) string {
+	return strings.NewReplacer("/", "__", " ", "_").Replace(testName)
+}
+
+// writeArtifact writes the artifact into dir, creating the parent directories as needed.
+func writeArtifact(dir, name string, data []byte) error {
+	if name == "" || !filepath.IsLocal(name) {
+		return fmt.Errorf("invalid artifact name %q: must be a relative path within the artifact directory", name)
+	}
+
+	path := filepath.Join(dir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory for artifact %s: %v", name, err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write artifact %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// artifactTimeout bounds the collection of the artifacts on failure,
+// so that a hung command does not prevent the resources from being cleaned up.
+const artifactTimeout = 5 * time.Minute
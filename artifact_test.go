@@ -0,0 +1,93 @@
+package testkit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	fakeCommand(t, "kubectl", `
+case "$1" in
+get) [ "$2" = pods ] && echo pod/web-0 || echo "$@";;
+*) echo "$@";;
+esac`)
+	fakeCommand(t, "helm", `echo "$@"`)
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, nil, 0644))
+
+	tk, err := Build(Providers(&KubectlProvider{DefaultKubeconfigPath: kubeconfig}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	ns := tk.KubernetesNamespace(t)
+
+	tk.Helm(kubeconfig).UpgradeOrInstall(t, "app", "charts/app", func(c *HelmConfig) {
+		c.Namespace = ns.Name
+	})
+
+	// The releases installed via the Helm not obtained from the harness are not collected.
+	NewHelm(kubeconfig).UpgradeOrInstall(t, "other", "charts/other")
+
+	tk.OnFailure(func(ctx context.Context) Artifact {
+		return Artifact{Name: "app/app.log", Data: []byte("started")}
+	})
+
+	dir := t.TempDir()
+	require.Empty(t, tk.CollectArtifacts(context.Background(), dir))
+
+	read := func(name string) string {
+		t.Helper()
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+
+		return string(data)
+	}
+
+	require.Equal(t, "started", read("app/app.log"))
+	require.Equal(t, "get events --namespace "+ns.Name+" --sort-by .lastTimestamp\n", read(filepath.Join("kubectl", ns.Name, "events.txt")))
+	require.Equal(t, "describe all --namespace "+ns.Name+"\n", read(filepath.Join("kubectl", ns.Name, "describe.txt")))
+	require.Equal(t, "logs pod/web-0 --namespace "+ns.Name+" --all-containers --prefix\n", read(filepath.Join("kubectl", ns.Name, "logs", "web-0.log")))
+	require.Equal(t, "status app --namespace "+ns.Name+"\n", read(filepath.Join("helm", ns.Name, "app", "status.txt")))
+	require.Equal(t, "history app --namespace "+ns.Name+"\n", read(filepath.Join("helm", ns.Name, "app", "history.txt")))
+	require.NoDirExists(t, filepath.Join(dir, "helm", "default"))
+
+	tk.OnFailure(func(ctx context.Context) Artifact {
+		return Artifact{Name: "../escape.log"}
+	})
+	require.Len(t, tk.CollectArtifacts(context.Background(), t.TempDir()), 1)
+}
+
+func TestArtifactDirName(t *testing.T) {
+	require.Equal(t, "TestApp__case_1", artifactDirName("TestApp/case 1"))
+}
+
+func TestCollectArtifactsOnFailure_SharedProvider(t *testing.T) {
+	kindCommands := fakeCommand(t, "kind", "")
+	fakeCommand(t, "kubectl", "")
+
+	kind := &KindProvider{}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()), ArtifactDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	tk.KubernetesCluster(t)
+
+	// The logs of the cluster shared by the subtests are exported on the first failure only.
+	for _, name := range []string{"a", "b"} {
+		t.Run(name, func(t *testing.T) {
+			tk.Sub(t).collectArtifactsOnFailure(context.Background(), t)
+		})
+	}
+	tk.collectArtifactsOnFailure(context.Background(), t)
+
+	require.Equal(t, 1, countPrefixed(kindCommands(), "export logs"))
+	require.Empty(t, tk.CollectArtifacts(context.Background(), t.TempDir()))
+	require.Equal(t, 2, countPrefixed(kindCommands(), "export logs"))
+}
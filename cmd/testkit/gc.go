@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mumoshu/testkit"
+)
+
+// gcOrder is the order in which the kinds of resources are deleted.
+// Resources contained in other resources are deleted first.
+var gcOrder = map[string]int{
+	"configmap": 0,
+	"namespace": 1,
+	"cluster":   2,
+	"workspace": 3,
+}
+
+// gcRank returns the position of the resource in the order of deletion.
+// Virtual clusters are deleted before the other clusters, as they may run in them.
+func gcRank(r resource) int {
+	rank := 2 * gcOrder[r.Kind]
+	if r.Provider != "vcluster" {
+		rank++
+	}
+	return rank
+}
+
+// gc deletes the resources and removes them from the journals.
+// It continues deleting the remaining resources when it fails to delete one,
+// and returns all the errors.
+func (f *finder) gc(w io.Writer, resources []resource, dryRun bool) []error {
+	sorted := append([]resource(nil), resources...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return gcRank(sorted[i]) < gcRank(sorted[j])
+	})
+
+	var errs []error
+
+	for _, r := range sorted {
+		if f.olderThan > 0 && r.CreatedAt.IsZero() {
+			fmt.Fprintf(w, "skipped %s %s of unknown age. Delete it with --all\n", r.Kind, r.Name)
+			continue
+		}
+
+		if dryRun {
+			fmt.Fprintf(w, "would delete %s %s\n", r.Kind, r.Name)
+			continue
+		}
+
+		if err := f.delete(r); err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete %s %s: %v", r.Kind, r.Name, err))
+			continue
+		}
+
+		if r.Entry != nil {
+			j := testkit.OpenJournal(f.journalDir, r.Entry.RunID)
+			if err := j.Remove(r.Entry.Provider, r.Entry.Kind, r.Entry.Name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		fmt.Fprintf(w, "deleted %s %s\n", r.Kind, r.Name)
+	}
+
+	return errs
+}
+
+func (f *finder) delete(r resource) error {
+	switch r.Kind {
+	case "configmap":
+		_, err := f.run("kubectl", "--kubeconfig", r.KubeconfigPath, "delete", "configmap", r.Name, "--namespace", r.Namespace, "--ignore-not-found")
+		return err
+	case "namespace":
+		_, err := f.run("kubectl", "--kubeconfig", r.KubeconfigPath, "delete", "namespace", r.Name, "--ignore-not-found")
+		return err
+	case "cluster":
+		return f.deleteCluster(r)
+	case "workspace":
+		return f.destroyTerraformWorkspace(r)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
+
+// deleteCluster deletes the cluster with the tool of the provider that created it.
+func (f *finder) deleteCluster(r resource) error {
+	var err error
+
+	switch r.Provider {
+	case "kind":
+		if _, err = f.run("kind", "delete", "cluster", "--name", r.Name); err == nil {
+			err = f.removeKindRegistry(r.Name)
+		}
+	case "k3d":
+		_, err = f.run("k3d", "cluster", "delete", r.Name)
+	case "vcluster":
+		// The virtual cluster is created in the namespace of the same name in the host cluster.
+		var env []string
+		if r.KubeconfigPath != "" {
+			env = []string{"KUBECONFIG=" + r.KubeconfigPath}
+		}
+		_, err = f.runEnv(env, "vcluster", "delete", r.Name, "--namespace", r.Name, "--delete-namespace")
+	default:
+		err = fmt.Errorf("unsupported provider %q", r.Provider)
+	}
+
+	return err
+}
+
+// removeKindRegistry removes the local registry container the kind provider may have started for the cluster.
+func (f *finder) removeKindRegistry(clusterName string) error {
+	name := clusterName + "-registry"
+
+	out, err := f.run("docker", "ps", "--all", "--quiet", "--filter", "name=^"+name+"$")
+	if err != nil || strings.TrimSpace(out) == "" {
+		return err
+	}
+
+	_, err = f.run("docker", "rm", "--force", name)
+
+	return err
+}
+
+// destroyTerraformWorkspace runs terraform destroy in the workspace.
+// The journal records only the names of the variables and the backend configuration, as their values may be secrets.
+// The variables are read by terraform from the TF_VAR_<name> environment variables,
+// and the backend configuration is the one the workspace was initialized with.
+func (f *finder) destroyTerraformWorkspace(r resource) error {
+	if r.Entry == nil {
+		return fmt.Errorf("workspace %s is not recorded in any journal", r.Name)
+	}
+
+	var missing []string
+	for _, name := range splitList(r.Entry.Attributes["vars"]) {
+		if _, ok := f.lookupEnv("TF_VAR_" + name); !ok {
+			missing = append(missing, "TF_VAR_"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("set %s to the values of the variables the workspace was applied with", strings.Join(missing, ", "))
+	}
+
+	if _, err := os.Stat(filepath.Join(r.Name, ".terraform")); os.IsNotExist(err) {
+		if backendConfig := splitList(r.Entry.Attributes["backend-config"]); len(backendConfig) > 0 {
+			return fmt.Errorf("workspace is not initialized: run terraform init with -backend-config for %s in it", strings.Join(backendConfig, ", "))
+		}
+
+		if _, err := f.run("terraform", "-chdir="+r.Name, "init"); err != nil {
+			return err
+		}
+	}
+
+	_, err := f.run("terraform", "-chdir="+r.Name, "destroy", "-auto-approve")
+
+	return err
+}
+
+// splitList splits the comma-separated list recorded as a journal attribute.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
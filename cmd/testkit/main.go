@@ -0,0 +1,204 @@
+// Command testkit lists, inspects and garbage-collects the resources
+// left behind by testkit runs.
+//
+// Resources are left behind when a run retains them via RetainResources or
+// RetainResourcesOnFailure, or when a run crashes before cleaning them up.
+// They are found by the name prefix used by the testkit providers,
+// and annotated with the run that created them when they are recorded
+// in the testkit journal.
+//
+// Usage:
+//
+//	testkit ls [flags]
+//	testkit describe [flags] KIND/NAME
+//	testkit gc [flags] (--older-than DURATION | --all)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mumoshu/testkit"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "testkit: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+const usage = `Usage:
+  testkit ls [flags]             List resources left behind by testkit runs
+  testkit describe [flags] KIND/NAME
+                                 Show details of a resource, like cluster/testkit-abcd
+  testkit gc [flags] (--older-than DURATION | --all)
+                                 Delete resources left behind by testkit runs
+
+Run 'testkit COMMAND -h' for the flags of each command.
+`
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("no command specified")
+	}
+
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "ls":
+		return runLs(args)
+	case "describe":
+		return runDescribe(args)
+	case "gc":
+		return runGC(args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// finderFlags are the flags shared by all the commands to find resources.
+type finderFlags struct {
+	kubeconfigs stringsFlag
+	journalDir  string
+	olderThan   time.Duration
+}
+
+func (f *finderFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.kubeconfigs, "kubeconfig", "Path to a kubeconfig file of a cluster to search for namespaces and configmaps, in addition to the ones recorded in the journal. Can be specified multiple times. Defaults to $KUBECONFIG")
+	fs.StringVar(&f.journalDir, "journal-dir", testkit.DefaultJournalDir(), "Directory where testkit journals are stored")
+	fs.DurationVar(&f.olderThan, "older-than", 0, "Only include resources older than this, like 1h or 30m")
+}
+
+func (f *finderFlags) finder() *finder {
+	kubeconfigs := f.kubeconfigs
+	if len(kubeconfigs) == 0 {
+		if kc := os.Getenv("KUBECONFIG"); kc != "" {
+			kubeconfigs = strings.Split(kc, string(os.PathListSeparator))
+		}
+	}
+
+	return &finder{
+		kubeconfigs: kubeconfigs,
+		journalDir:  f.journalDir,
+		olderThan:   f.olderThan,
+		now:         time.Now(),
+	}
+}
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func runLs(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+
+	var ff finderFlags
+	ff.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	resources, err := ff.finder().find()
+	if err != nil {
+		return err
+	}
+
+	printResources(os.Stdout, resources, time.Now())
+
+	return nil
+}
+
+func runDescribe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ContinueOnError)
+
+	var ff finderFlags
+	ff.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("describe requires exactly one KIND/NAME argument")
+	}
+
+	kind, name, ok := strings.Cut(fs.Arg(0), "/")
+	if !ok {
+		return fmt.Errorf("invalid argument %q: expected KIND/NAME, like cluster/testkit-abcd", fs.Arg(0))
+	}
+
+	resources, err := ff.finder().find()
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, r := range resources {
+		if r.Kind == kind && r.Name == name {
+			describeResource(os.Stdout, r, time.Now())
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%s %q not found", kind, name)
+	}
+
+	return nil
+}
+
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+
+	var ff finderFlags
+	ff.register(fs)
+
+	var dryRun, all bool
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the resources that would be deleted without deleting them")
+	fs.BoolVar(&all, "all", false, "Delete all the resources regardless of their age, including the ones in use by running tests")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Deleting every testkit resource would break the tests running now,
+	// so the age of the resources to delete must be explicitly given unless --all is.
+	if ff.olderThan <= 0 && !all {
+		return fmt.Errorf("gc requires --older-than, like --older-than 24h, or --all to delete all the resources including the ones in use")
+	}
+
+	f := ff.finder()
+
+	resources, err := f.find()
+	if err != nil {
+		return err
+	}
+
+	errs := f.gc(os.Stdout, resources, dryRun)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete %d resources", len(errs))
+	}
+
+	return nil
+}
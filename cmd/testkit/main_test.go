@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mumoshu/testkit"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCommands struct {
+	outputs map[string]string
+	calls   []string
+}
+
+func (c *fakeCommands) capture(env []string, name string, args ...string) (string, error) {
+	cmd := strings.Join(append(append(append([]string(nil), env...), name), args...), " ")
+	c.calls = append(c.calls, cmd)
+
+	out, ok := c.outputs[cmd]
+	if !ok {
+		return "", fmt.Errorf("unexpected command: %s", cmd)
+	}
+
+	return out, nil
+}
+
+func TestFinder(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	journalDir := t.TempDir()
+
+	require.NoError(t, testkit.OpenJournal(journalDir, "run1").Record(testkit.JournalEntry{
+		Provider:  "kind",
+		Kind:      "cluster",
+		ID:        "a",
+		Name:      "testkit-a-1234",
+		CreatedAt: now.Add(-2 * time.Hour),
+	}))
+	require.NoError(t, testkit.OpenJournal(journalDir, "run2").Record(testkit.JournalEntry{
+		Provider:       "vcluster",
+		Kind:           "cluster",
+		ID:             "v",
+		Name:           "testkit-v-1234",
+		KubeconfigPath: "kc",
+		CreatedAt:      now.Add(-3 * time.Hour),
+	}))
+
+	// The kubeconfig of a namespace recorded in the journal is searched as well.
+	journalKubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(journalKubeconfig, nil, 0600))
+	require.NoError(t, testkit.OpenJournal(journalDir, "run3").Record(testkit.JournalEntry{
+		Provider:       "kubectl",
+		Kind:           "namespace",
+		Name:           "testkit-ns0",
+		KubeconfigPath: journalKubeconfig,
+		CreatedAt:      now.Add(-2 * time.Hour),
+	}))
+
+	cmds := &fakeCommands{
+		outputs: map[string]string{
+			"kind get clusters":             "kind\ntestkit-a-1234\ntestkit-5678\ntestkit-c-1234\n",
+			"k3d cluster list --no-headers": "testkit-b-1234   1/1       0/0      true\n",
+			"docker inspect --format {{.Created}} k3d-testkit-b-1234-server-0":  now.Add(-5*time.Hour).Format(time.RFC3339Nano) + "\n",
+			"docker inspect --format {{.Created}} testkit-a-1234-control-plane": now.Add(-2*time.Hour).Format(time.RFC3339Nano) + "\n",
+			"docker inspect --format {{.Created}} testkit-5678-control-plane":   now.Add(-10*time.Minute).Format(time.RFC3339Nano) + "\n",
+			"kubectl --kubeconfig kc get namespaces -o json": `{"items": [
+				{"metadata": {"name": "default", "creationTimestamp": "2024-01-01T00:00:00Z"}},
+				{"metadata": {"name": "testkit-abcde", "creationTimestamp": "2024-01-01T00:00:00Z"}},
+				{"metadata": {"name": "testkit-v-1234", "creationTimestamp": "2024-01-01T00:00:00Z"}}
+			]}`,
+			"kubectl --kubeconfig kc get configmaps --all-namespaces -o json": `{"items": [
+				{"metadata": {"name": "testkit-cm1", "namespace": "default", "creationTimestamp": "2024-01-01T00:00:00Z"}},
+				{"metadata": {"name": "testkit-cm2", "namespace": "testkit-abcde", "creationTimestamp": "2024-01-01T00:00:00Z"}}
+			]}`,
+			"kubectl --kubeconfig " + journalKubeconfig + " get namespaces -o json": `{"items": [
+				{"metadata": {"name": "testkit-ns0", "creationTimestamp": "2024-01-01T22:00:00Z"}}
+			]}`,
+			"kubectl --kubeconfig " + journalKubeconfig + " get configmaps --all-namespaces -o json":         `{"items": []}`,
+			"kubectl --kubeconfig " + journalKubeconfig + " delete namespace testkit-ns0 --ignore-not-found": "",
+			"kubectl --kubeconfig kc delete configmap testkit-cm1 --namespace default --ignore-not-found":    "",
+			"kubectl --kubeconfig kc delete namespace testkit-abcde --ignore-not-found":                      "",
+			"kind delete cluster --name testkit-a-1234":                                                      "",
+			"docker ps --all --quiet --filter name=^testkit-a-1234-registry$":                                "0123456789ab\n",
+			"docker rm --force testkit-a-1234-registry":                                                      "",
+			"k3d cluster delete testkit-b-1234":                                                              "",
+			"KUBECONFIG=kc vcluster delete testkit-v-1234 --namespace testkit-v-1234 --delete-namespace":     "",
+		},
+	}
+
+	f := &finder{
+		kubeconfigs: []string{"kc"},
+		journalDir:  journalDir,
+		olderThan:   time.Hour,
+		now:         now,
+		capture:     cmds.capture,
+	}
+
+	resources, err := f.find()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	printResources(&buf, resources, now)
+	// The namespace of the virtual cluster is not listed separately.
+	// The cluster of unknown age is listed, but not deleted unless --all is given.
+	require.Equal(t, `KIND       NAME            NAMESPACE  AGE        RUN
+cluster    testkit-a-1234  -          2h0m0s     run1
+cluster    testkit-c-1234  -          <unknown>  <none>
+cluster    testkit-b-1234  -          5h0m0s     <none>
+cluster    testkit-v-1234  -          3h0m0s     run2
+namespace  testkit-abcde   -          24h0m0s    <none>
+configmap  testkit-cm1     default    24h0m0s    <none>
+namespace  testkit-ns0     -          2h0m0s     run3
+`, buf.String())
+
+	buf.Reset()
+	describeResource(&buf, resources[3], now)
+	require.Equal(t, `Kind:       cluster
+Name:       testkit-v-1234
+Kubeconfig: kc
+Provider:   vcluster
+Age:        3h0m0s
+Run:        run2
+ID:         v
+`, buf.String())
+
+	buf.Reset()
+	require.Empty(t, f.gc(&buf, resources, true))
+	require.Equal(t, `would delete configmap testkit-cm1
+would delete namespace testkit-abcde
+would delete namespace testkit-ns0
+would delete cluster testkit-v-1234
+would delete cluster testkit-a-1234
+skipped cluster testkit-c-1234 of unknown age. Delete it with --all
+would delete cluster testkit-b-1234
+`, buf.String())
+
+	buf.Reset()
+	require.Empty(t, f.gc(&buf, resources, false))
+	require.Equal(t, `deleted configmap testkit-cm1
+deleted namespace testkit-abcde
+deleted namespace testkit-ns0
+deleted cluster testkit-v-1234
+deleted cluster testkit-a-1234
+skipped cluster testkit-c-1234 of unknown age. Delete it with --all
+deleted cluster testkit-b-1234
+`, buf.String())
+
+	journals, err := testkit.ListJournals(journalDir)
+	require.NoError(t, err)
+	require.Empty(t, journals)
+}
+
+func TestFinder_SearchedKubeconfigs(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(existing, nil, 0600))
+
+	f := &finder{kubeconfigs: []string{"kc"}}
+
+	// Recorded kubeconfigs are searched once, and the ones that no longer exist are skipped.
+	require.Equal(t, []string{"kc", existing}, f.searchedKubeconfigs([]testkit.JournalEntry{
+		{Provider: "kubectl", Kind: "namespace", Name: "testkit-a", KubeconfigPath: existing},
+		{Provider: "kubectl", Kind: "configmap", Name: "testkit-b", KubeconfigPath: existing},
+		{Provider: "kubectl", Kind: "namespace", Name: "testkit-c", KubeconfigPath: "kc"},
+		{Provider: "kubectl", Kind: "namespace", Name: "testkit-d", KubeconfigPath: filepath.Join(t.TempDir(), "gone")},
+		{Provider: "vcluster", Kind: "cluster", Name: "testkit-e", KubeconfigPath: "host"},
+	}))
+}
+
+func TestFinder_TerraformWorkspace(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	journalDir := t.TempDir()
+	workspace := t.TempDir()
+
+	require.NoError(t, testkit.OpenJournal(journalDir, "run1").Record(testkit.JournalEntry{
+		Provider:  "terraform",
+		Kind:      "workspace",
+		Name:      workspace,
+		CreatedAt: now.Add(-2 * time.Hour),
+		Attributes: map[string]string{
+			"resources":      "null_resource.a",
+			"vars":           "password,region",
+			"backend-config": "",
+		},
+	}))
+
+	cmds := &fakeCommands{
+		outputs: map[string]string{
+			"kind get clusters":                                        "",
+			"k3d cluster list --no-headers":                            "",
+			"terraform -chdir=" + workspace + " init":                  "",
+			"terraform -chdir=" + workspace + " destroy -auto-approve": "",
+		},
+	}
+
+	env := map[string]string{"TF_VAR_region": "us-east-1"}
+
+	f := &finder{
+		journalDir: journalDir,
+		olderThan:  time.Hour,
+		now:        now,
+		capture:    cmds.capture,
+		getenv: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+	}
+
+	resources, err := f.find()
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+
+	// The values of the variables are not journaled, so they need to be given via the environment.
+	var buf bytes.Buffer
+	errs := f.gc(&buf, resources, false)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "set TF_VAR_password to the values of the variables the workspace was applied with")
+
+	env["TF_VAR_password"] = "secret"
+
+	buf.Reset()
+	require.Empty(t, f.gc(&buf, resources, false))
+	require.Equal(t, "deleted workspace "+workspace+"\n", buf.String())
+	require.Equal(t, []string{
+		"kind get clusters",
+		"k3d cluster list --no-headers",
+		"terraform -chdir=" + workspace + " init",
+		"terraform -chdir=" + workspace + " destroy -auto-approve",
+	}, cmds.calls)
+}
+
+func TestRunGC_RequiresOlderThanOrAll(t *testing.T) {
+	err := run([]string{"gc", "--journal-dir", t.TempDir()})
+	require.EqualError(t, err, "gc requires --older-than, like --older-than 24h, or --all to delete all the resources including the ones in use")
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mumoshu/testkit"
+)
+
+// resource is a resource left behind by a testkit run.
+type resource struct {
+	// Provider is the name of the provider that creates the resource, like "kind", "k3d", "vcluster",
+	// "kubectl" and "terraform", which determines how the resource is deleted.
+	Provider string
+	// Kind is one of "cluster", "namespace", "configmap" and "workspace".
+	Kind      string
+	Name      string
+	Namespace string
+	// KubeconfigPath is the kubeconfig used to access the resource, if any.
+	KubeconfigPath string
+	// CreatedAt is the time the resource was created. It's zero if unknown.
+	CreatedAt time.Time
+
+	// Entry is the journal entry of the resource, if it's recorded in a journal.
+	Entry *testkit.JournalEntry
+}
+
+func (r resource) age(now time.Time) string {
+	if r.CreatedAt.IsZero() {
+		return "<unknown>"
+	}
+
+	return now.Sub(r.CreatedAt).Truncate(time.Second).String()
+}
+
+func (r resource) runID() string {
+	if r.Entry == nil {
+		return "<none>"
+	}
+
+	return r.Entry.RunID
+}
+
+type finder struct {
+	kubeconfigs []string
+	journalDir  string
+	olderThan   time.Duration
+	now         time.Time
+
+	// capture runs a command with the additional environment variables and returns its stdout.
+	// It's replaced in tests.
+	capture func(env []string, name string, args ...string) (string, error)
+
+	// getenv looks up an environment variable.
+	// It's replaced in tests.
+	getenv func(key string) (string, bool)
+}
+
+func (f *finder) lookupEnv(key string) (string, bool) {
+	if f.getenv != nil {
+		return f.getenv(key)
+	}
+
+	return os.LookupEnv(key)
+}
+
+func (f *finder) run(name string, args ...string) (string, error) {
+	return f.runEnv(nil, name, args...)
+}
+
+// runEnv runs the command with the additional environment variables, like KUBECONFIG.
+func (f *finder) runEnv(env []string, name string, args ...string) (string, error) {
+	if f.capture != nil {
+		return f.capture(env, name, args...)
+	}
+
+	c := exec.Command(name, args...)
+	c.Stderr = os.Stderr
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running %s %s: %w", name, strings.Join(args, " "), err)
+	}
+
+	return string(out), nil
+}
+
+// find returns the resources left behind by testkit runs,
+// that are older than f.olderThan.
+func (f *finder) find() ([]resource, error) {
+	entries, err := f.journalEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []resource
+
+	clusters, err := f.findKindClusters()
+	if err != nil {
+		return nil, err
+	}
+	all = append(all, clusters...)
+
+	clusters, err = f.findK3dClusters()
+	if err != nil {
+		return nil, err
+	}
+	all = append(all, clusters...)
+
+	// Virtual clusters and Terraform workspaces can only be found in the journal,
+	// because the former requires the kubeconfig of the host cluster,
+	// and the latter has no name prefix to search for.
+	vclusters := map[string]bool{}
+	for _, e := range entries {
+		switch {
+		case e.Provider == "vcluster" && e.Kind == "cluster":
+			vclusters[e.Name] = true
+
+			all = append(all, resource{
+				Provider:       "vcluster",
+				Kind:           "cluster",
+				Name:           e.Name,
+				KubeconfigPath: e.KubeconfigPath,
+				CreatedAt:      e.CreatedAt,
+			})
+		case e.Provider == "terraform" && e.Kind == "workspace":
+			all = append(all, resource{
+				Provider:  "terraform",
+				Kind:      "workspace",
+				Name:      e.Name,
+				CreatedAt: e.CreatedAt,
+			})
+		}
+	}
+
+	for _, kc := range f.searchedKubeconfigs(entries) {
+		rs, err := f.findKubernetesResources(kc)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range rs {
+			// The namespace of a virtual cluster is deleted along with the virtual cluster.
+			if r.Kind == "namespace" && vclusters[r.Name] {
+				continue
+			}
+			all = append(all, r)
+		}
+	}
+
+	var found []resource
+	for _, r := range all {
+		for i, e := range entries {
+			if e.Provider == r.Provider && e.Kind == r.Kind && e.Name == r.Name {
+				r.Entry = &entries[i]
+				if r.CreatedAt.IsZero() {
+					r.CreatedAt = e.CreatedAt
+				}
+				break
+			}
+		}
+
+		// Resources of unknown age are listed rather than hidden, and gc skips them unless --all is given.
+		if f.olderThan > 0 && !r.CreatedAt.IsZero() && f.now.Sub(r.CreatedAt) < f.olderThan {
+			continue
+		}
+
+		found = append(found, r)
+	}
+
+	return found, nil
+}
+
+// searchedKubeconfigs returns the kubeconfigs to search for namespaces and configmaps,
+// which are the given ones and the ones recorded in the journal by the kubectl provider.
+// A recorded kubeconfig that no longer exists is skipped, as its cluster is gone.
+func (f *finder) searchedKubeconfigs(entries []testkit.JournalEntry) []string {
+	kubeconfigs := append([]string(nil), f.kubeconfigs...)
+
+	seen := map[string]bool{}
+	for _, kc := range kubeconfigs {
+		seen[kc] = true
+	}
+
+	for _, e := range entries {
+		kc := e.KubeconfigPath
+		if e.Provider != "kubectl" || kc == "" || seen[kc] {
+			continue
+		}
+		seen[kc] = true
+
+		if _, err := os.Stat(kc); err != nil {
+			continue
+		}
+
+		kubeconfigs = append(kubeconfigs, kc)
+	}
+
+	return kubeconfigs
+}
+
+func (f *finder) journalEntries() ([]testkit.JournalEntry, error) {
+	journals, err := testkit.ListJournals(f.journalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []testkit.JournalEntry
+	for _, j := range journals {
+		es, err := j.Entries()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, es...)
+	}
+
+	return entries, nil
+}
+
+func (f *finder) findKindClusters() ([]resource, error) {
+	if f.capture == nil {
+		if _, err := exec.LookPath("kind"); err != nil {
+			return nil, nil
+		}
+	}
+
+	out, err := f.run("kind", "get", "clusters")
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []resource
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, testkit.ResourceNamePrefix) {
+			continue
+		}
+
+		r := resource{
+			Provider: "kind",
+			Kind:     "cluster",
+			Name:     name,
+		}
+
+		// kind names the control-plane node container after the cluster.
+		created, err := f.run("docker", "inspect", "--format", "{{.Created}}", name+"-control-plane")
+		if err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(created)); err == nil {
+				r.CreatedAt = t
+			}
+		}
+
+		clusters = append(clusters, r)
+	}
+
+	return clusters, nil
+}
+
+func (f *finder) findK3dClusters() ([]resource, error) {
+	if f.capture == nil {
+		if _, err := exec.LookPath("k3d"); err != nil {
+			return nil, nil
+		}
+	}
+
+	out, err := f.run("k3d", "cluster", "list", "--no-headers")
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []resource
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], testkit.ResourceNamePrefix) {
+			continue
+		}
+
+		name := fields[0]
+
+		r := resource{
+			Provider: "k3d",
+			Kind:     "cluster",
+			Name:     name,
+		}
+
+		// k3d names the first server node container after the cluster.
+		created, err := f.run("docker", "inspect", "--format", "{{.Created}}", "k3d-"+name+"-server-0")
+		if err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(created)); err == nil {
+				r.CreatedAt = t
+			}
+		}
+
+		clusters = append(clusters, r)
+	}
+
+	return clusters, nil
+}
+
+type kubernetesObjectList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string    `json:"name"`
+			Namespace         string    `json:"namespace"`
+			CreationTimestamp time.Time `json:"creationTimestamp"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+func (f *finder) findKubernetesResources(kubeconfigPath string) ([]resource, error) {
+	out, err := f.run("kubectl", "--kubeconfig", kubeconfigPath, "get", "namespaces", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces kubernetesObjectList
+	if err := json.Unmarshal([]byte(out), &namespaces); err != nil {
+		return nil, fmt.Errorf("unable to parse namespaces in %s: %v", kubeconfigPath, err)
+	}
+
+	var resources []resource
+
+	testkitNamespaces := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		if !strings.HasPrefix(ns.Metadata.Name, testkit.ResourceNamePrefix) {
+			continue
+		}
+
+		testkitNamespaces[ns.Metadata.Name] = true
+
+		resources = append(resources, resource{
+			Provider:       "kubectl",
+			Kind:           "namespace",
+			Name:           ns.Metadata.Name,
+			KubeconfigPath: kubeconfigPath,
+			CreatedAt:      ns.Metadata.CreationTimestamp,
+		})
+	}
+
+	out, err = f.run("kubectl", "--kubeconfig", kubeconfigPath, "get", "configmaps", "--all-namespaces", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var configmaps kubernetesObjectList
+	if err := json.Unmarshal([]byte(out), &configmaps); err != nil {
+		return nil, fmt.Errorf("unable to parse configmaps in %s: %v", kubeconfigPath, err)
+	}
+
+	for _, cm := range configmaps.Items {
+		// ConfigMaps in testkit namespaces are deleted along with the namespaces.
+		if !strings.HasPrefix(cm.Metadata.Name, testkit.ResourceNamePrefix) || testkitNamespaces[cm.Metadata.Namespace] {
+			continue
+		}
+
+		resources = append(resources, resource{
+			Provider:       "kubectl",
+			Kind:           "configmap",
+			Name:           cm.Metadata.Name,
+			Namespace:      cm.Metadata.Namespace,
+			KubeconfigPath: kubeconfigPath,
+			CreatedAt:      cm.Metadata.CreationTimestamp,
+		})
+	}
+
+	return resources, nil
+}
+
+func printResources(w io.Writer, resources []resource, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "KIND\tNAME\tNAMESPACE\tAGE\tRUN")
+	for _, r := range resources {
+		ns := r.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Kind, r.Name, ns, r.age(now), r.runID())
+	}
+}
+
+func describeResource(w io.Writer, r resource, now time.Time) {
+	fmt.Fprintf(w, "Kind:       %s\n", r.Kind)
+	fmt.Fprintf(w, "Name:       %s\n", r.Name)
+	if r.Namespace != "" {
+		fmt.Fprintf(w, "Namespace:  %s\n", r.Namespace)
+	}
+	if r.KubeconfigPath != "" {
+		fmt.Fprintf(w, "Kubeconfig: %s\n", r.KubeconfigPath)
+	}
+	fmt.Fprintf(w, "Provider:   %s\n", r.Provider)
+	fmt.Fprintf(w, "Age:        %s\n", r.age(now))
+	fmt.Fprintf(w, "Run:        %s\n", r.runID())
+
+	if r.Entry == nil {
+		return
+	}
+
+	if r.Entry.ID != "" {
+		fmt.Fprintf(w, "ID:         %s\n", r.Entry.ID)
+	}
+
+	if len(r.Entry.Attributes) > 0 {
+		var keys []string
+		for k := range r.Entry.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintln(w, "Attributes:")
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %s: %s\n", k, r.Entry.Attributes[k])
+		}
+	}
+}
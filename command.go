@@ -0,0 +1,89 @@
+package testkit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// commandWaitDelay is how long a command is given to exit after being interrupted,
+	// before being killed.
+	// It's long enough for e.g. terraform to save its state after being interrupted.
+	commandWaitDelay = 30 * time.Second
+
+	// cleanupGracePeriod is the maximum time reserved before the test deadline
+	// for cleaning up the resources.
+	// At most a tenth of the time left is reserved, so that short test timeouts
+	// are still usable.
+	cleanupGracePeriod = 1 * time.Minute
+)
+
+// newCommand returns a command that is interrupted when ctx is done,
+// and killed if it does not exit within commandWaitDelay after that.
+//
+// Interrupting instead of killing gives tools like terraform and kind
+// a chance to save their state or clean up what they were creating.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Cancel = func() error {
+		return c.Process.Signal(os.Interrupt)
+	}
+	c.WaitDelay = commandWaitDelay
+
+	return c
+}
+
+// testContext returns a context that is done shortly before the test deadline,
+// so that the test has time to clean up after the context is done.
+func testContext(t *testing.T) (context.Context, context.CancelFunc) {
+	t.Helper()
+
+	return withTestDeadline(context.Background(), t)
+}
+
+// withTestDeadline is a variant of testContext that derives the context from ctx.
+func withTestDeadline(ctx context.Context, t *testing.T) (context.Context, context.CancelFunc) {
+	t.Helper()
+
+	var cancel context.CancelFunc
+	if deadline, ok := t.Deadline(); ok {
+		grace := time.Until(deadline) / 10
+		if grace > cleanupGracePeriod {
+			grace = cleanupGracePeriod
+		}
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-grace))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	return ctx, cancel
+}
+
+// providerContext is embedded into the providers that run commands,
+// to bound the commands run by the getters by the context passed to SetupContext.
+// The commands are traced under the root span of the harness,
+// rather than the span of the setup that has already ended.
+type providerContext struct {
+	ctx context.Context
+}
+
+func (p *providerContext) setContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+func (p *providerContext) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+
+	if span, ok := p.ctx.Value(rootSpanKey{}).(trace.Span); ok {
+		return trace.ContextWithSpan(p.ctx, span)
+	}
+
+	return p.ctx
+}
@@ -0,0 +1,62 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommand puts a command on PATH that records the arguments it's given
+// and runs the shell script, and returns a function that returns the recorded commands.
+// The script can refer to the arguments via "$@".
+func fakeCommand(t *testing.T, name, script string) func() []string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake command is a shell script")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, name+".log")
+
+	content := "#!/bin/sh\nprintf '%s\\n' \"$*\" >> " + log + "\n" + script + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0755))
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return func() []string {
+		data, err := os.ReadFile(log)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		require.NoError(t, err)
+
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+// countPrefixed returns the number of commands starting with the prefix.
+func countPrefixed(commands []string, prefix string) int {
+	var n int
+	for _, c := range commands {
+		if strings.HasPrefix(c, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// countContaining returns the number of commands containing s.
+func countContaining(commands []string, s string) int {
+	var n int
+	for _, c := range commands {
+		if strings.Contains(c, s) {
+			n++
+		}
+	}
+	return n
+}
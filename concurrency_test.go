@@ -0,0 +1,111 @@
+package testkit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The tests in this file are meant to be run with the race detector,
+// like go test -race.
+
+func TestKubectlProvider_Parallel(t *testing.T) {
+	// Creating resources takes a while, so that concurrent requests overlap.
+	commands := fakeCommand(t, "kubectl", `case "$1" in create) sleep 0.2;; esac`)
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, nil, 0644))
+
+	tk, err := Build(Providers(&KubectlProvider{DefaultKubeconfigPath: kubeconfig}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	const n = 10
+
+	var (
+		mu         sync.Mutex
+		shared     = map[string]struct{}{}
+		configmaps = map[string]struct{}{}
+		scoped     = map[string]struct{}{}
+	)
+
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < n; i++ {
+			t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+				t.Parallel()
+
+				ns := tk.KubernetesNamespace(t)
+				cm := tk.KubernetesConfigMap(t)
+				sub := tk.Sub(t).KubernetesNamespace(t)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				shared[ns.Name] = struct{}{}
+				configmaps[cm.Name] = struct{}{}
+				scoped[sub.Name] = struct{}{}
+			})
+		}
+	})
+
+	require.Len(t, shared, 1)
+	require.Len(t, configmaps, 1)
+	require.Len(t, scoped, n)
+
+	require.Equal(t, n+1, countPrefixed(commands(), "create namespace"))
+	require.Equal(t, 1, countPrefixed(commands(), "create configmap"))
+	require.Equal(t, n, countPrefixed(commands(), "delete namespace"))
+
+	require.Empty(t, tk.DoCleanup())
+	require.Equal(t, n+1, countPrefixed(commands(), "delete namespace"))
+	require.Equal(t, 1, countPrefixed(commands(), "delete configmap"))
+}
+
+func TestKindProvider_Parallel(t *testing.T) {
+	commands := fakeCommand(t, "kind", `case "$1" in create) sleep 0.2;; esac`)
+
+	tk, err := Build(Providers(&KindProvider{}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	const n = 10
+
+	var (
+		wg              sync.WaitGroup
+		mu              sync.Mutex
+		kubeconfigPaths = map[string]struct{}{}
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			kc, err := tk.availableProviders[0].(*KindProvider).GetKubernetesCluster()
+			if err != nil {
+				t.Errorf("unable to get cluster: %v", err)
+				return
+			}
+
+			mu.Lock()
+			kubeconfigPaths[kc.KubeconfigPath] = struct{}{}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, kubeconfigPaths, 1)
+	require.Equal(t, 1, countPrefixed(commands(), "create cluster"))
+
+	// Later requests reuse the cluster created by the concurrent ones.
+	kc := tk.KubernetesCluster(t)
+	require.Contains(t, kubeconfigPaths, kc.KubeconfigPath)
+	require.Equal(t, 1, countPrefixed(commands(), "create cluster"))
+
+	require.Empty(t, tk.DoCleanup())
+	require.Equal(t, 1, countPrefixed(commands(), "delete cluster"))
+}
@@ -0,0 +1,350 @@
+package testkit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultConfigFile is the name of the harness configuration file
+	// looked up in the current directory, which is the directory of the test package
+	// when run via go test.
+	DefaultConfigFile = "testkit.yaml"
+
+	// EnvConfigFile is the name of the environment variable that contains
+	// the path to the harness configuration file.
+	EnvConfigFile = "TESTKIT_CONFIG"
+
+	// EnvProfile is the name of the environment variable that contains
+	// the name of the profile in the harness configuration file to use.
+	EnvProfile = "TESTKIT_PROFILE"
+)
+
+// configFile is the harness configuration file, like:
+//
+//	providers:
+//	- type: kind
+//	  image: kindest/node:${K8S_VERSION:-v1.29.2}
+//	- type: kubectl
+//	  cluster: kind
+//	profiles:
+//	  eks:
+//	    providers:
+//	    - type: terraform
+//	      name: infra
+//	      workspacePath: testdata/terraform
+//	      vars:
+//	        prefix: ${USER}
+//	    - type: kubectl
+//	      cluster: infra
+//
+// The providers of the selected profile replace the top-level providers.
+type configFile struct {
+	Providers []map[string]interface{} `yaml:"providers"`
+	Profiles  map[string]configProfile `yaml:"profiles"`
+}
+
+type configProfile struct {
+	Providers []map[string]interface{} `yaml:"providers"`
+}
+
+// configProvider is the set of the settings common to all the providers in the configuration file.
+// The other settings are decoded into the provider.
+type configProvider struct {
+	// Type is the type of the provider registered via RegisterProviderType.
+	Type string `yaml:"type"`
+	// Name is the name to refer to the provider from the other providers.
+	// Defaults to Type.
+	Name string `yaml:"name"`
+	// DependsOn is the list of the names of the providers this provider depends on.
+	DependsOn []string `yaml:"dependsOn"`
+	// Cluster is the name of the provider of the Kubernetes cluster
+	// used by the kubectl provider, or the host cluster of the vcluster provider.
+	Cluster string `yaml:"cluster"`
+}
+
+var configProviderKeys = []string{"type", "name", "dependsOn", "cluster"}
+
+// providerTypes maps the type names in the configuration file to the providers.
+var providerTypes struct {
+	mu    sync.RWMutex
+	types map[string]func() Provider
+}
+
+func init() {
+	RegisterProviderType("control-plane", func() Provider { return &ControlPlaneProvider{} })
+	RegisterProviderType("eksctl", func() Provider { return &EKSCTLProvider{} })
+	RegisterProviderType("env", func() Provider { return &EnvProvider{} })
+	RegisterProviderType("github-writable-repositories", func() Provider { return &GitHubWritableRepositoriesEnvProvider{} })
+	RegisterProviderType("k3d", func() Provider { return &K3dProvider{} })
+	RegisterProviderType("kind", func() Provider { return &KindProvider{} })
+	RegisterProviderType("kubeconfig", func() Provider { return &KubeconfigProvider{} })
+	RegisterProviderType("kubectl", func() Provider { return &KubectlProvider{} })
+	RegisterProviderType("terraform", func() Provider { return &TerraformProvider{} })
+	RegisterProviderType("vcluster", func() Provider { return &VClusterProvider{} })
+}
+
+// RegisterProviderType registers a type of providers that can be used in the harness configuration file.
+//
+// newProvider returns a new provider, into which the settings in the configuration file
+// are decoded according to its yaml struct tags.
+//
+// It panics if the type is already registered, as it's a programming error.
+func RegisterProviderType(name string, newProvider func() Provider) {
+	providerTypes.mu.Lock()
+	defer providerTypes.mu.Unlock()
+
+	if _, ok := providerTypes.types[name]; ok {
+		panic(fmt.Sprintf("testkit: provider type %q is already registered", name))
+	}
+
+	if providerTypes.types == nil {
+		providerTypes.types = make(map[string]func() Provider)
+	}
+
+	providerTypes.types[name] = newProvider
+}
+
+// ConfigFile sets the path to the harness configuration file.
+// The file is used only when no provider is given via Providers.
+func ConfigFile(path string) Option {
+	return func(tk *Config) {
+		tk.ConfigFile = path
+	}
+}
+
+// Profile selects the profile in the harness configuration file.
+func Profile(name string) Option {
+	return func(tk *Config) {
+		tk.Profile = name
+	}
+}
+
+// loadConfigFile adds the providers and the dependencies configured
+// in the harness configuration file to conf.
+// It does nothing if the configuration file is not specified and
+// DefaultConfigFile does not exist.
+func loadConfigFile(conf *Config) error {
+	path := conf.ConfigFile
+	if path == "" {
+		path = os.Getenv(EnvConfigFile)
+	}
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil
+		}
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	profile := conf.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+
+	providers, deps, err := parseConfigFile(path, data, profile)
+	if err != nil {
+		return err
+	}
+
+	conf.Providers = append(conf.Providers, providers...)
+
+	for p, d := range deps {
+		DependsOn(p, d...)(conf)
+	}
+
+	return nil
+}
+
+// parseConfigFile returns the providers and their dependencies configured in the file,
+// after expanding the environment variables in its string values.
+// The variables are expanded after the file is parsed so that their values
+// can neither change the structure of the file nor appear in parse errors.
+func parseConfigFile(path string, data []byte, profile string) ([]Provider, map[Provider][]Provider, error) {
+	var f configFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+
+	entries := f.Providers
+	if profile != "" {
+		p, ok := f.Profiles[profile]
+		if !ok {
+			var names []string
+			for name := range f.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			return nil, nil, fmt.Errorf("%s: profile %q not found. Available profiles: %s", path, profile, strings.Join(names, ", "))
+		}
+		entries = p.Providers
+	}
+
+	var (
+		providers []Provider
+		configs   []configProvider
+		byName    = map[string]Provider{}
+	)
+
+	for i, entry := range entries {
+		p, c, err := decodeProvider(expandEnvValues(entry).(map[string]interface{}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: providers[%d]: %v", path, i, err)
+		}
+
+		if _, ok := byName[c.Name]; ok {
+			return nil, nil, fmt.Errorf("%s: providers[%d]: duplicate provider name %q. Set a unique name via the name field", path, i, c.Name)
+		}
+
+		byName[c.Name] = p
+		providers = append(providers, p)
+		configs = append(configs, c)
+	}
+
+	deps := map[Provider][]Provider{}
+
+	for i, c := range configs {
+		p := providers[i]
+
+		for _, name := range c.DependsOn {
+			d, ok := byName[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: providers[%d]: dependency %q not found", path, i, name)
+			}
+			deps[p] = append(deps[p], d)
+		}
+
+		if c.Cluster == "" {
+			continue
+		}
+
+		cp, ok := byName[c.Cluster].(KubernetesClusterProvider)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: providers[%d]: cluster %q is not a provider of Kubernetes clusters", path, i, c.Cluster)
+		}
+
+		switch p := p.(type) {
+		case *KubectlProvider:
+			p.Cluster = cp
+		case *VClusterProvider:
+			p.Host = cp
+		default:
+			return nil, nil, fmt.Errorf("%s: providers[%d]: provider of type %q does not support the cluster field", path, i, c.Type)
+		}
+	}
+
+	return providers, deps, nil
+}
+
+// decodeProvider returns the provider configured by the entry in the configuration file.
+func decodeProvider(entry map[string]interface{}) (Provider, configProvider, error) {
+	var c configProvider
+
+	common, err := yaml.Marshal(entry)
+	if err != nil {
+		return nil, c, err
+	}
+
+	if err := yaml.Unmarshal(common, &c); err != nil {
+		return nil, c, err
+	}
+
+	if c.Type == "" {
+		return nil, c, fmt.Errorf("type is not set")
+	}
+
+	if c.Name == "" {
+		c.Name = c.Type
+	}
+
+	providerTypes.mu.RLock()
+	newProvider, ok := providerTypes.types[c.Type]
+	providerTypes.mu.RUnlock()
+
+	if !ok {
+		return nil, c, fmt.Errorf("unknown provider type %q", c.Type)
+	}
+
+	settings := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		settings[k] = v
+	}
+	for _, k := range configProviderKeys {
+		delete(settings, k)
+	}
+
+	p := newProvider()
+
+	if len(settings) > 0 {
+		data, err := yaml.Marshal(settings)
+		if err != nil {
+			return nil, c, err
+		}
+
+		if err := yaml.UnmarshalStrict(data, p); err != nil {
+			return nil, c, fmt.Errorf("invalid settings for provider of type %q: %v", c.Type, err)
+		}
+	}
+
+	return p, c, nil
+}
+
+// expandEnvValues returns v with the environment variables expanded
+// in all the string values nested in it. Keys are left as they are.
+func expandEnvValues(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expandEnv(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = expandEnvValues(e)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			m[k] = expandEnvValues(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = expandEnvValues(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// expandEnv replaces ${VAR} and $VAR in s with the values of the environment variables.
+// ${VAR:-default} is replaced with default when VAR is unset or empty,
+// and $$ is replaced with $.
+func expandEnv(s string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		name, def, hasDefault := strings.Cut(name, ":-")
+
+		if v := os.Getenv(name); v != "" || !hasDefault {
+			return v
+		}
+
+		return def
+	})
+}
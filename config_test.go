@@ -0,0 +1,129 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigFile = `
+providers:
+- type: kind
+  image: kindest/node:${TESTKIT_TEST_K8S_VERSION:-v1.29.2}
+  wait: 60s
+- type: kubectl
+  cluster: kind
+profiles:
+  eks:
+    providers:
+    - type: terraform
+      name: infra
+      workspacePath: testdata/terraform
+      vars:
+        prefix: ${TESTKIT_TEST_PREFIX}
+        price: $$5
+    - type: kubectl
+      kubeconfig: ${TESTKIT_TEST_KUBECONFIG}
+      dependsOn: [infra]
+`
+
+func TestParseConfigFile(t *testing.T) {
+	providers, deps, err := parseConfigFile("testkit.yaml", []byte(testConfigFile), "")
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+	require.Empty(t, deps)
+
+	kind := providers[0].(*KindProvider)
+	require.Equal(t, "kindest/node:v1.29.2", kind.Image)
+	require.Equal(t, 60*time.Second, kind.Wait)
+
+	kubectl := providers[1].(*KubectlProvider)
+	require.Same(t, kind, kubectl.Cluster)
+	require.Equal(t, []Provider{kind}, kubectl.DependsOn())
+}
+
+func TestParseConfigFile_Profile(t *testing.T) {
+	t.Setenv("TESTKIT_TEST_PREFIX", "ci")
+	t.Setenv("TESTKIT_TEST_KUBECONFIG", "/tmp/kubeconfig")
+
+	providers, deps, err := parseConfigFile("testkit.yaml", []byte(testConfigFile), "eks")
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+
+	tf := providers[0].(*TerraformProvider)
+	require.Equal(t, "testdata/terraform", tf.WorkspacePath)
+	require.Equal(t, map[string]string{"prefix": "ci", "price": "$5"}, tf.Vars)
+
+	kubectl := providers[1].(*KubectlProvider)
+	require.Equal(t, "/tmp/kubeconfig", kubectl.DefaultKubeconfigPath)
+	require.Equal(t, map[Provider][]Provider{kubectl: {tf}}, deps)
+
+	_, _, err = parseConfigFile("testkit.yaml", []byte(testConfigFile), "gke")
+	require.EqualError(t, err, `testkit.yaml: profile "gke" not found. Available profiles: eks`)
+}
+
+func TestParseConfigFile_EnvValuesAreNotParsed(t *testing.T) {
+	t.Setenv("TESTKIT_TEST_PREFIX", "a: b # c")
+	t.Setenv("TESTKIT_TEST_KUBECONFIG", "x\n    - type: k3s")
+
+	providers, _, err := parseConfigFile("testkit.yaml", []byte(testConfigFile), "eks")
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+
+	tf := providers[0].(*TerraformProvider)
+	require.Equal(t, "a: b # c", tf.Vars["prefix"])
+
+	kubectl := providers[1].(*KubectlProvider)
+	require.Equal(t, "x\n    - type: k3s", kubectl.DefaultKubeconfigPath)
+}
+
+func TestParseConfigFile_Errors(t *testing.T) {
+	testcases := []struct {
+		config string
+		err    string
+	}{
+		{
+			config: "providers:\n- type: k3s\n",
+			err:    `testkit.yaml: providers[0]: unknown provider type "k3s"`,
+		},
+		{
+			config: "providers:\n- type: kind\n  imag: kindest/node\n",
+			err:    `testkit.yaml: providers[0]: invalid settings for provider of type "kind": yaml: unmarshal errors:` + "\n  line 1: field imag not found in type testkit.KindProvider",
+		},
+		{
+			config: "providers:\n- type: kubectl\n  dependsOn: [kind]\n",
+			err:    `testkit.yaml: providers[0]: dependency "kind" not found`,
+		},
+		{
+			config: "providers:\n- type: env\n- type: kubectl\n  cluster: env\n",
+			err:    `testkit.yaml: providers[1]: cluster "env" is not a provider of Kubernetes clusters`,
+		},
+		{
+			config: "providers:\n- type: env\n- type: env\n",
+			err:    `testkit.yaml: providers[1]: duplicate provider name "env". Set a unique name via the name field`,
+		},
+	}
+
+	for _, tc := range testcases {
+		_, _, err := parseConfigFile("testkit.yaml", []byte(tc.config), "")
+		require.EqualError(t, err, tc.err)
+	}
+}
+
+func TestBuild_ConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testkit.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("providers:\n- type: kubectl\n"), 0644))
+
+	tk, err := Build(ConfigFile(path), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	require.Len(t, tk.availableProviders, 1)
+	require.IsType(t, &KubectlProvider{}, tk.availableProviders[0])
+
+	_, err = Build(ConfigFile(filepath.Join(t.TempDir(), "missing.yaml")))
+	require.ErrorContains(t, err, "unable to read config file")
+}
@@ -0,0 +1,93 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// DockerBuildConfig is the configuration of DockerBuild.
+type DockerBuildConfig struct {
+	// Dockerfile is the path to the Dockerfile.
+	// Defaults to Dockerfile in the context directory.
+	Dockerfile string
+	// BuildArgs are the build-time variables passed via --build-arg.
+	BuildArgs map[string]string
+	// Target is the target stage to build.
+	Target string
+	// ExtraArgs are the extra arguments passed to docker build.
+	ExtraArgs []string
+}
+
+type DockerBuildOption func(*DockerBuildConfig)
+
+// DockerBuild builds the image tagged with tag from the context directory via docker build.
+// It's useful to build the image of the application under test before loading it
+// into kind clusters via KindProvider.LoadImages.
+//
+//	testkit.DockerBuild(t, "example.com/controller:test", "..")
+//	kind.LoadImages(t, cluster, "example.com/controller:test")
+func DockerBuild(t *testing.T, tag, contextDir string, opts ...DockerBuildOption) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	var c DockerBuildConfig
+
+	for _, o := range opts {
+		o(&c)
+	}
+
+	args := []string{"build", "--tag", tag}
+
+	if c.Dockerfile != "" {
+		args = append(args, "--file", c.Dockerfile)
+	}
+
+	if c.Target != "" {
+		args = append(args, "--target", c.Target)
+	}
+
+	keys := make([]string, 0, len(c.BuildArgs))
+	for k := range c.BuildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		args = append(args, "--build-arg", k+"="+c.BuildArgs[k])
+	}
+
+	args = append(args, c.ExtraArgs...)
+	args = append(args, contextDir)
+
+	_, err := docker(ctx, args...)
+	require.NoError(t, err)
+}
+
+// dockerImageID returns the ID of the local image, which changes whenever the image is rebuilt
+// with different contents.
+func dockerImageID(ctx context.Context, image string) (string, error) {
+	out, err := docker(ctx, "image", "inspect", "--format", "{{.Id}}", image)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, "docker", args...)
+
+	r, err := combinedOutput(ctx, c)
+	if err != nil {
+		return string(r), fmt.Errorf("error running docker command: %w, output: %s", err, string(r))
+	}
+
+	return string(r), nil
+}
@@ -41,9 +41,12 @@ func (e E) writeS(b *strings.Builder, msg ...interface{}) {
 				b.WriteString("│\n")
 			}
 
-			b.WriteString("│ ")
-			b.WriteString(s)
-			b.WriteString("\n")
+			// Multi-line descriptions, like lists of reasons, stay within the box.
+			for _, l := range strings.Split(s, "\n") {
+				b.WriteString("│ ")
+				b.WriteString(l)
+				b.WriteString("\n")
+			}
 		case *source:
 			if s == nil {
 				continue
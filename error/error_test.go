@@ -30,6 +30,13 @@ func TestError(t *testing.T) {
 		error.Source("somefile.json", 2, "some code"),
 		error.Long("bar"),
 	).String())
+
+	assert.Equal(t, `╷
+│ foo
+│
+│ bar
+│   - baz
+╵`, error.New("foo", error.Long("bar\n  - baz")).String())
 }
 
 func ExampleError() {
@@ -0,0 +1,352 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+)
+
+// Condition is a condition polled by Eventually and Consistently.
+// It returns true when the condition is satisfied.
+// A non-nil error means the condition is not satisfied, and is reported
+// in the failure message if it's the last one observed.
+//
+// ctx is done when the polling times out, so that the condition can stop what it's doing.
+type Condition func(ctx context.Context) (bool, error)
+
+// PollConfig is the configuration of Eventually and Consistently.
+type PollConfig struct {
+	// Timeout is how long Eventually waits for the condition to be satisfied,
+	// and how long Consistently checks that the condition stays satisfied.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+	// Interval is the interval between the first and the second polls.
+	// Defaults to 100 milliseconds.
+	Interval time.Duration
+	// Backoff is the factor the interval is multiplied by after each poll.
+	// Defaults to 1, which means a constant interval.
+	Backoff float64
+	// MaxInterval caps the interval grown by Backoff. No cap when zero.
+	MaxInterval time.Duration
+	// Jitter is the maximum fraction of the interval randomly added to it,
+	// so that parallel tests do not poll in lockstep.
+	Jitter float64
+	// Context bounds the polling in addition to Timeout and the test deadline.
+	Context context.Context
+}
+
+type PollOption func(*PollConfig)
+
+// PollTimeout sets PollConfig.Timeout.
+func PollTimeout(d time.Duration) PollOption {
+	return func(c *PollConfig) {
+		c.Timeout = d
+	}
+}
+
+// PollInterval sets PollConfig.Interval.
+func PollInterval(d time.Duration) PollOption {
+	return func(c *PollConfig) {
+		c.Interval = d
+	}
+}
+
+// PollBackoff makes the interval grow by the factor after each poll, up to max.
+func PollBackoff(factor float64, max time.Duration) PollOption {
+	return func(c *PollConfig) {
+		c.Backoff = factor
+		c.MaxInterval = max
+	}
+}
+
+// PollJitter sets PollConfig.Jitter.
+func PollJitter(fraction float64) PollOption {
+	return func(c *PollConfig) {
+		c.Jitter = fraction
+	}
+}
+
+// PollContext sets PollConfig.Context.
+func PollContext(ctx context.Context) PollOption {
+	return func(c *PollConfig) {
+		c.Context = ctx
+	}
+}
+
+func newPollConfig(opts []PollOption) PollConfig {
+	c := PollConfig{
+		Timeout:  30 * time.Second,
+		Interval: 100 * time.Millisecond,
+		Backoff:  1,
+		Context:  context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&c)
+	}
+
+	return c
+}
+
+// Eventually polls the condition until it returns true,
+// and fails the test if it does not within the timeout,
+// reporting the last error returned by the condition.
+//
+// The polling is bounded by the test deadline as well,
+// leaving some time before the deadline to clean up the resources.
+//
+//	testkit.Eventually(t, func(ctx context.Context) (bool, error) {
+//		out, err := app.Status(ctx)
+//		return out == "ready", err
+//	}, testkit.PollTimeout(time.Minute), testkit.PollBackoff(2, 10*time.Second))
+func Eventually(t *testing.T, cond Condition, opts ...PollOption) {
+	t.Helper()
+
+	EventuallyValue(t, func(ctx context.Context) (struct{}, error) {
+		ok, err := cond(ctx)
+		if err == nil && !ok {
+			err = errConditionNotSatisfied
+		}
+		return struct{}{}, err
+	}, nil, opts...)
+}
+
+// EventuallyValue polls get until it returns a value accepted by ok without an error,
+// and returns the value.
+// It fails the test if no value is accepted within the timeout,
+// reporting the last value or error returned by get.
+//
+// A nil ok accepts any value returned without an error.
+func EventuallyValue[T any](t *testing.T, get func(ctx context.Context) (T, error), ok func(T) bool, opts ...PollOption) T {
+	t.Helper()
+
+	conf := newPollConfig(opts)
+
+	ctx, cancel := pollContext(t, conf)
+	defer cancel()
+
+	v, err := eventually(ctx, conf, get, ok)
+	if err != nil {
+		fatal(t, err)
+	}
+
+	return v
+}
+
+// Consistently polls the condition for the duration set via PollTimeout,
+// and fails the test as soon as it returns false or an error.
+//
+// It stops polling without failing when the test deadline or the context set via PollContext comes first.
+func Consistently(t *testing.T, cond Condition, opts ...PollOption) {
+	t.Helper()
+
+	conf := newPollConfig(opts)
+
+	ctx, cancel := pollContext(t, conf)
+	defer cancel()
+
+	if err := consistently(ctx, conf, cond); err != nil {
+		fatal(t, err)
+	}
+}
+
+func eventually[T any](ctx context.Context, conf PollConfig, get func(ctx context.Context) (T, error), ok func(T) bool) (T, error) {
+	var (
+		start    = time.Now()
+		attempts int
+		last     T
+		lastErr  error
+	)
+
+	done := poll(ctx, conf, func(ctx context.Context) bool {
+		attempts++
+
+		v, err := get(ctx)
+		if err == nil && (ok == nil || ok(v)) {
+			last, lastErr = v, nil
+			return true
+		}
+
+		if ctx.Err() != nil && attempts > 1 {
+			// The attempt failed because it was interrupted by the end of the polling.
+			// Report the result of the previous attempt instead of the interruption.
+			return false
+		}
+
+		last, lastErr = v, err
+
+		return false
+	})
+
+	if done {
+		return last, nil
+	}
+
+	var details string
+	switch {
+	case errors.Is(lastErr, errConditionNotSatisfied):
+		details = "The condition returned false."
+	case lastErr != nil:
+		details = fmt.Sprintf("Last error: %v", lastErr)
+	default:
+		details = fmt.Sprintf("Last value: %+v", last)
+	}
+
+	return last, testkiterror.New(
+		fmt.Sprintf("condition not satisfied within %v after %d attempts", time.Since(start).Round(time.Millisecond), attempts),
+		testkiterror.Long(details),
+		timeoutRemediation(conf),
+	)
+}
+
+func consistently(ctx context.Context, conf PollConfig, cond Condition) error {
+	var (
+		start    = time.Now()
+		attempts int
+		failed   bool
+		lastErr  error
+	)
+
+	poll(ctx, conf, func(ctx context.Context) bool {
+		attempts++
+
+		ok, err := cond(ctx)
+		if ctx.Err() != nil {
+			// The condition was interrupted by the end of the polling.
+			return true
+		}
+
+		failed, lastErr = !ok || err != nil, err
+
+		return failed
+	})
+
+	if !failed {
+		return nil
+	}
+
+	details := "The condition returned false."
+	if lastErr != nil {
+		details = fmt.Sprintf("Error: %v", lastErr)
+	}
+
+	return testkiterror.New(
+		fmt.Sprintf("condition stopped being satisfied after %v and %d attempts", time.Since(start).Round(time.Millisecond), attempts),
+		testkiterror.Long(details),
+	)
+}
+
+// CollectT collects the failures of the assertions made in the function passed to Collect.
+// It implements require.TestingT, so that require and assert can be used in conditions.
+type CollectT struct {
+	errors []string
+}
+
+// collectFailNow is the panic value used to stop the function passed to Collect on FailNow.
+type collectFailNow struct{}
+
+func (c *CollectT) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (c *CollectT) FailNow() {
+	if len(c.errors) == 0 {
+		c.errors = append(c.errors, "FailNow called")
+	}
+	panic(collectFailNow{})
+}
+
+// Collect returns the condition that is satisfied when f makes no failed assertion.
+// The failed assertions are reported as the error of the condition.
+//
+//	testkit.Eventually(t, testkit.Collect(func(ctx context.Context, c *testkit.CollectT) {
+//		status, err := app.Status(ctx)
+//		require.NoError(c, err)
+//		require.Equal(c, "ready", status)
+//	}))
+func Collect(f func(ctx context.Context, c *CollectT)) Condition {
+	return func(ctx context.Context) (ok bool, err error) {
+		c := &CollectT{}
+
+		defer func() {
+			if r := recover(); r != nil {
+				if _, failNow := r.(collectFailNow); !failNow {
+					panic(r)
+				}
+			}
+
+			if len(c.errors) > 0 {
+				ok, err = false, errors.New(strings.Join(c.errors, "\n"))
+			} else {
+				ok, err = true, nil
+			}
+		}()
+
+		f(ctx, c)
+
+		return true, nil
+	}
+}
+
+var errConditionNotSatisfied = errors.New("condition not satisfied")
+
+// pollContext returns the context that is done when the polling times out.
+func pollContext(t *testing.T, conf PollConfig) (context.Context, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancelDeadline := withTestDeadline(conf.Context, t)
+	ctx, cancelTimeout := context.WithTimeout(ctx, conf.Timeout)
+
+	return ctx, func() {
+		cancelTimeout()
+		cancelDeadline()
+	}
+}
+
+// timeoutRemediation returns the remediation for the polling that timed out,
+// depending on what ended it.
+func timeoutRemediation(conf PollConfig) testkiterror.Option {
+	if conf.Context.Err() != nil {
+		return testkiterror.Remediation("The context passed via PollContext was done before the condition was satisfied.")
+	}
+
+	return testkiterror.Remediation(fmt.Sprintf("Increase the timeout via testkit.PollTimeout, currently %v, or the test timeout via go test -timeout.", conf.Timeout))
+}
+
+// poll calls f until it returns true or ctx is done, waiting for the intervals between the calls.
+// It returns true if f returned true.
+func poll(ctx context.Context, conf PollConfig, f func(ctx context.Context) bool) bool {
+	interval := conf.Interval
+
+	for {
+		if f(ctx) {
+			return true
+		}
+
+		wait := interval
+		if conf.Jitter > 0 {
+			wait += time.Duration(rand.Float64() * conf.Jitter * float64(interval))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		if conf.Backoff > 1 {
+			interval = time.Duration(float64(interval) * conf.Backoff)
+			if conf.MaxInterval > 0 && interval > conf.MaxInterval {
+				interval = conf.MaxInterval
+			}
+		}
+	}
+}
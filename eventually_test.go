@@ -0,0 +1,153 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventually(t *testing.T) {
+	var n int
+
+	Eventually(t, func(ctx context.Context) (bool, error) {
+		n++
+		if n < 3 {
+			return false, errors.New("not yet")
+		}
+		return true, nil
+	}, PollInterval(time.Millisecond))
+
+	require.Equal(t, 3, n)
+
+	v := EventuallyValue(t, func(ctx context.Context) (int, error) {
+		n++
+		return n, nil
+	}, func(v int) bool { return v >= 5 }, PollInterval(time.Millisecond), PollBackoff(2, 4*time.Millisecond), PollJitter(0.5))
+
+	require.Equal(t, 5, v)
+
+	Eventually(t, Collect(func(ctx context.Context, c *CollectT) {
+		n++
+		require.Equal(c, 7, n)
+	}), PollInterval(time.Millisecond))
+}
+
+func TestEventually_SucceedsAtTimeout(t *testing.T) {
+	conf := newPollConfig([]PollOption{PollTimeout(20 * time.Millisecond), PollInterval(time.Millisecond)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+	defer cancel()
+
+	var attempts int
+
+	// The last attempt returns the satisfying value when the timeout fires.
+	v, err := eventually(ctx, conf, func(ctx context.Context) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "pending", nil
+		}
+		<-ctx.Done()
+		return "ready", nil
+	}, func(s string) bool { return s == "ready" })
+	require.NoError(t, err)
+	require.Equal(t, "ready", v)
+}
+
+func TestEventually_Failure(t *testing.T) {
+	conf := newPollConfig([]PollOption{PollTimeout(20 * time.Millisecond), PollInterval(time.Millisecond)})
+
+	var attempts int
+
+	testcases := []struct {
+		get  func(context.Context) (string, error)
+		ok   func(string) bool
+		long string
+	}{
+		{
+			get:  func(context.Context) (string, error) { return "", errors.New("connection refused") },
+			long: "Last error: connection refused",
+		},
+		{
+			// The attempt interrupted by the timeout does not hide the error of the previous one.
+			get: func(ctx context.Context) (string, error) {
+				attempts++
+				if attempts == 1 {
+					return "", errors.New("connection refused")
+				}
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+			long: "Last error: connection refused",
+		},
+		{
+			get:  func(context.Context) (string, error) { return "pending", nil },
+			ok:   func(s string) bool { return s == "ready" },
+			long: "Last value: pending",
+		},
+		{
+			get: conditionValue(Collect(func(ctx context.Context, c *CollectT) {
+				require.Equal(c, "ready", "pending")
+			})),
+			long: "Not equal",
+		},
+	}
+
+	for _, tc := range testcases {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+
+		_, err := eventually(ctx, conf, tc.get, tc.ok)
+		cancel()
+
+		var e *testkiterror.E
+		require.ErrorAs(t, err, &e)
+		require.Contains(t, e.Error(), "condition not satisfied within")
+		require.Contains(t, e.String(), tc.long)
+		require.Contains(t, e.String(), "Increase the timeout via testkit.PollTimeout, currently 20ms")
+	}
+}
+
+// conditionValue adapts the condition to the getter accepted by eventually.
+func conditionValue(cond Condition) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		ok, err := cond(ctx)
+		if err == nil && !ok {
+			err = errConditionNotSatisfied
+		}
+		return "", err
+	}
+}
+
+func TestConsistently(t *testing.T) {
+	var n int
+
+	Consistently(t, func(ctx context.Context) (bool, error) {
+		n++
+		return true, nil
+	}, PollTimeout(20*time.Millisecond), PollInterval(time.Millisecond))
+
+	require.Greater(t, n, 1)
+
+	conf := newPollConfig([]PollOption{PollTimeout(time.Second), PollInterval(time.Millisecond)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+	defer cancel()
+
+	n = 0
+	err := consistently(ctx, conf, func(ctx context.Context) (bool, error) {
+		n++
+		if n == 3 {
+			return false, errors.New("pod restarted")
+		}
+		return true, nil
+	})
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.Error(), "condition stopped being satisfied after")
+	require.Contains(t, e.String(), "Error: pod restarted")
+	require.Equal(t, 3, n)
+}
@@ -1,11 +1,19 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/mumoshu/testkit/internal/redact"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // File represents the desired state of a file in a repository.
@@ -77,6 +85,11 @@ func (b Base) CloneHTTPSURL(token string) string {
 }
 
 func CloneIntoNewBranch(base Base, local, branch string, opts CloneOptions) error {
+	return CloneIntoNewBranchContext(context.Background(), base, local, branch, opts)
+}
+
+// CloneIntoNewBranchContext is a variant of CloneIntoNewBranch that interrupts git when ctx is done.
+func CloneIntoNewBranchContext(ctx context.Context, base Base, local, branch string, opts CloneOptions) error {
 	var repoURL string
 	if opts.Token != "" {
 		repoURL = base.CloneHTTPSURL(opts.Token)
@@ -84,11 +97,11 @@ func CloneIntoNewBranch(base Base, local, branch string, opts CloneOptions) erro
 		repoURL = base.CloneGitURL()
 	}
 
-	if _, err := git("", "clone", repoURL, local); err != nil {
+	if _, err := git(ctx, "", "clone", repoURL, local); err != nil {
 		return fmt.Errorf("git-clone: %s", err)
 	}
 
-	if _, err := git(local, "checkout", "-b", branch, "origin/"+base.Branch); err != nil {
+	if _, err := git(ctx, local, "checkout", "-b", branch, "origin/"+base.Branch); err != nil {
 		return fmt.Errorf("git-checkout: %w", err)
 	}
 
@@ -96,8 +109,13 @@ func CloneIntoNewBranch(base Base, local, branch string, opts CloneOptions) erro
 }
 
 func WriteAndAddFiles(local string, files []*File) error {
+	return WriteAndAddFilesContext(context.Background(), local, files)
+}
+
+// WriteAndAddFilesContext is a variant of WriteAndAddFiles that interrupts git when ctx is done.
+func WriteAndAddFilesContext(ctx context.Context, local string, files []*File) error {
 	for _, f := range files {
-		if err := WriteAndAddFile(local, f); err != nil {
+		if err := WriteAndAddFileContext(ctx, local, f); err != nil {
 			return err
 		}
 	}
@@ -106,14 +124,19 @@ func WriteAndAddFiles(local string, files []*File) error {
 }
 
 func CommitRenameBranchAndPush(local string, commit ChangeSet, head Head) error {
+	return CommitRenameBranchAndPushContext(context.Background(), local, commit, head)
+}
+
+// CommitRenameBranchAndPushContext is a variant of CommitRenameBranchAndPush that interrupts git when ctx is done.
+func CommitRenameBranchAndPushContext(ctx context.Context, local string, commit ChangeSet, head Head) error {
 	if commit.UserName != "" {
-		if _, err := git(local, "config", "user.name", commit.UserName); err != nil {
+		if _, err := git(ctx, local, "config", "user.name", commit.UserName); err != nil {
 			return err
 		}
 	}
 
 	if commit.UserEmail != "" {
-		if _, err := git(local, "config", "user.email", commit.UserEmail); err != nil {
+		if _, err := git(ctx, local, "config", "user.email", commit.UserEmail); err != nil {
 			return err
 		}
 	}
@@ -123,7 +146,7 @@ func CommitRenameBranchAndPush(local string, commit ChangeSet, head Head) error
 		message = "Automated commit via testkit"
 	}
 
-	if _, err := git(local, "commit", "-m", message); err != nil {
+	if _, err := git(ctx, local, "commit", "-m", message); err != nil {
 		return err
 	}
 
@@ -132,20 +155,20 @@ func CommitRenameBranchAndPush(local string, commit ChangeSet, head Head) error
 		return fmt.Errorf("head branch must be set")
 	}
 
-	if _, err := git(local, "branch", "-m", branch); err != nil {
+	if _, err := git(ctx, local, "branch", "-m", branch); err != nil {
 		return err
 	}
 
-	if _, err := git(local, "push", "origin", branch); err != nil {
+	if _, err := git(ctx, local, "push", "origin", branch); err != nil {
 		return err
 	}
 
 	if head.Tag != "" {
-		if _, err := git(local, "tag", head.Tag); err != nil {
+		if _, err := git(ctx, local, "tag", head.Tag); err != nil {
 			return err
 		}
 
-		if _, err := git(local, "push", "origin", head.Tag); err != nil {
+		if _, err := git(ctx, local, "push", "origin", head.Tag); err != nil {
 			return err
 		}
 	}
@@ -154,6 +177,11 @@ func CommitRenameBranchAndPush(local string, commit ChangeSet, head Head) error
 }
 
 func WriteAndAddFile(local string, f *File) error {
+	return WriteAndAddFileContext(context.Background(), local, f)
+}
+
+// WriteAndAddFileContext is a variant of WriteAndAddFile that interrupts git when ctx is done.
+func WriteAndAddFileContext(ctx context.Context, local string, f *File) error {
 	var content []byte
 	if f.ContentString != "" {
 		content = []byte(f.ContentString)
@@ -177,7 +205,7 @@ func WriteAndAddFile(local string, f *File) error {
 		return err
 	}
 
-	if _, err := git(local, "add", f.Path); err != nil {
+	if _, err := git(ctx, local, "add", f.Path); err != nil {
 		return err
 	}
 
@@ -198,6 +226,11 @@ type CommitFound struct {
 }
 
 func FindCommits(local string, sinceSHA string) ([]*CommitFound, error) {
+	return FindCommitsContext(context.Background(), local, sinceSHA)
+}
+
+// FindCommitsContext is a variant of FindCommits that interrupts git when ctx is done.
+func FindCommitsContext(ctx context.Context, local string, sinceSHA string) ([]*CommitFound, error) {
 	var r string
 	if sinceSHA == "" {
 		r = "HEAD"
@@ -206,15 +239,15 @@ func FindCommits(local string, sinceSHA string) ([]*CommitFound, error) {
 	}
 	// This returns a new-line-delimited list of commits in the format "SHA1 commit message"
 	// from the newest to the oldest.
-	commits, err := git(local, "log", "--pretty=format:%H %s", r)
+	commits, err := git(ctx, local, "log", "--pretty=format:%H %s", r)
 	if err != nil {
 		return nil, err
 	}
 
-	return convertCommitSHAsToStateOfAffectedFiles(commits)
+	return convertCommitSHAsToStateOfAffectedFiles(ctx, commits)
 }
 
-func convertCommitSHAsToStateOfAffectedFiles(commits string) ([]*CommitFound, error) {
+func convertCommitSHAsToStateOfAffectedFiles(ctx context.Context, commits string) ([]*CommitFound, error) {
 	lines := strings.Split(commits, "\n")
 	commitFounds := make([]*CommitFound, 0, len(lines))
 	for _, line := range lines {
@@ -227,7 +260,7 @@ func convertCommitSHAsToStateOfAffectedFiles(commits string) ([]*CommitFound, er
 			},
 		}
 
-		authorName, authorEmail, files, err := getCommitDetails(sha)
+		authorName, authorEmail, files, err := getCommitDetails(ctx, sha)
 		if err != nil {
 			return nil, err
 		}
@@ -242,13 +275,13 @@ func convertCommitSHAsToStateOfAffectedFiles(commits string) ([]*CommitFound, er
 	return commitFounds, nil
 }
 
-func getCommitDetails(sha string) (string, string, []*File, error) {
-	authorName, err := git("", "show", "-s", "--format=%an", sha)
+func getCommitDetails(ctx context.Context, sha string) (string, string, []*File, error) {
+	authorName, err := git(ctx, "", "show", "-s", "--format=%an", sha)
 	if err != nil {
 		return "", "", nil, err
 	}
 
-	authorEmail, err := git("", "show", "-s", "--format=%ae", sha)
+	authorEmail, err := git(ctx, "", "show", "-s", "--format=%ae", sha)
 	if err != nil {
 		return "", "", nil, err
 	}
@@ -258,7 +291,7 @@ func getCommitDetails(sha string) (string, string, []*File, error) {
 	// The list is separated by new lines.
 	// Example:
 	//   M       kubectl.go
-	nameStatuses, err := git("", "show", "--pretty=format:", "--name-status", sha)
+	nameStatuses, err := git(ctx, "", "show", "--pretty=format:", "--name-status", sha)
 	if err != nil {
 		return "", "", nil, err
 	}
@@ -276,12 +309,12 @@ func getCommitDetails(sha string) (string, string, []*File, error) {
 
 		switch status {
 		case "A":
-			content, err = showFileContentAtCommit(sha, path)
+			content, err = showFileContentAtCommit(ctx, sha, path)
 			if err != nil {
 				return "", "", nil, err
 			}
 		case "M":
-			content, err = showFileContentAtCommit(sha, path)
+			content, err = showFileContentAtCommit(ctx, sha, path)
 			if err != nil {
 				return "", "", nil, err
 			}
@@ -301,8 +334,8 @@ func getCommitDetails(sha string) (string, string, []*File, error) {
 	return authorName, authorEmail, files, nil
 }
 
-func showFileContentAtCommit(sha, path string) (string, error) {
-	content, err := git("", "show", fmt.Sprintf("%s:%s", sha, path))
+func showFileContentAtCommit(ctx context.Context, sha, path string) (string, error) {
+	content, err := git(ctx, "", "show", fmt.Sprintf("%s:%s", sha, path))
 	if err != nil {
 		return "", err
 	}
@@ -310,17 +343,50 @@ func showFileContentAtCommit(sha, path string) (string, error) {
 	return content, nil
 }
 
+// tracerName is the name of the tracer that emits the spans of the git commands.
+// Spans are emitted only when ctx carries a span, like the ones passed by the testkit harness.
+const tracerName = "github.com/mumoshu/testkit/git"
+
+// commandWaitDelay is how long git is given to exit after being interrupted,
+// before being killed.
+const commandWaitDelay = 10 * time.Second
+
 // git runs the git command with the given arguments and returns the output containing
 // the stdout and stderr.
 //
 // An error is returned if the command fails.
 // The error message should contain the stdout and stderr of the command to give the caller
 // information about what went wrong.
-func git(dir string, args ...string) (string, error) {
-	c := exec.Command("git", args...)
+//
+// The command is interrupted when ctx is done.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Cancel = func() error {
+		return c.Process.Signal(os.Interrupt)
+	}
+	c.WaitDelay = commandWaitDelay
 	c.Dir = dir
+
+	_, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "git",
+		trace.WithAttributes(
+			semconv.ProcessExecutableName("git"),
+			semconv.ProcessCommandArgs(redact.Args(c.Args)...),
+		),
+	)
+	defer span.End()
+
 	out, err := c.CombinedOutput()
+
+	exitCode := -1
+	if c.ProcessState != nil {
+		exitCode = c.ProcessState.ExitCode()
+	}
+	span.SetAttributes(attribute.Int("process.exit_code", exitCode))
+
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
 		errWithOutput := fmt.Errorf("git command failed with error: %w", err)
 		errWithOutput = fmt.Errorf("%s\n\n%s", errWithOutput, string(out))
 		return string(out), errWithOutput
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v58/github"
@@ -64,6 +65,9 @@ type GitHubRepositories struct {
 	// repository after the service is done, perhaps for debugging.
 	RetainClonedRepository bool
 
+	// mu guards the indices, so that the service can be used concurrently.
+	mu sync.Mutex
+
 	// clonedRepoIndex is an index that is used to generate a unique directory name for a cloned
 	// repository.
 	clonedRepoIndex int
@@ -81,7 +85,7 @@ type PullRequest struct {
 
 // Send pushes the given commit to the repository and creates a pull request.
 func (s *GitHubRepositories) Send(ctx context.Context, base Base, head Head, commit ChangeSet, pr PullRequest) (*PullRequestCreated, error) {
-	clean, err := s.push(base, head, commit)
+	clean, err := s.push(ctx, base, head, commit)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +123,7 @@ func (s *GitHubRepositories) Comment(ctx context.Context, base Base, prNumber in
 //
 // This does so by cloning the base repository, writes a commit representing the change set, and pushes it to the branch, optionally tagging it.
 func (s *GitHubRepositories) Push(ctx context.Context, base Base, head Head, commit ChangeSet) error {
-	clean, err := s.push(base, head, commit)
+	clean, err := s.push(ctx, base, head, commit)
 
 	if clean != nil {
 		defer clean()
@@ -196,7 +200,8 @@ func (s *GitHubRepositories) Release(ctx context.Context, base Base, name string
 // This way, you can see if the change set is reflected in the repository.
 func (s *GitHubRepositories) FindCommits(ctx context.Context, base Base, sinceSHA string) ([]*CommitFound, error) {
 	local := s.newLocalRepoDirName(base)
-	err := CloneIntoNewBranch(
+	err := CloneIntoNewBranchContext(
+		ctx,
 		base,
 		local,
 		s.newWorkBranchName(),
@@ -208,7 +213,7 @@ func (s *GitHubRepositories) FindCommits(ctx context.Context, base Base, sinceSH
 		return nil, err
 	}
 
-	commits, err := FindCommits(local, sinceSHA)
+	commits, err := FindCommitsContext(ctx, local, sinceSHA)
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +302,8 @@ func (s *GitHubRepositories) FindSemverTags(ctx context.Context, base Base, sinc
 // This does so by cloning the base repository, and finding the file in the given branch.
 func (s *GitHubRepositories) GetFileContent(ctx context.Context, base Base, path string) ([]byte, error) {
 	local := s.newLocalRepoDirName(base)
-	err := CloneIntoNewBranch(
+	err := CloneIntoNewBranchContext(
+		ctx,
 		base,
 		local,
 		s.newWorkBranchName(),
@@ -414,10 +420,11 @@ func (s *GitHubRepositories) FindPullRequests(ctx context.Context, base Base, si
 }
 
 // push clones the base repository, writes a commit representing the change set, and pushes it to the branch, optionally tagging it.
-func (s *GitHubRepositories) push(base Base, head Head, commit ChangeSet) (func(), error) {
+func (s *GitHubRepositories) push(ctx context.Context, base Base, head Head, commit ChangeSet) (func(), error) {
 	local := s.newLocalRepoDirName(base)
 	newBranch := s.newWorkBranchName()
-	err := CloneIntoNewBranch(
+	err := CloneIntoNewBranchContext(
+		ctx,
 		base,
 		local,
 		newBranch,
@@ -435,11 +442,11 @@ func (s *GitHubRepositories) push(base Base, head Head, commit ChangeSet) (func(
 		}
 	}
 
-	if err := WriteAndAddFiles(local, commit.Files); err != nil {
+	if err := WriteAndAddFilesContext(ctx, local, commit.Files); err != nil {
 		return clean, err
 	}
 
-	if err := CommitRenameBranchAndPush(local, commit, head); err != nil {
+	if err := CommitRenameBranchAndPushContext(ctx, local, commit, head); err != nil {
 		return clean, err
 	}
 
@@ -447,12 +454,18 @@ func (s *GitHubRepositories) push(base Base, head Head, commit ChangeSet) (func(
 }
 
 func (s *GitHubRepositories) newLocalRepoDirName(base Base) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.clonedRepoIndex++
 
 	return fmt.Sprintf("%s/%s/%s/%2d", s.tempDir(), base.Owner, base.Repo, s.clonedRepoIndex)
 }
 
 func (s *GitHubRepositories) newWorkBranchName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.workBranchIndex++
 
 	return fmt.Sprintf("testkit-work-%d", s.workBranchIndex)
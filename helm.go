@@ -1,9 +1,12 @@
 package testkit
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -13,6 +16,10 @@ import (
 type Helm struct {
 	// KubeconfigPath is the path to the kubeconfig file.
 	KubeconfigPath string
+
+	// releases records the releases installed via UpgradeOrInstall,
+	// when the Helm is obtained via TestKit.Helm.
+	releases *helmReleases
 }
 
 func NewHelm(kubeconfigPath string) *Helm {
@@ -21,6 +28,16 @@ func NewHelm(kubeconfigPath string) *Helm {
 	}
 }
 
+// Helm returns the Helm for the cluster of the kubeconfig,
+// whose releases installed via UpgradeOrInstall have their status and history collected
+// as the artifacts of the harness when the test fails.
+func (tk *TestKit) Helm(kubeconfigPath string) *Helm {
+	return &Helm{
+		KubeconfigPath: kubeconfigPath,
+		releases:       &tk.helmReleases,
+	}
+}
+
 type HelmConfig struct {
 	ExtraArgs []string
 	Namespace string
@@ -33,6 +50,9 @@ type HelmOption func(*HelmConfig)
 func (k *Helm) UpgradeOrInstall(t *testing.T, releaseName, chartPath string, opts ...HelmOption) {
 	t.Helper()
 
+	ctx, cancel := testContext(t)
+	defer cancel()
+
 	var c HelmConfig
 
 	for _, o := range opts {
@@ -72,28 +92,43 @@ func (k *Helm) UpgradeOrInstall(t *testing.T, releaseName, chartPath string, opt
 
 	args = append(args, c.ExtraArgs...)
 
-	_, err := k.capture(args...)
+	// The release is recorded before it's installed,
+	// so that the status and the history of a failed installation are collected as well.
+	if k.releases != nil {
+		k.releases.record(helmRelease{kubeconfigPath: k.KubeconfigPath, namespace: c.Namespace, name: releaseName})
+	}
+
+	_, err := k.capture(ctx, args...)
 	require.NoError(t, err)
 }
 
 func (k *Helm) AddRepo(t *testing.T, repoName, repoURL string) {
 	t.Helper()
 
-	_, err := k.capture("repo", "add", repoName, repoURL)
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	_, err := k.capture(ctx, "repo", "add", repoName, repoURL)
 	require.NoError(t, err)
 }
 
 func (k *Helm) UpdateRepo(t *testing.T, repoName string) {
 	t.Helper()
 
-	_, err := k.capture("repo", "update", repoName)
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	_, err := k.capture(ctx, "repo", "update", repoName)
 	require.NoError(t, err)
 }
 
 func (k *Helm) Capture(t *testing.T, args ...string) string {
 	t.Helper()
 
-	r, err := k.capture(args...)
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	r, err := k.capture(ctx, args...)
 	require.NoError(t, err)
 	return r
 }
@@ -109,11 +144,11 @@ func writeHelmValuesYAMLFile(f *os.File, values map[string]interface{}) error {
 	return nil
 }
 
-func (k *Helm) capture(args ...string) (string, error) {
-	c := exec.Command("helm", args...)
+func (k *Helm) capture(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, "helm", args...)
 	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", k.KubeconfigPath))
 
-	r, err := c.CombinedOutput()
+	r, err := combinedOutput(ctx, c)
 	if err != nil {
 		errWithOutput := fmt.Errorf("error running helm command: %w, output: %s", err, string(r))
 		return string(r), errWithOutput
@@ -121,3 +156,73 @@ func (k *Helm) capture(args ...string) (string, error) {
 
 	return string(r), nil
 }
+
+// helmRelease is a release installed via Helm.UpgradeOrInstall.
+type helmRelease struct {
+	kubeconfigPath string
+	namespace      string
+	name           string
+}
+
+// helmReleases records the releases installed via the Helm obtained from a harness,
+// so that their status and history are collected when the test fails.
+type helmReleases struct {
+	mu       sync.Mutex
+	releases []helmRelease
+}
+
+func (h *helmReleases) record(r helmRelease) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, rr := range h.releases {
+		if rr == r {
+			return
+		}
+	}
+
+	h.releases = append(h.releases, r)
+}
+
+// collectArtifacts writes the status and the history of the recorded releases
+// into dir/helm/<namespace>/<release>.
+func (h *helmReleases) collectArtifacts(ctx context.Context, dir string) error {
+	h.mu.Lock()
+	releases := append([]helmRelease(nil), h.releases...)
+	h.mu.Unlock()
+
+	var errs []error
+
+	for _, r := range releases {
+		if _, err := os.Stat(r.kubeconfigPath); err != nil {
+			// The cluster has already been cleaned up along with its kubeconfig.
+			continue
+		}
+
+		helm := NewHelm(r.kubeconfigPath)
+
+		ns := r.namespace
+		if ns == "" {
+			ns = "default"
+		}
+
+		for _, cmd := range []string{"status", "history"} {
+			args := []string{cmd, r.name}
+			if r.namespace != "" {
+				args = append(args, "--namespace", r.namespace)
+			}
+
+			out, err := helm.capture(ctx, args...)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if err := writeArtifact(dir, filepath.Join("helm", ns, r.name, cmd+".txt"), []byte(out)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
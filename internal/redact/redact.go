@@ -0,0 +1,60 @@
+// Package redact redacts secrets from the command arguments recorded in traces and reports.
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the secrets.
+const Redacted = "REDACTED"
+
+// secretNames are the substrings of the names of the values that may contain secrets,
+// like GITHUB_TOKEN, access_key and apiKey.
+var secretNames = []string{"token", "secret", "password", "webhook", "credential", "key"}
+
+// IsSecretName reports whether the value of the field, flag or variable of the name may contain a secret.
+func IsSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range secretNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var urlUserinfo = regexp.MustCompile(`://[^/@\s]+@`)
+
+// Args returns the args with the values that may contain secrets redacted.
+//
+// Redacted are the values of flags and key=value pairs whose names look like secrets,
+// like --token x, --password=x, access_key=x and --from-literal=api_key=x,
+// and credentials in URLs.
+func Args(args []string) []string {
+	r := make([]string, len(args))
+
+	for i, a := range args {
+		if i > 0 && strings.HasPrefix(args[i-1], "-") && !strings.Contains(args[i-1], "=") && IsSecretName(strings.TrimLeft(args[i-1], "-")) {
+			r[i] = Redacted
+			continue
+		}
+
+		if k, v, ok := strings.Cut(a, "="); ok {
+			if IsSecretName(strings.TrimLeft(k, "-")) {
+				r[i] = k + "=" + Redacted
+				continue
+			}
+
+			// The value of a flag may be a key=value pair itself, like --from-literal=password=x.
+			if inner, _, ok := strings.Cut(v, "="); ok && strings.HasPrefix(k, "-") && IsSecretName(inner) {
+				r[i] = k + "=" + inner + "=" + Redacted
+				continue
+			}
+		}
+
+		r[i] = urlUserinfo.ReplaceAllString(a, "://"+Redacted+"@")
+	}
+
+	return r
+}
@@ -0,0 +1,182 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// interruptCleanupTimeout bounds the cleanup run on interrupt.
+const interruptCleanupTimeout = 10 * time.Minute
+
+// interrupts tracks the harnesses to clean up when the process is interrupted.
+var interrupts struct {
+	mu        sync.Mutex
+	harnesses map[*TestKit]struct{}
+	// stop stops the goroutine that waits for signals.
+	// It's nil while no harness is registered.
+	stop chan struct{}
+}
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+// handleInterrupts registers the harness to be cleaned up
+// when the process receives SIGINT or SIGTERM.
+func (tk *TestKit) handleInterrupts() {
+	interrupts.mu.Lock()
+	defer interrupts.mu.Unlock()
+
+	if interrupts.harnesses == nil {
+		interrupts.harnesses = make(map[*TestKit]struct{})
+	}
+
+	interrupts.harnesses[tk] = struct{}{}
+
+	if interrupts.stop == nil {
+		// Start receiving signals before returning,
+		// so that no signal is missed once the setup starts.
+		ch := make(chan os.Signal, 2)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+		interrupts.stop = make(chan struct{})
+		go waitForInterrupt(ch, interrupts.stop)
+	}
+}
+
+// stopHandlingInterrupts unregisters the harness registered by handleInterrupts,
+// and cancels the context passed to the providers.
+func (tk *TestKit) stopHandlingInterrupts() {
+	tk.cancel()
+
+	interrupts.mu.Lock()
+	defer interrupts.mu.Unlock()
+
+	delete(interrupts.harnesses, tk)
+
+	if len(interrupts.harnesses) == 0 && interrupts.stop != nil {
+		close(interrupts.stop)
+		interrupts.stop = nil
+	}
+}
+
+func waitForInterrupt(ch chan os.Signal, stop chan struct{}) {
+	defer signal.Stop(ch)
+
+	var sig os.Signal
+	select {
+	case <-stop:
+		return
+	case sig = <-ch:
+	}
+
+	// done stops waiting for a second signal when this function returns,
+	// which happens only in tests where exit returns.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case sig := <-ch:
+			log.Printf("testkit: received %v again, exiting without waiting for the cleanup to finish", sig)
+			exit(1)
+		case <-done:
+		}
+	}()
+
+	interrupts.mu.Lock()
+	var harnesses []*TestKit
+	for tk := range interrupts.harnesses {
+		harnesses = append(harnesses, tk)
+	}
+	interrupts.mu.Unlock()
+
+	log.Printf("testkit: received %v, cleaning up %d harnesses before exiting", sig, len(harnesses))
+
+	var wg sync.WaitGroup
+	for _, tk := range harnesses {
+		wg.Add(1)
+		go func(tk *TestKit) {
+			defer wg.Done()
+			tk.cleanupOnInterrupt()
+		}(tk)
+	}
+	wg.Wait()
+
+	exit(1)
+
+	// exit returns only in tests.
+	// Let the next harness start waiting for signals again.
+	interrupts.mu.Lock()
+	if interrupts.stop == stop {
+		interrupts.stop = nil
+	}
+	interrupts.mu.Unlock()
+}
+
+// cleanupOnInterrupt interrupts what the providers are doing, and cleans up
+// the providers whose setup has been started.
+// The interrupted test is considered to have failed, so the resources are retained
+// when RetainResourcesOnFailure is set.
+func (tk *TestKit) cleanupOnInterrupt() {
+	tk.cancel()
+
+	// The setup returns shortly after the cancellation, because the commands in flight are interrupted.
+	<-tk.setupDone
+
+	tk.cleanupMu.Lock()
+	defer tk.cleanupMu.Unlock()
+
+	if tk.cleanedUp {
+		return
+	}
+
+	tk.cleanedUp = true
+
+	if !tk.CleanupNeeded(true) {
+		log.Printf("testkit: retained resources recorded in run %s. Set %s=%s to reattach to them", tk.RunID(), EnvReuse, tk.RunID())
+
+		if err := tk.writeReport(); err != nil {
+			log.Printf("testkit: %v", err)
+		}
+
+		if err := tk.finishTracing(nil); err != nil {
+			log.Printf("testkit: %v", err)
+		}
+		return
+	}
+
+	g := tk.providerGraph
+	if g == nil {
+		// The setup has not completed. Clean up the providers whose setup has been started,
+		// as they may have created resources before being interrupted.
+		if tk.setupGraph == nil {
+			return
+		}
+
+		g = tk.startedSubgraph(tk.setupGraph)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), interruptCleanupTimeout)
+	defer cancel()
+
+	errs := tk.cleanupResources(ctx)
+	errs = append(errs, tk.cleanupProviders(ctx, g)...)
+
+	if err := tk.writeReport(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := tk.finishTracing(errors.New("interrupted")); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, err := range errs {
+		log.Printf("testkit: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package testkit
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type interruptibleProvider struct {
+	setupStarted chan struct{}
+	cleanedUp    chan struct{}
+}
+
+func (p *interruptibleProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *interruptibleProvider) SetupContext(ctx context.Context) error {
+	close(p.setupStarted)
+	// Emulates a long-running command like terraform apply.
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p *interruptibleProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *interruptibleProvider) CleanupContext(ctx context.Context) error {
+	close(p.cleanedUp)
+	return nil
+}
+
+func TestInterruptDuringSetup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending os.Interrupt is not supported on Windows")
+	}
+
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() { exit = os.Exit }()
+
+	p := &interruptibleProvider{
+		setupStarted: make(chan struct{}),
+		cleanedUp:    make(chan struct{}),
+	}
+
+	go func() {
+		<-p.setupStarted
+		proc, err := os.FindProcess(os.Getpid())
+		if err == nil {
+			_ = proc.Signal(os.Interrupt)
+		}
+	}()
+
+	_, err := Build(Providers(p), JournalDir(t.TempDir()))
+	require.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case <-p.cleanedUp:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the provider interrupted in the middle of the setup was not cleaned up")
+	}
+
+	select {
+	case code := <-exited:
+		require.Equal(t, 1, code)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the process did not exit after the cleanup")
+	}
+
+	// The goroutine waiting for a second signal does not outlive the handling of the first one.
+	require.Eventually(t, func() bool {
+		buf := make([]byte, 1<<20)
+		return !strings.Contains(string(buf[:runtime.Stack(buf, true)]), "testkit.waitForInterrupt.func")
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,283 @@
+package testkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvReuse is the name of the environment variable that contains
+	// the ID of the run whose retained resources the harness reattaches to.
+	EnvReuse = "TESTKIT_REUSE"
+
+	// EnvJournalDir is the name of the environment variable that overrides
+	// the directory where the journal files are stored.
+	EnvJournalDir = "TESTKIT_JOURNAL_DIR"
+)
+
+// Journal records the resources created by providers in a run,
+// so that the resources retained by RetainResources and RetainResourcesOnFailure
+// can be reattached to by a later run, or destroyed later.
+//
+// A journal is stored as a JSON file named after the run ID
+// in the journal directory.
+// Entries are removed from the journal once the resources are deleted,
+// so the journal lists only the resources that have been left behind.
+//
+// All the methods are safe to call on a nil Journal, in which case they do nothing.
+type Journal struct {
+	dir   string
+	runID string
+
+	mu sync.Mutex
+}
+
+// JournalEntry is a resource recorded in a Journal.
+type JournalEntry struct {
+	// RunID is the ID of the run that created the resource.
+	RunID string `json:"runID"`
+	// Provider is the name of the provider that created the resource,
+	// like "kind", "kubectl", and "terraform".
+	Provider string `json:"provider"`
+	// Kind is the kind of the resource, like "cluster", "namespace", "configmap" and "workspace".
+	Kind string `json:"kind"`
+	// ID is the ID requested by the test, like KubernetesClusterConfig.ID.
+	ID string `json:"id,omitempty"`
+	// Name is the name of the resource.
+	// For a Terraform workspace, it's the absolute path to the workspace.
+	Name string `json:"name"`
+	// Namespace is the Kubernetes namespace of the resource, if any.
+	Namespace string `json:"namespace,omitempty"`
+	// KubeconfigPath is the path to the kubeconfig file
+	// for accessing the resource or the cluster containing it, if any.
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"`
+	// Attributes are provider-specific attributes of the resource.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// CreatedAt is the time the resource was created.
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DefaultJournalDir returns the default directory where the journal files are stored.
+// It is $TESTKIT_JOURNAL_DIR if set, $XDG_STATE_HOME/testkit if $XDG_STATE_HOME is set,
+// and ~/.local/state/testkit otherwise.
+func DefaultJournalDir() string {
+	if dir := os.Getenv(EnvJournalDir); dir != "" {
+		return dir
+	}
+
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "testkit")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "testkit_state")
+	}
+
+	return filepath.Join(home, ".local", "state", "testkit")
+}
+
+// OpenJournal returns the journal for the run in the directory.
+// The journal file is created on the first Record.
+func OpenJournal(dir, runID string) *Journal {
+	return &Journal{
+		dir:   dir,
+		runID: runID,
+	}
+}
+
+// ListJournals returns the journals of all the runs that have left resources behind
+// in the directory.
+func ListJournals(dir string) ([]*Journal, error) {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read journal directory %s: %v", dir, err)
+	}
+
+	var journals []*Journal
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		journals = append(journals, OpenJournal(dir, strings.TrimSuffix(name, ".json")))
+	}
+
+	return journals, nil
+}
+
+func newRunID() string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + randString(4)
+}
+
+// RunID returns the ID of the run this journal belongs to.
+func (j *Journal) RunID() string {
+	if j == nil {
+		return ""
+	}
+
+	return j.runID
+}
+
+func (j *Journal) path() string {
+	return filepath.Join(j.dir, j.runID+".json")
+}
+
+// Record adds the entry to the journal.
+func (j *Journal) Record(e JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+
+	e.RunID = j.runID
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	return j.write(append(entries, e))
+}
+
+// Remove removes the entries for the resource from the journal.
+func (j *Journal) Remove(provider, kind, name string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+
+	var remaining []JournalEntry
+	for _, e := range entries {
+		if e.Provider == provider && e.Kind == kind && e.Name == name {
+			continue
+		}
+		remaining = append(remaining, e)
+	}
+
+	return j.write(remaining)
+}
+
+// Entries returns all the entries in the journal, ordered by creation time.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.read()
+}
+
+// Find returns the entries of the kind of resources created by the provider
+// for which match returns true.
+func (j *Journal) Find(provider, kind string, match func(JournalEntry) bool) ([]JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []JournalEntry
+	for _, e := range entries {
+		if e.Provider == provider && e.Kind == kind && match(e) {
+			found = append(found, e)
+		}
+	}
+
+	return found, nil
+}
+
+func (j *Journal) read() ([]JournalEntry, error) {
+	b, err := os.ReadFile(j.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read journal %s: %v", j.path(), err)
+	}
+
+	var entries []JournalEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("unable to parse journal %s: %v", j.path(), err)
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].CreatedAt.Before(entries[b].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+// write replaces the content of the journal file with the entries.
+// The file is removed when there are no entries left.
+func (j *Journal) write(entries []JournalEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(j.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to remove journal %s: %v", j.path(), err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create journal directory %s: %v", j.dir, err)
+	}
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal journal entries: %v", err)
+	}
+
+	// Write to a temporary file and rename it so that
+	// the journal is never left half-written.
+	tmp := j.path() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("unable to write journal %s: %v", tmp, err)
+	}
+
+	if err := os.Rename(tmp, j.path()); err != nil {
+		return fmt.Errorf("unable to write journal %s: %v", j.path(), err)
+	}
+
+	return nil
+}
+
+// journaling is embedded into the providers that record the resources they create
+// into the journal of the harness.
+type journaling struct {
+	journal *Journal
+	// reuse is true when the harness reattaches to the resources
+	// recorded in the journal, instead of creating new ones.
+	reuse bool
+}
+
+// journalingProvider is implemented by the providers that embed journaling.
+type journalingProvider interface {
+	setJournal(j *Journal, reuse bool)
+}
+
+func (j *journaling) setJournal(journal *Journal, reuse bool) {
+	j.journal = journal
+	j.reuse = reuse
+}
@@ -0,0 +1,65 @@
+package testkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	j := OpenJournal(dir, "run1")
+
+	require.NoError(t, j.Record(JournalEntry{Provider: "kind", Kind: "cluster", ID: "a", Name: "testkit-a-1234"}))
+	require.NoError(t, j.Record(JournalEntry{Provider: "kubectl", Kind: "namespace", ID: "a", Name: "testkit-a-abcde"}))
+
+	// Another run's journal in the same directory must not interfere.
+	require.NoError(t, OpenJournal(dir, "run2").Record(JournalEntry{Provider: "kind", Kind: "cluster", ID: "a", Name: "testkit-a-5678"}))
+
+	// Reopening the journal reads what has been recorded by the previous run.
+	found, err := OpenJournal(dir, "run1").Find("kind", "cluster", func(e JournalEntry) bool { return e.ID == "a" })
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "testkit-a-1234", found[0].Name)
+	require.Equal(t, "run1", found[0].RunID)
+	require.False(t, found[0].CreatedAt.IsZero())
+
+	journals, err := ListJournals(dir)
+	require.NoError(t, err)
+	require.Len(t, journals, 2)
+
+	require.NoError(t, j.Remove("kind", "cluster", "testkit-a-1234"))
+	require.NoError(t, j.Remove("kubectl", "namespace", "testkit-a-abcde"))
+
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// The journal file is removed once all the resources are gone.
+	journals, err = ListJournals(dir)
+	require.NoError(t, err)
+	require.Len(t, journals, 1)
+	require.Equal(t, "run2", journals[0].RunID())
+}
+
+func TestJournal_Nil(t *testing.T) {
+	var j *Journal
+
+	require.NoError(t, j.Record(JournalEntry{Provider: "kind", Kind: "cluster", Name: "testkit-1234"}))
+	require.NoError(t, j.Remove("kind", "cluster", "testkit-1234"))
+
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestBuild_Reuse(t *testing.T) {
+	t.Setenv(EnvReuse, "20240101-000000-abcd")
+
+	tk, err := Build(Providers(&KubectlProvider{}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	require.Equal(t, "20240101-000000-abcd", tk.RunID())
+}
@@ -1,6 +1,7 @@
 package testkit
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -30,7 +31,10 @@ func NewKubectl(kubeconfigPath string) *Kubectl {
 func (k *Kubectl) Failed(t *testing.T, args ...string) bool {
 	t.Helper()
 
-	_, err := k.capture(args...)
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	_, err := k.captureContext(ctx, args...)
 
 	if k.LogError {
 		t.Log(err)
@@ -42,19 +46,39 @@ func (k *Kubectl) Failed(t *testing.T, args ...string) bool {
 func (k *Kubectl) Capture(t *testing.T, args ...string) string {
 	t.Helper()
 
-	r, err := k.capture(args...)
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	r, err := k.captureContext(ctx, args...)
 	require.NoError(t, err)
 	return r
 }
 
-func (k *Kubectl) capture(args ...string) (string, error) {
-	c := exec.Command("kubectl", args...)
+func (k *Kubectl) captureContext(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, "kubectl", args...)
 	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", k.KubeconfigPath))
 
-	r, err := c.CombinedOutput()
+	r, err := combinedOutput(ctx, c)
 	if err != nil {
 		errWithOutput := fmt.Errorf("error running kubectl command: %w, output: %s", err, string(r))
 		return string(r), errWithOutput
 	}
 	return string(r), nil
 }
+
+// outputContext is a variant of captureContext that returns the standard output only,
+// for the output parsed as JSON, which would be broken by the warnings written to the standard error.
+func (k *Kubectl) outputContext(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, "kubectl", args...)
+	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", k.KubeconfigPath))
+
+	r, err := output(ctx, c)
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return string(r), fmt.Errorf("error running kubectl command: %w, output: %s", err, string(stderr))
+	}
+	return string(r), nil
+}
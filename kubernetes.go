@@ -1,20 +1,54 @@
 package testkit
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Kubernetes provides the assertions and the operations against a Kubernetes cluster,
+// via the Kubernetes API instead of kubectl.
 type Kubernetes struct {
-	kubectl *Kubectl
+	// KubeconfigPath is the path to the kubeconfig file.
+	KubeconfigPath string
+
+	// scheme maps the Go types to the kinds of the objects.
+	scheme *runtime.Scheme
+
+	clientOnce sync.Once
+	client     client.Client
+	clientErr  error
 }
 
-func NewKubernetes(kubeconfigPath string) *Kubernetes {
-	return &Kubernetes{
-		kubectl: NewKubectl(kubeconfigPath),
+type KubernetesOption func(*Kubernetes)
+
+// KubernetesScheme sets the scheme used to map the typed objects, like the ones of your CRDs, to their kinds.
+// Defaults to the scheme of client-go that knows the built-in kinds.
+// Unstructured objects can be used regardless of the scheme.
+func KubernetesScheme(scheme *runtime.Scheme) KubernetesOption {
+	return func(k *Kubernetes) {
+		k.scheme = scheme
+	}
+}
+
+func NewKubernetes(kubeconfigPath string, opts ...KubernetesOption) *Kubernetes {
+	k := &Kubernetes{
+		KubeconfigPath: kubeconfigPath,
+		scheme:         clientgoscheme.Scheme,
+	}
+
+	for _, o := range opts {
+		o(k)
 	}
+
+	return k
 }
 
 // ListReadyNodeNames returns the names of the nodes that are ready.
@@ -25,8 +59,30 @@ func NewKubernetes(kubeconfigPath string) *Kubernetes {
 func (k *Kubernetes) ListReadyNodeNames(t *testing.T) []string {
 	t.Helper()
 
-	nodes := k.GetNodes(t)
+	return readyNodeNames(k.GetNodes(t))
+}
+
+// EventuallyReadyNodeNames polls the names of the ready nodes until ok accepts them, and returns them.
+// It fails the test if ok does not accept them within the timeout, reporting the last names observed.
+// See Eventually for the options.
+//
+//	nodes := k.EventuallyReadyNodeNames(t, func(nodes []string) bool {
+//		return len(nodes) == 3
+//	}, testkit.PollTimeout(5*time.Minute))
+func (k *Kubernetes) EventuallyReadyNodeNames(t *testing.T, ok func(nodes []string) bool, opts ...PollOption) []string {
+	t.Helper()
+
+	return EventuallyValue(t, func(ctx context.Context) ([]string, error) {
+		nodes, err := k.getNodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return readyNodeNames(nodes), nil
+	}, ok, opts...)
+}
 
+func readyNodeNames(nodes []KubernetesNode) []string {
 	var readyNodes []string
 
 	for _, node := range nodes {
@@ -43,22 +99,45 @@ func (k *Kubernetes) ListReadyNodeNames(t *testing.T) []string {
 func (k *Kubernetes) GetNodes(t *testing.T) []KubernetesNode {
 	t.Helper()
 
-	var cmd []string
+	ctx, cancel := testContext(t)
+	defer cancel()
 
-	cmd = append(cmd, "get", "nodes", "-o", "json")
+	nodes, err := k.getNodes(ctx)
+	require.NoError(t, err)
 
-	out := k.capture(t, cmd...)
+	return nodes
+}
 
-	var result struct {
-		Items []KubernetesNode `json:"items"`
+func (k *Kubernetes) getNodes(ctx context.Context) ([]KubernetesNode, error) {
+	c, err := k.getClient()
+	if err != nil {
+		return nil, err
 	}
 
-	err := json.Unmarshal([]byte(out), &result)
-	require.NoError(t, err)
+	var list corev1.NodeList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %v", err)
+	}
 
-	return result.Items
+	nodes := make([]KubernetesNode, 0, len(list.Items))
+	for _, n := range list.Items {
+		node := KubernetesNode{Metadata: kubernetesMetadata{Name: n.Name}}
+		for _, c := range n.Status.Conditions {
+			node.Status.Conditions = append(node.Status.Conditions, kubernetesNodeCondition{
+				Type:    string(c.Type),
+				Status:  string(c.Status),
+				Reason:  c.Reason,
+				Message: c.Message,
+			})
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
 }
 
+// KubernetesNode is the summary of a node returned by GetNodes.
+// Use List with corev1.NodeList to get the nodes with all their fields.
 type KubernetesNode struct {
 	Metadata kubernetesMetadata   `json:"metadata"`
 	Status   kubernetesNodeStatus `json:"status"`
@@ -88,9 +167,3 @@ type kubernetesNodeCondition struct {
 	Reason  string `json:"reason"`
 	Message string `json:"message"`
 }
-
-func (k *Kubernetes) capture(t *testing.T, args ...string) string {
-	t.Helper()
-
-	return k.kubectl.Capture(t, args...)
-}
@@ -0,0 +1,164 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// KubernetesFieldManager is the field manager of the objects applied via Kubernetes.Apply.
+const KubernetesFieldManager = "testkit"
+
+// Client returns the client of the cluster built from KubeconfigPath,
+// for the operations not covered by Kubernetes, or for handling the errors by yourself,
+// like polling an object via Eventually until it's found.
+//
+//	testkit.Eventually(t, func(ctx context.Context) (bool, error) {
+//		var cm corev1.ConfigMap
+//		err := k.Client(t).Get(ctx, client.ObjectKey{Namespace: ns, Name: "config"}, &cm)
+//		return err == nil, err
+//	})
+func (k *Kubernetes) Client(t *testing.T) client.Client {
+	t.Helper()
+
+	c, err := k.getClient()
+	require.NoError(t, err)
+
+	return c
+}
+
+func (k *Kubernetes) getClient() (client.Client, error) {
+	k.clientOnce.Do(func() {
+		// Like kubectl, the default kubeconfig is used when the path is empty.
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = k.KubeconfigPath
+
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			k.clientErr = fmt.Errorf("unable to load kubeconfig %s: %v", k.KubeconfigPath, err)
+			return
+		}
+
+		k.client, err = client.New(config, client.Options{Scheme: k.scheme})
+		if err != nil {
+			k.clientErr = fmt.Errorf("unable to create Kubernetes client: %v", err)
+		}
+	})
+
+	return k.client, k.clientErr
+}
+
+// Get reads the object identified by the key into obj,
+// which is either a typed object like *corev1.Pod, or an *unstructured.Unstructured with its apiVersion and kind set.
+// It fails the test if the object cannot be read, including when it's not found.
+//
+//	var deploy appsv1.Deployment
+//	k.Get(t, client.ObjectKey{Namespace: ns, Name: "app"}, &deploy)
+func (k *Kubernetes) Get(t *testing.T, key client.ObjectKey, obj client.Object) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	require.NoError(t, k.Client(t).Get(ctx, key, obj), "unable to get %s", describeObject(obj, key))
+}
+
+// List reads the objects into list, like *corev1.PodList or *unstructured.UnstructuredList,
+// narrowed by the options like client.InNamespace and client.MatchingLabels.
+func (k *Kubernetes) List(t *testing.T, list client.ObjectList, opts ...client.ListOption) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	require.NoError(t, k.Client(t).List(ctx, list, opts...), "unable to list %T", list)
+}
+
+// Apply creates or updates the object via server-side apply, owning the fields set in obj as KubernetesFieldManager,
+// and updates obj with the object returned by the API server.
+// Conflicts with the other field managers are resolved in favor of the test.
+//
+//	k.Apply(t, &corev1.ConfigMap{
+//		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "config"},
+//		Data:       map[string]string{"key": "value"},
+//	})
+func (k *Kubernetes) Apply(t *testing.T, obj client.Object) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	require.NoError(t, k.apply(ctx, obj))
+}
+
+func (k *Kubernetes) apply(ctx context.Context, obj client.Object) error {
+	c, err := k.getClient()
+	if err != nil {
+		return err
+	}
+
+	// Server-side apply requires the apiVersion and the kind, which typed objects usually leave empty.
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return fmt.Errorf("unable to apply %T: %v", obj, err)
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	// The fields managed by the API server cannot be applied.
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+
+	if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(KubernetesFieldManager), client.ForceOwnership); err != nil {
+		return fmt.Errorf("unable to apply %s: %v", describeObject(obj, client.ObjectKeyFromObject(obj)), err)
+	}
+
+	return nil
+}
+
+// Patch patches the object with the patch, like client.MergeFrom(original),
+// and updates obj with the object returned by the API server.
+//
+//	original := deploy.DeepCopy()
+//	deploy.Spec.Replicas = ptr.To[int32](3)
+//	k.Patch(t, &deploy, client.MergeFrom(original))
+func (k *Kubernetes) Patch(t *testing.T, obj client.Object, patch client.Patch) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	require.NoError(t, k.Client(t).Patch(ctx, obj, patch, client.FieldOwner(KubernetesFieldManager)), "unable to patch %s", describeObject(obj, client.ObjectKeyFromObject(obj)))
+}
+
+// Delete deletes the object identified by the namespace and the name of obj.
+// An object that does not exist is considered deleted.
+// It does not wait for the object to be finalized.
+func (k *Kubernetes) Delete(t *testing.T, obj client.Object, opts ...client.DeleteOption) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	err := k.Client(t).Delete(ctx, obj, opts...)
+	if apierrors.IsNotFound(err) {
+		err = nil
+	}
+
+	require.NoError(t, err, "unable to delete %s", describeObject(obj, client.ObjectKeyFromObject(obj)))
+}
+
+// describeObject returns the description of the object in the error messages, like "ConfigMap default/config".
+func describeObject(obj client.Object, key client.ObjectKey) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind = fmt.Sprintf("%T", obj)
+	}
+
+	return kind + " " + key.String()
+}
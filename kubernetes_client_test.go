@@ -0,0 +1,161 @@
+package testkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestKubernetes_Client(t *testing.T) {
+	api := newFakeConfigMapAPI(t)
+
+	k := NewKubernetes(api.kubeconfigPath)
+
+	k.Apply(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+		Data:       map[string]string{"key": "value"},
+	})
+	require.Equal(t, "application/apply-patch+yaml", api.lastContentType)
+	require.Equal(t, "fieldManager=testkit&force=true", api.lastQuery)
+
+	var cm corev1.ConfigMap
+	k.Get(t, client.ObjectKey{Namespace: "default", Name: "config"}, &cm)
+	require.Equal(t, map[string]string{"key": "value"}, cm.Data)
+
+	original := cm.DeepCopy()
+	cm.Data["key"] = "patched"
+	k.Patch(t, &cm, client.MergeFrom(original))
+	require.Equal(t, "application/merge-patch+json", api.lastContentType)
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	k.Get(t, client.ObjectKey{Namespace: "default", Name: "config"}, u)
+	require.Equal(t, map[string]any{"key": "patched"}, u.Object["data"])
+
+	var list corev1.ConfigMapList
+	k.List(t, &list, client.InNamespace("default"))
+	require.Len(t, list.Items, 1)
+
+	k.Delete(t, &cm)
+	k.Delete(t, &cm)
+
+	list = corev1.ConfigMapList{}
+	k.List(t, &list, client.InNamespace("default"))
+	require.Empty(t, list.Items)
+}
+
+// fakeConfigMapAPI is a minimal Kubernetes API server that serves the ConfigMaps in the default namespace.
+// Applying and patching replace the data of the ConfigMap with the one in the request.
+type fakeConfigMapAPI struct {
+	kubeconfigPath string
+
+	mu              sync.Mutex
+	configMaps      map[string]map[string]any
+	lastContentType string
+	lastQuery       string
+}
+
+func newFakeConfigMapAPI(t *testing.T) *fakeConfigMapAPI {
+	t.Helper()
+
+	api := &fakeConfigMapAPI{configMaps: map[string]map[string]any{}}
+
+	s := httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(s.Close)
+
+	api.kubeconfigPath = filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(api.kubeconfigPath, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+current-context: fake
+`, s.URL)), 0600))
+
+	return api
+}
+
+func (api *fakeConfigMapAPI) serve(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	const prefix = "/api/v1/namespaces/default/configmaps"
+
+	switch {
+	case r.URL.Path == "/api":
+		fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+	case r.URL.Path == "/apis":
+		fmt.Fprint(w, `{"kind":"APIGroupList","groups":[]}`)
+	case r.URL.Path == "/api/v1":
+		fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"configmaps","namespaced":true,"kind":"ConfigMap","verbs":["get","list","patch","delete"]}]}`)
+	case r.URL.Path == prefix && r.Method == http.MethodGet:
+		items := []map[string]any{}
+		for _, cm := range api.configMaps {
+			items = append(items, cm)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"apiVersion": "v1", "kind": "ConfigMapList", "metadata": map[string]any{}, "items": items})
+	case strings.HasPrefix(r.URL.Path, prefix+"/"):
+		name := strings.TrimPrefix(r.URL.Path, prefix+"/")
+
+		switch r.Method {
+		case http.MethodPatch:
+			api.lastContentType = r.Header.Get("Content-Type")
+			api.lastQuery = r.URL.RawQuery
+
+			body, _ := io.ReadAll(r.Body)
+
+			var patch map[string]any
+			if err := json.Unmarshal(body, &patch); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			api.configMaps[name] = map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"namespace": "default", "name": name},
+				"data":       patch["data"],
+			}
+		case http.MethodDelete:
+			if _, ok := api.configMaps[name]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+				return
+			}
+			delete(api.configMaps, name)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Success"}`)
+			return
+		}
+
+		cm, ok := api.configMaps[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(cm)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
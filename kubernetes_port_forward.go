@@ -0,0 +1,252 @@
+package testkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+)
+
+const (
+	defaultPortForwardReadyTimeout = time.Minute
+
+	// portForwardRetryInterval is the interval between the attempts to start kubectl port-forward,
+	// so that a target whose pods are not running yet is not hammered.
+	portForwardRetryInterval = time.Second
+)
+
+// PortForwardConfig is the configuration of Kubernetes.PortForward.
+type PortForwardConfig struct {
+	// Namespace is the namespace of the target.
+	// Defaults to the namespace of the kubeconfig context.
+	Namespace string
+
+	// ReadyTimeout bounds the wait for the tunnel to be ready,
+	// including the wait for the pods of the target to run.
+	// Defaults to 1 minute.
+	ReadyTimeout time.Duration
+}
+
+type PortForwardOption func(*PortForwardConfig)
+
+// PortForwardNamespace sets PortForwardConfig.Namespace.
+func PortForwardNamespace(namespace string) PortForwardOption {
+	return func(c *PortForwardConfig) {
+		c.Namespace = namespace
+	}
+}
+
+// PortForwardReadyTimeout sets PortForwardConfig.ReadyTimeout.
+func PortForwardReadyTimeout(d time.Duration) PortForwardOption {
+	return func(c *PortForwardConfig) {
+		c.ReadyTimeout = d
+	}
+}
+
+// PortForward forwards a local port to the remote port of the target, like "svc/web", "deploy/web" or "pod/web-0",
+// via kubectl port-forward, and returns the local address as host:port once the tunnel is ready.
+//
+//	addr := k.PortForward(t, "svc/web", 80, testkit.PortForwardNamespace(ns.Name))
+//	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/status", nil)
+//	requirehttp.JSONResponse(t, req, http.StatusOK, &status, validate)
+//
+// kubectl forwards to a single pod of the service or the deployment, chosen when it starts,
+// and exits when the pod goes away.
+// PortForward restarts kubectl on the same local port whenever it exits, so that the address stays valid
+// across the restarts of the pods, although the requests sent while reconnecting fail.
+// The tunnel is closed when the test ends.
+func (k *Kubernetes) PortForward(t *testing.T, target string, remotePort int, opts ...PortForwardOption) string {
+	t.Helper()
+
+	conf := PortForwardConfig{
+		ReadyTimeout: defaultPortForwardReadyTimeout,
+	}
+
+	for _, o := range opts {
+		o(&conf)
+	}
+
+	pf := &portForward{
+		kubeconfigPath: k.KubeconfigPath,
+		target:         target,
+		remotePort:     remotePort,
+		namespace:      conf.Namespace,
+		logf:           t.Logf,
+		done:           make(chan struct{}),
+	}
+
+	// The tunnel outlives the readiness wait, and is closed on cleanup.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	readyCtx, cancelReady := withTestDeadline(ctx, t)
+	defer cancelReady()
+
+	readyCtx, cancelTimeout := context.WithTimeout(readyCtx, conf.ReadyTimeout)
+	defer cancelTimeout()
+
+	proc, err := pf.start(ctx, readyCtx)
+	if err != nil {
+		cancel()
+		fatal(t, testkiterror.New(
+			fmt.Sprintf("unable to forward port %d of %s", remotePort, target),
+			testkiterror.Cause(err),
+			testkiterror.Long(err.Error()),
+			testkiterror.Remediation("Check that the target exists, and that its pods are running and expose the port. "+
+				"Increase the timeout via testkit.PortForwardReadyTimeout if the pods take long to start."),
+		))
+		return ""
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", pf.localPort)
+
+	go pf.supervise(ctx, proc)
+
+	t.Cleanup(func() {
+		cancel()
+		<-pf.done
+	})
+
+	return addr
+}
+
+// portForward is a tunnel made by kubectl port-forward, restarted whenever kubectl exits.
+type portForward struct {
+	kubeconfigPath string
+	target         string
+	remotePort     int
+	namespace      string
+
+	logf func(format string, args ...any)
+
+	// localPort is the local port chosen by the first kubectl, and reused by the restarted ones.
+	localPort int
+
+	// done is closed when the supervision ends.
+	done chan struct{}
+}
+
+// portForwardProcess is a running kubectl port-forward.
+type portForwardProcess struct {
+	// exited is closed when kubectl exits, after err is set.
+	exited chan struct{}
+	err    error
+}
+
+// portForwardingLine matches the line printed by kubectl port-forward once it listens on the local port.
+var portForwardingLine = regexp.MustCompile(`^Forwarding from 127\.0\.0\.1:(\d+) -> \d+`)
+
+// start starts kubectl until it listens on the local port, or readyCtx is done.
+// kubectl keeps running until ctx is done.
+func (pf *portForward) start(ctx, readyCtx context.Context) (*portForwardProcess, error) {
+	for {
+		proc, err := pf.forward(ctx, readyCtx)
+		if err == nil {
+			return proc, nil
+		}
+
+		select {
+		case <-readyCtx.Done():
+			return nil, err
+		case <-time.After(portForwardRetryInterval):
+		}
+	}
+}
+
+// supervise restarts kubectl whenever it exits, until ctx is done.
+func (pf *portForward) supervise(ctx context.Context, proc *portForwardProcess) {
+	defer close(pf.done)
+
+	for {
+		<-proc.exited
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		pf.logf("kubectl port-forward %s exited: %v. Reconnecting on 127.0.0.1:%d", pf.target, proc.err, pf.localPort)
+
+		var err error
+
+		proc, err = pf.start(ctx, ctx)
+		if err != nil {
+			// ctx is done.
+			return
+		}
+
+		pf.logf("kubectl port-forward %s reconnected", pf.target)
+	}
+}
+
+// forward starts kubectl and waits for it to listen on the local port.
+// It returns the error with the output of kubectl if kubectl exits before that, or readyCtx is done.
+func (pf *portForward) forward(ctx, readyCtx context.Context) (*portForwardProcess, error) {
+	// The first kubectl chooses a free local port.
+	var local string
+	if pf.localPort != 0 {
+		local = strconv.Itoa(pf.localPort)
+	}
+
+	args := []string{"port-forward", pf.target, fmt.Sprintf("%s:%d", local, pf.remotePort), "--address", "127.0.0.1"}
+	if pf.namespace != "" {
+		args = append(args, "--namespace", pf.namespace)
+	}
+
+	c := newCommand(ctx, "kubectl", args...)
+	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", pf.kubeconfigPath))
+
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start kubectl port-forward: %v", err)
+	}
+
+	proc := &portForwardProcess{exited: make(chan struct{})}
+	ports := make(chan int, 1)
+
+	go func() {
+		// The output is read until kubectl exits,
+		// so that kubectl is not blocked writing the lines for the connections it handles.
+		s := bufio.NewScanner(stdout)
+		for s.Scan() {
+			if m := portForwardingLine.FindStringSubmatch(s.Text()); m != nil {
+				port, _ := strconv.Atoi(m[1])
+				select {
+				case ports <- port:
+				default:
+				}
+			}
+		}
+
+		proc.err = c.Wait()
+		if out := strings.TrimSpace(stderr.String()); out != "" {
+			proc.err = fmt.Errorf("%v: %s", proc.err, out)
+		}
+		close(proc.exited)
+	}()
+
+	select {
+	case port := <-ports:
+		pf.localPort = port
+		return proc, nil
+	case <-proc.exited:
+		return nil, fmt.Errorf("kubectl port-forward exited: %v", proc.err)
+	case <-readyCtx.Done():
+		_ = c.Process.Signal(os.Interrupt)
+		<-proc.exited
+		return nil, fmt.Errorf("kubectl port-forward did not listen on the local port: %v", proc.err)
+	}
+}
@@ -0,0 +1,46 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetes_PortForward(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+
+	// The fake kubectl fails while the pod is pending, then loses the connection to the first pod,
+	// and keeps forwarding to the second one on the same local port.
+	commands := fakeCommand(t, "kubectl", fmt.Sprintf(`
+echo >> %[1]s
+case "$(wc -l < %[1]s | tr -d ' ')" in
+1) echo "error: unable to forward port because pod is not running. Current status=Pending" >&2; exit 1;;
+2) echo "Forwarding from 127.0.0.1:54321 -> 8080"; sleep 0.2; echo "error: lost connection to pod" >&2; exit 1;;
+*) echo "Forwarding from 127.0.0.1:54321 -> 8080"; exec sleep 60;;
+esac`, runs))
+
+	k := NewKubernetes("kubeconfig")
+
+	start := time.Now()
+
+	t.Run("forward", func(t *testing.T) {
+		addr := k.PortForward(t, "svc/web", 8080, PortForwardNamespace("app"))
+		require.Equal(t, "127.0.0.1:54321", addr)
+
+		Eventually(t, func(context.Context) (bool, error) {
+			return countPrefixed(commands(), "port-forward svc/web 54321:8080 --address 127.0.0.1 --namespace app") == 1, nil
+		}, PollTimeout(10*time.Second))
+	})
+
+	// kubectl is stopped when the test ends, instead of sleeping until it's killed.
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.Equal(t, []string{
+		"port-forward svc/web :8080 --address 127.0.0.1 --namespace app",
+		"port-forward svc/web :8080 --address 127.0.0.1 --namespace app",
+		"port-forward svc/web 54321:8080 --address 127.0.0.1 --namespace app",
+	}, commands())
+}
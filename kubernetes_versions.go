@@ -0,0 +1,89 @@
+package testkit
+
+import (
+	"sync"
+	"testing"
+)
+
+// KubernetesVersionMatrixConfig is the configuration of ForEachKubernetesVersion.
+type KubernetesVersionMatrixConfig struct {
+	// Parallelism is the maximum number of the versions tested at the same time.
+	// Defaults to 2, as every version needs its own cluster.
+	Parallelism int
+	// ClusterOptions are the options used to get the cluster of each version,
+	// in addition to KubernetesVersion.
+	ClusterOptions []KubernetesClusterOption
+}
+
+type KubernetesVersionMatrixOption func(*KubernetesVersionMatrixConfig)
+
+const defaultKubernetesVersionMatrixParallelism = 2
+
+// MatrixParallelism sets the maximum number of the versions tested at the same time.
+func MatrixParallelism(n int) KubernetesVersionMatrixOption {
+	return func(c *KubernetesVersionMatrixConfig) {
+		c.Parallelism = n
+	}
+}
+
+// MatrixClusterOptions sets the options used to get the cluster of each version.
+func MatrixClusterOptions(opts ...KubernetesClusterOption) KubernetesVersionMatrixOption {
+	return func(c *KubernetesVersionMatrixConfig) {
+		c.ClusterOptions = append(c.ClusterOptions, opts...)
+	}
+}
+
+// ForEachKubernetesVersion runs f as a subtest named after each version,
+// with the cluster of the version obtained via KubernetesVersion.
+// Up to Parallelism subtests run at the same time, and ForEachKubernetesVersion returns when all of them finish.
+//
+// The clusters are created or reused like the ones obtained via KubernetesCluster,
+// so the cluster of each version is shared with the other tests using the harness,
+// and is cleaned up or retained along with the harness.
+//
+//	tk.ForEachKubernetesVersion(t, []string{"v1.28", "v1.29", "v1.30"}, func(t *testing.T, cluster *testkit.KubernetesCluster) {
+//		tk.Helm(cluster.KubeconfigPath).UpgradeOrInstall(t, "controller", "../charts/controller")
+//		...
+//	})
+func (tk *TestKit) ForEachKubernetesVersion(t *testing.T, versions []string, f func(*testing.T, *KubernetesCluster), opts ...KubernetesVersionMatrixOption) {
+	t.Helper()
+
+	conf := KubernetesVersionMatrixConfig{
+		Parallelism: defaultKubernetesVersionMatrixParallelism,
+	}
+
+	for _, o := range opts {
+		o(&conf)
+	}
+
+	if conf.Parallelism < 1 {
+		conf.Parallelism = 1
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, conf.Parallelism)
+	)
+
+	for _, version := range versions {
+		version := version
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Run is safe to be called from multiple goroutines
+			// as long as all the calls return before the test function returns.
+			t.Run(version, func(t *testing.T) {
+				clusterOpts := append(append([]KubernetesClusterOption(nil), conf.ClusterOptions...), KubernetesVersion(version))
+
+				f(t, tk.KubernetesCluster(t, clusterOpts...))
+			})
+		}()
+	}
+
+	wg.Wait()
+}
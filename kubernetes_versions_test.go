@@ -0,0 +1,62 @@
+package testkit
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachKubernetesVersion(t *testing.T) {
+	commands := fakeCommand(t, "kind", `case "$1" in create) sleep 0.2;; esac`)
+
+	kind := &KindProvider{NodeImages: map[string]string{"v1.31": "example.com/node:v1.31.0"}}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	var (
+		mu          sync.Mutex
+		running     int
+		maxRunning  int
+		clusterName = map[string]string{}
+	)
+
+	versions := []string{"v1.29", "1.30", "v1.28.7", "v1.31"}
+
+	tk.ForEachKubernetesVersion(t, versions, func(t *testing.T, cluster *KubernetesCluster) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		clusterName[t.Name()] = cluster.Name
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	})
+
+	require.LessOrEqual(t, maxRunning, 2)
+	require.Len(t, clusterName, len(versions))
+
+	for _, image := range []string{"kindest/node:v1.29.4", "kindest/node:v1.30.0", "kindest/node:v1.28.7", "example.com/node:v1.31.0"} {
+		require.Equal(t, 1, countContaining(commands(), "--image "+image), image)
+	}
+
+	// The clusters are reused by the later runs.
+	tk.ForEachKubernetesVersion(t, versions, func(t *testing.T, cluster *KubernetesCluster) {
+		require.NotEmpty(t, cluster.Name)
+	}, MatrixParallelism(4))
+	require.Equal(t, len(versions), countPrefixed(commands(), "create cluster"))
+
+	require.Empty(t, tk.DoCleanup())
+	require.Equal(t, len(versions), countPrefixed(commands(), "delete cluster"))
+
+	_, err = kind.GetKubernetesCluster(KubernetesVersion("v1.19"))
+	require.ErrorContains(t, err, "unable to find node image for Kubernetes version v1.19")
+}
@@ -0,0 +1,591 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// defaultKubernetesWaitTimeout is the default timeout of the waits for the Kubernetes objects,
+	// which is longer than the one of Eventually, as pulling images and starting containers take a while.
+	defaultKubernetesWaitTimeout = 5 * time.Minute
+	// defaultKubernetesWaitInterval is the default polling interval of the waits for the Kubernetes objects,
+	// so that the API server is not flooded with requests.
+	defaultKubernetesWaitInterval = time.Second
+
+	// kubernetesDiagnosticsTimeout bounds the requests collecting the diagnostics of a failed wait,
+	// which are made after the polling has timed out.
+	kubernetesDiagnosticsTimeout = 10 * time.Second
+
+	// maxKubernetesEvents is the number of the most recent events included in the diagnostics.
+	maxKubernetesEvents = 10
+)
+
+// WaitForRollout waits for the Deployment, the StatefulSet or the DaemonSet to finish rolling out,
+// like kubectl rollout status, and updates obj with the last state observed.
+// Only the namespace and the name of obj need to be set.
+//
+//	k.WaitForRollout(t, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "app"}})
+//
+// The timeout defaults to 5 minutes. See Eventually for the options.
+// On failure, the test fails with the status of obj, the recent events of obj and its pods,
+// and the reasons the containers of the pods are failing.
+func (k *Kubernetes) WaitForRollout(t *testing.T, obj client.Object, opts ...PollOption) {
+	t.Helper()
+
+	k.runWait(t, opts, func(ctx context.Context, conf PollConfig) error {
+		return k.waitForRollout(ctx, conf, obj)
+	})
+}
+
+func (k *Kubernetes) waitForRollout(ctx context.Context, conf PollConfig, obj client.Object) error {
+	var rolledOut func() error
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		rolledOut = func() error { return deploymentRolledOut(o) }
+	case *appsv1.StatefulSet:
+		rolledOut = func() error { return statefulSetRolledOut(o) }
+	case *appsv1.DaemonSet:
+		rolledOut = func() error { return daemonSetRolledOut(o) }
+	default:
+		return fmt.Errorf("unable to wait for rollout of %T: only Deployments, StatefulSets and DaemonSets are supported", obj)
+	}
+
+	return k.waitForObject(ctx, conf, obj, "did not roll out", rolledOut)
+}
+
+func deploymentRolledOut(d *appsv1.Deployment) error {
+	if d.Generation > d.Status.ObservedGeneration {
+		return errors.New("the update of the spec is not observed yet")
+	}
+
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return permanentWaitError{fmt.Errorf("progress deadline exceeded: %s", c.Message)}
+		}
+	}
+
+	replicas := replicasOrDefault(d.Spec.Replicas)
+
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return fmt.Errorf("%d of %d replicas are updated", d.Status.UpdatedReplicas, replicas)
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return fmt.Errorf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return fmt.Errorf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+
+	return nil
+}
+
+func statefulSetRolledOut(s *appsv1.StatefulSet) error {
+	if s.Status.ObservedGeneration == 0 || s.Generation > s.Status.ObservedGeneration {
+		return errors.New("the update of the spec is not observed yet")
+	}
+
+	replicas := replicasOrDefault(s.Spec.Replicas)
+
+	if s.Status.ReadyReplicas < replicas {
+		return fmt.Errorf("%d of %d replicas are ready", s.Status.ReadyReplicas, replicas)
+	}
+
+	// The pods of a StatefulSet with the OnDelete strategy are updated only when deleted by someone else.
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return nil
+	}
+
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*ru.Partition {
+			return fmt.Errorf("%d of %d replicas above the partition are updated", s.Status.UpdatedReplicas, replicas-*ru.Partition)
+		}
+
+		return nil
+	}
+
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return fmt.Errorf("%d of %d replicas are updated to revision %s", s.Status.UpdatedReplicas, replicas, s.Status.UpdateRevision)
+	}
+
+	return nil
+}
+
+func daemonSetRolledOut(d *appsv1.DaemonSet) error {
+	if d.Generation > d.Status.ObservedGeneration {
+		return errors.New("the update of the spec is not observed yet")
+	}
+
+	switch {
+	case d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled:
+		return fmt.Errorf("%d of %d pods are updated", d.Status.UpdatedNumberScheduled, d.Status.DesiredNumberScheduled)
+	case d.Status.NumberAvailable < d.Status.DesiredNumberScheduled:
+		return fmt.Errorf("%d of %d updated pods are available", d.Status.NumberAvailable, d.Status.DesiredNumberScheduled)
+	}
+
+	return nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+// WaitForJobComplete waits for the Job to complete, and updates job with the last state observed.
+// Only the namespace and the name of job need to be set.
+// It fails the test as soon as the Job fails, without waiting for the timeout.
+// See WaitForRollout for the timeout and the diagnostics on failure.
+func (k *Kubernetes) WaitForJobComplete(t *testing.T, job *batchv1.Job, opts ...PollOption) {
+	t.Helper()
+
+	k.runWait(t, opts, func(ctx context.Context, conf PollConfig) error {
+		return k.waitForJobComplete(ctx, conf, job)
+	})
+}
+
+func (k *Kubernetes) waitForJobComplete(ctx context.Context, conf PollConfig, job *batchv1.Job) error {
+	return k.waitForObject(ctx, conf, job, "did not complete", func() error {
+		for _, c := range job.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+
+			switch c.Type {
+			case batchv1.JobComplete:
+				return nil
+			case batchv1.JobFailed:
+				return permanentWaitError{fmt.Errorf("the job failed: %s: %s", c.Reason, c.Message)}
+			}
+		}
+
+		return fmt.Errorf("%d pods are active, %d succeeded and %d failed", job.Status.Active, job.Status.Succeeded, job.Status.Failed)
+	})
+}
+
+// WaitForCondition waits for the object to have the condition of the type in its status.conditions with the status,
+// like kubectl wait --for=condition=Ready, and updates obj with the last state observed.
+// obj is either a typed object or an *unstructured.Unstructured with its apiVersion and kind set,
+// and only the namespace and the name of it need to be set.
+//
+//	k.WaitForCondition(t, &certificate, "Ready", metav1.ConditionTrue)
+//
+// See WaitForRollout for the timeout and the diagnostics on failure.
+func (k *Kubernetes) WaitForCondition(t *testing.T, obj client.Object, conditionType string, status metav1.ConditionStatus, opts ...PollOption) {
+	t.Helper()
+
+	k.runWait(t, opts, func(ctx context.Context, conf PollConfig) error {
+		return k.waitForCondition(ctx, conf, obj, conditionType, status)
+	})
+}
+
+func (k *Kubernetes) waitForCondition(ctx context.Context, conf PollConfig, obj client.Object, conditionType string, status metav1.ConditionStatus) error {
+	return k.waitForObject(ctx, conf, obj, fmt.Sprintf("did not have condition %s=%s", conditionType, status), func() error {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return err
+		}
+
+		var s struct {
+			Status struct {
+				Conditions []metav1.Condition `json:"conditions"`
+			} `json:"status"`
+		}
+		// The conditions of some kinds lack the fields required by metav1.Condition, which are left empty.
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &s); err != nil {
+			return fmt.Errorf("unable to read conditions: %v", err)
+		}
+
+		for _, c := range s.Status.Conditions {
+			if c.Type != conditionType {
+				continue
+			}
+
+			if c.Status == status {
+				return nil
+			}
+
+			return fmt.Errorf("condition %s is %s: %s: %s", c.Type, c.Status, c.Reason, c.Message)
+		}
+
+		return fmt.Errorf("condition %s is not reported", conditionType)
+	})
+}
+
+// WaitForPodsReady waits for the pods in the namespace matching the label selector, like "app=web", to be ready,
+// and returns them.
+// There needs to be at least one pod, and the pods being deleted are ignored.
+// See WaitForRollout for the timeout and the diagnostics on failure.
+func (k *Kubernetes) WaitForPodsReady(t *testing.T, namespace, selector string, opts ...PollOption) []corev1.Pod {
+	t.Helper()
+
+	var pods []corev1.Pod
+
+	k.runWait(t, opts, func(ctx context.Context, conf PollConfig) error {
+		var err error
+		pods, err = k.waitForPodsReady(ctx, conf, namespace, selector)
+		return err
+	})
+
+	return pods
+}
+
+func (k *Kubernetes) waitForPodsReady(ctx context.Context, conf PollConfig, namespace, selector string) ([]corev1.Pod, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse selector %q: %v", selector, err)
+	}
+
+	c, err := k.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []corev1.Pod
+
+	err = k.wait(ctx, conf, fmt.Sprintf("pods matching %q in namespace %s are not ready", selector, namespace), func(ctx context.Context) error {
+		var err error
+		pods, err = listPods(ctx, c, namespace, sel)
+		if err != nil {
+			return err
+		}
+
+		if len(pods) == 0 {
+			return errors.New("no pods match the selector")
+		}
+
+		var notReady []string
+		for _, p := range pods {
+			if !podReady(&p) {
+				notReady = append(notReady, fmt.Sprintf("%s (%s)", p.Name, p.Status.Phase))
+			}
+		}
+
+		if len(notReady) > 0 {
+			return fmt.Errorf("%d of %d pods are not ready: %s", len(notReady), len(pods), strings.Join(notReady, ", "))
+		}
+
+		return nil
+	}, func(ctx context.Context) string {
+		var b strings.Builder
+		writePodDiagnostics(ctx, &b, c, namespace, pods, nil)
+		return b.String()
+	})
+
+	return pods, err
+}
+
+// listPods returns the pods matching the selector, except the ones being deleted.
+func listPods(ctx context.Context, c client.Client, namespace string, selector labels.Selector) ([]corev1.Pod, error) {
+	var list corev1.PodList
+	if err := c.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("unable to list pods: %v", err)
+	}
+
+	var pods []corev1.Pod
+	for _, p := range list.Items {
+		if p.DeletionTimestamp == nil {
+			pods = append(pods, p)
+		}
+	}
+
+	return pods, nil
+}
+
+func podReady(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// permanentWaitError is the error of a wait that cannot succeed anymore, like the one for a failed Job,
+// which makes the wait fail without waiting for the timeout.
+type permanentWaitError struct {
+	error
+}
+
+// waitForObject polls obj until done returns nil, reading obj on each poll.
+// It returns the error with the diagnostics of obj, whose short description is the description of obj followed by failure.
+func (k *Kubernetes) waitForObject(ctx context.Context, conf PollConfig, obj client.Object, failure string, done func() error) error {
+	c, err := k.getClient()
+	if err != nil {
+		return err
+	}
+
+	key := client.ObjectKeyFromObject(obj)
+
+	return k.wait(ctx, conf, fmt.Sprintf("%s %s %s", objectKind(c, obj), key, failure), func(ctx context.Context) error {
+		if err := c.Get(ctx, key, obj); err != nil {
+			return err
+		}
+
+		return done()
+	}, func(ctx context.Context) string {
+		return diagnoseObject(ctx, c, obj)
+	})
+}
+
+// wait polls check until it returns nil, or a permanentWaitError.
+// On failure, it returns the error described by short, with the diagnostics returned by diagnose.
+func (k *Kubernetes) wait(ctx context.Context, conf PollConfig, short string, check func(ctx context.Context) error, diagnose func(ctx context.Context) string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var permanent error
+
+	_, err := eventually(ctx, conf, func(ctx context.Context) (struct{}, error) {
+		err := check(ctx)
+		if pe := (permanentWaitError{}); errors.As(err, &pe) {
+			permanent = pe.error
+			cancel()
+		}
+		return struct{}{}, err
+	}, nil)
+	if err == nil {
+		return nil
+	}
+
+	// The diagnostics are collected after the polling has timed out, and need their own deadline.
+	dctx, dcancel := context.WithTimeout(context.WithoutCancel(ctx), kubernetesDiagnosticsTimeout)
+	defer dcancel()
+
+	diagnostics := diagnose(dctx)
+
+	if permanent != nil {
+		return testkiterror.New(
+			fmt.Sprintf("%s: %v", short, permanent),
+			testkiterror.Long(diagnostics),
+		)
+	}
+
+	e := &testkiterror.E{Short: err.Error()}
+	errors.As(err, &e)
+
+	e.Short = fmt.Sprintf("%s: %s", short, e.Short)
+	e.Long = strings.TrimSpace(e.Long + "\n\n" + diagnostics)
+
+	return e
+}
+
+// runWait runs the wait bounded by the timeout and the test deadline, and fails the test on error.
+func (k *Kubernetes) runWait(t *testing.T, opts []PollOption, wait func(ctx context.Context, conf PollConfig) error) {
+	t.Helper()
+
+	conf := newPollConfig(append([]PollOption{
+		PollTimeout(defaultKubernetesWaitTimeout),
+		PollInterval(defaultKubernetesWaitInterval),
+	}, opts...))
+
+	ctx, cancel := pollContext(t, conf)
+	defer cancel()
+
+	if err := wait(ctx, conf); err != nil {
+		fatal(t, err)
+	}
+}
+
+// objectKind returns the kind of obj, falling back to its Go type when the kind is unknown to the scheme.
+func objectKind(c client.Client, obj client.Object) string {
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		return gvk.Kind
+	}
+
+	return fmt.Sprintf("%T", obj)
+}
+
+// diagnoseObject returns the status of obj, and the diagnostics of its pods.
+// The pods are obj itself for a Pod, or the ones matching spec.selector for workloads like Deployments and Jobs.
+func diagnoseObject(ctx context.Context, c client.Client, obj client.Object) string {
+	var b strings.Builder
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		fmt.Fprintf(&b, "Unable to read the status: %v\n\n", err)
+	} else if status, err := yaml.Marshal(content["status"]); err == nil && content["status"] != nil {
+		fmt.Fprintf(&b, "Status:\n%s\n", indentLines(string(status), "  "))
+	}
+
+	var pods []corev1.Pod
+
+	if objectKind(c, obj) == "Pod" {
+		var pod corev1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &pod); err == nil {
+			pods = append(pods, pod)
+		}
+	} else if selector := podSelector(content); selector != nil {
+		pods, err = listPods(ctx, c, obj.GetNamespace(), selector)
+		if err != nil {
+			fmt.Fprintf(&b, "Unable to read the pods: %v\n\n", err)
+		}
+	}
+
+	writePodDiagnostics(ctx, &b, c, obj.GetNamespace(), pods, obj)
+
+	return strings.TrimSpace(b.String())
+}
+
+// podSelector returns the selector of the pods of a workload in spec.selector, if any.
+func podSelector(content map[string]any) labels.Selector {
+	spec, _ := content["spec"].(map[string]any)
+	raw, ok := spec["selector"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var ls metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &ls); err != nil {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil || selector.Empty() {
+		return nil
+	}
+
+	return selector
+}
+
+// writePodDiagnostics writes the recent events of obj, if any, and the pods,
+// and the reasons the pods are not scheduled and their containers are failing.
+func writePodDiagnostics(ctx context.Context, b *strings.Builder, c client.Client, namespace string, pods []corev1.Pod, obj client.Object) {
+	uids := map[types.UID]bool{}
+	if obj != nil {
+		uids[obj.GetUID()] = true
+	}
+	for _, p := range pods {
+		uids[p.UID] = true
+	}
+
+	var events corev1.EventList
+	if err := c.List(ctx, &events, client.InNamespace(namespace)); err != nil {
+		fmt.Fprintf(b, "Unable to read the events: %v\n\n", err)
+	} else {
+		var recent []corev1.Event
+		for _, e := range events.Items {
+			if uids[e.InvolvedObject.UID] {
+				recent = append(recent, e)
+			}
+		}
+
+		sort.SliceStable(recent, func(i, j int) bool {
+			return eventTime(&recent[i]).Before(eventTime(&recent[j]))
+		})
+
+		if len(recent) > maxKubernetesEvents {
+			recent = recent[len(recent)-maxKubernetesEvents:]
+		}
+
+		if len(recent) > 0 {
+			b.WriteString("Recent events:\n")
+			for _, e := range recent {
+				fmt.Fprintf(b, "  %s %s %s/%s: %s", e.Type, e.Reason, e.InvolvedObject.Kind, e.InvolvedObject.Name, strings.TrimSpace(e.Message))
+				if e.Count > 1 {
+					fmt.Fprintf(b, " (x%d)", e.Count)
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	var failures []string
+	for _, p := range pods {
+		failures = append(failures, podFailures(&p)...)
+	}
+
+	if len(failures) > 0 {
+		b.WriteString("Failing pods:\n")
+		for _, f := range failures {
+			fmt.Fprintf(b, "  %s\n", f)
+		}
+	}
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+// podFailures returns the reasons the pod is not scheduled, and its containers are waiting or terminated with errors.
+// The containers being created are not considered failing.
+func podFailures(p *corev1.Pod) []string {
+	var failures []string
+
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			failures = append(failures, fmt.Sprintf("pod/%s: %s: %s", p.Name, c.Reason, c.Message))
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...)
+
+	for _, cs := range statuses {
+		var reason string
+
+		switch s := cs.State; {
+		case s.Waiting != nil && s.Waiting.Reason != "" && s.Waiting.Reason != "ContainerCreating" && s.Waiting.Reason != "PodInitializing":
+			reason = joinNonEmpty(": ", s.Waiting.Reason, s.Waiting.Message)
+		case s.Terminated != nil && s.Terminated.ExitCode != 0:
+			reason = joinNonEmpty(": ", fmt.Sprintf("%s (exit code %d)", s.Terminated.Reason, s.Terminated.ExitCode), s.Terminated.Message)
+		}
+
+		if last := cs.LastTerminationState.Terminated; last != nil && last.ExitCode != 0 {
+			reason = joinNonEmpty(", ", reason, joinNonEmpty(": ", fmt.Sprintf("last terminated with %s (exit code %d)", last.Reason, last.ExitCode), last.Message))
+		}
+
+		if reason != "" {
+			failures = append(failures, fmt.Sprintf("pod/%s container %s: %s (%d restarts)", p.Name, cs.Name, reason, cs.RestartCount))
+		}
+	}
+
+	return failures
+}
+
+func joinNonEmpty(sep string, elems ...string) string {
+	var nonEmpty []string
+	for _, e := range elems {
+		if e = strings.TrimSpace(e); e != "" {
+			nonEmpty = append(nonEmpty, e)
+		}
+	}
+
+	return strings.Join(nonEmpty, sep)
+}
+
+func indentLines(s, indent string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = indent + l
+	}
+
+	return strings.Join(lines, "\n")
+}
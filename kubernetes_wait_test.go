@@ -0,0 +1,182 @@
+package testkit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKubernetes_WaitForRollout(t *testing.T) {
+	replicas := int32(2)
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	k := newFakeKubernetes(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ready", Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: selector},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: selector},
+			Status:     appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", UID: "web-1", Labels: map[string]string{"app": "web"}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "app",
+				RestartCount:         3,
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 40s restarting failed container"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+			}}},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "web-1.1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-1", UID: "web-1"},
+			Type:           "Warning",
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+			Count:          3,
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "other.1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other", UID: "other"},
+			Reason:         "Pulled",
+		},
+	)
+
+	ready := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ready"}}
+	k.WaitForRollout(t, ready)
+	require.Equal(t, int32(2), ready.Status.AvailableReplicas)
+
+	ctx, conf := shortWait(t)
+	err := k.waitForRollout(ctx, conf, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}})
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.Short, "Deployment default/web did not roll out: condition not satisfied within")
+	require.Contains(t, e.Long, "Last error: 1 of 2 updated replicas are available")
+	require.Contains(t, e.Long, "availableReplicas: 1")
+	require.Contains(t, e.Long, "Warning BackOff Pod/web-1: Back-off restarting failed container (x3)")
+	require.NotContains(t, e.Long, "Pulled")
+	require.Contains(t, e.Long, "pod/web-1 container app: CrashLoopBackOff: back-off 40s restarting failed container, last terminated with Error (exit code 1) (3 restarts)")
+
+	err = k.waitForRollout(context.Background(), newPollConfig(nil), &corev1.Pod{})
+	require.EqualError(t, err, "unable to wait for rollout of *v1.Pod: only Deployments, StatefulSets and DaemonSets are supported")
+}
+
+func TestKubernetes_WaitForJobComplete(t *testing.T) {
+	k := newFakeKubernetes(
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "complete"},
+			Status:     batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "failed"},
+			Status: batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+			}},
+		},
+	)
+
+	k.WaitForJobComplete(t, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "complete"}})
+
+	// A failed Job fails the wait without waiting for the timeout.
+	start := time.Now()
+	err := k.waitForJobComplete(context.Background(), newPollConfig([]PollOption{PollTimeout(time.Minute)}),
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "failed"}})
+	require.EqualError(t, err, "Job default/failed did not complete: the job failed: BackoffLimitExceeded: Job has reached the specified backoff limit")
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestKubernetes_WaitForPodsReady(t *testing.T) {
+	now := metav1.Now()
+
+	k := newFakeKubernetes(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", Labels: map[string]string{"app": "web"}},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+		},
+		// The pod being deleted is ignored.
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0", Labels: map[string]string{"app": "web"}, DeletionTimestamp: &now, Finalizers: []string{"test"}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-0", Labels: map[string]string{"app": "db"}},
+			Status: corev1.PodStatus{Phase: corev1.PodPending, Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/1 nodes are available: 1 Insufficient memory."},
+			}},
+		},
+	)
+
+	pods := k.WaitForPodsReady(t, "default", "app=web")
+	require.Len(t, pods, 1)
+	require.Equal(t, "web-1", pods[0].Name)
+
+	ctx, conf := shortWait(t)
+	_, err := k.waitForPodsReady(ctx, conf, "default", "app=db")
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.Short, `pods matching "app=db" in namespace default are not ready`)
+	require.Contains(t, e.Long, "1 of 1 pods are not ready: db-0 (Pending)")
+	require.Contains(t, e.Long, "pod/db-0: Unschedulable: 0/1 nodes are available: 1 Insufficient memory.")
+}
+
+func TestKubernetes_WaitForCondition(t *testing.T) {
+	k := newFakeKubernetes(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionFalse, Reason: "ContainersNotReady", Message: "containers with unready status: [app]"},
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+			}},
+		},
+	)
+
+	k.WaitForCondition(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}, "PodScheduled", metav1.ConditionTrue)
+
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Pod")
+	u.SetNamespace("default")
+	u.SetName("web")
+	k.WaitForCondition(t, u, "Ready", metav1.ConditionFalse)
+
+	ctx, conf := shortWait(t)
+	err := k.waitForCondition(ctx, conf, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}, "Ready", metav1.ConditionTrue)
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.Short, "Pod default/web did not have condition Ready=True")
+	require.Contains(t, e.Long, "Last error: condition Ready is False: ContainersNotReady: containers with unready status: [app]")
+}
+
+// shortWait returns the context and the configuration of a wait timing out shortly.
+func shortWait(t *testing.T) (context.Context, PollConfig) {
+	conf := newPollConfig([]PollOption{PollTimeout(50 * time.Millisecond), PollInterval(10 * time.Millisecond)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+	t.Cleanup(cancel)
+
+	return ctx, conf
+}
+
+// newFakeKubernetes returns the Kubernetes whose client is a fake client serving the objects.
+func newFakeKubernetes(objs ...client.Object) *Kubernetes {
+	k := NewKubernetes("")
+	k.client = fake.NewClientBuilder().WithObjects(objs...).Build()
+	k.clientOnce.Do(func() {})
+
+	return k
+}
@@ -36,8 +36,8 @@ If you are using git+ssh protocol, check if `+"`ssh $GITHUB_USER@github.com`"+`
 │ This application requires access to the file in the repository `+"`foo`"+` for reading the configuration, but was unable to do so due to an internal error.
 │
 │ Please make sure that the repository is accessible to the application.
-If you are using a private repository, please make sure that git is configured with the correct credentials.
-If you are using git+ssh protocol, check if `+"`ssh $GITHUB_USER@github.com`"+` works.
+│ If you are using a private repository, please make sure that git is configured with the correct credentials.
+│ If you are using git+ssh protocol, check if `+"`ssh $GITHUB_USER@github.com`"+` works.
 ╵
 `, c.Stderr(t))
 }
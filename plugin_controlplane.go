@@ -0,0 +1,511 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mumoshu/testkit/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// EnvKubebuilderAssets is the environment variable pointing to the directory
+// containing the etcd and kube-apiserver binaries, as set by setup-envtest.
+const EnvKubebuilderAssets = "KUBEBUILDER_ASSETS"
+
+// ControlPlaneProvider provides Kubernetes clusters that consist only of etcd and kube-apiserver,
+// like the ones of envtest in controller-runtime.
+// The binaries are run directly, so the clusters start in seconds without Docker.
+//
+// The clusters have no nodes and no controllers,
+// so pods are never scheduled and namespaces are never finalized.
+// They are suitable for testing controllers and webhooks that only talk to the API server.
+//
+// Like KindProvider, a cluster is started on the first request for its ID, reused by the later requests,
+// and stopped on Cleanup.
+// The kubeconfig of the clusters authenticates as a member of system:masters.
+//
+//	cp := &testkit.ControlPlaneProvider{}
+//	tk := testkit.New(t, testkit.Providers(cp, &testkit.KubectlProvider{Cluster: cp}))
+type ControlPlaneProvider struct {
+	// BinaryAssetsDirectory is the directory containing the etcd and kube-apiserver binaries.
+	// Defaults to KUBEBUILDER_ASSETS, and then to the binaries found in PATH.
+	BinaryAssetsDirectory string `yaml:"binaryAssetsDirectory"`
+
+	// StartTimeout is how long to wait for etcd and kube-apiserver to be ready. Defaults to 1 minute.
+	StartTimeout time.Duration `yaml:"startTimeout"`
+
+	// EtcdFlags are the extra flags passed to etcd.
+	EtcdFlags []string `yaml:"etcdFlags"`
+
+	// APIServerFlags are the extra flags passed to kube-apiserver,
+	// like "--feature-gates=...". They take precedence over the flags set by the provider.
+	APIServerFlags []string `yaml:"apiServerFlags"`
+
+	etcdBin      string
+	apiServerBin string
+
+	// mu guards controlPlanes, so that the provider can be used by parallel tests.
+	mu sync.Mutex
+	// controlPlanes maps the IDs of the clusters to the running control planes.
+	controlPlanes map[string]*controlPlane
+	// flights deduplicates concurrent requests for the same cluster.
+	flights singleflight.Group
+
+	log.L `yaml:"-"`
+
+	providerContext
+}
+
+var _ Provider = &ControlPlaneProvider{}
+var _ ContextProvider = &ControlPlaneProvider{}
+var _ ArtifactCollector = &ControlPlaneProvider{}
+var _ KubernetesClusterProvider = &ControlPlaneProvider{}
+
+const defaultControlPlaneStartTimeout = time.Minute
+
+// controlPlane is a pair of etcd and kube-apiserver processes.
+type controlPlane struct {
+	// dir contains the data of etcd, the certificates, the logs and the kubeconfig.
+	dir            string
+	kubeconfigPath string
+
+	etcd      *controlPlaneProcess
+	apiServer *controlPlaneProcess
+}
+
+// controlPlaneProcess is a long-running process whose output is written to a log file.
+type controlPlaneProcess struct {
+	name    string
+	cmd     *exec.Cmd
+	logPath string
+
+	// done is closed when the process exits, after err is set.
+	done chan struct{}
+	err  error
+}
+
+func (p *ControlPlaneProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *ControlPlaneProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
+	dir := p.BinaryAssetsDirectory
+	if dir == "" {
+		dir = os.Getenv(EnvKubebuilderAssets)
+	}
+
+	for name, bin := range map[string]*string{"etcd": &p.etcdBin, "kube-apiserver": &p.apiServerBin} {
+		path := name
+		if dir != "" {
+			path = filepath.Join(dir, name)
+		}
+
+		found, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("unable to find %s binary: %v. Set BinaryAssetsDirectory or %s to the directory containing etcd and kube-apiserver, like the one printed by setup-envtest use -p path", name, err, EnvKubebuilderAssets)
+		}
+
+		*bin = found
+	}
+
+	p.controlPlanes = make(map[string]*controlPlane)
+
+	return nil
+}
+
+func (p *ControlPlaneProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *ControlPlaneProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+
+	for id, cp := range p.controlPlanes {
+		if err := cp.stop(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		delete(p.controlPlanes, id)
+	}
+
+	return errors.Join(errs...)
+}
+
+// CollectArtifacts copies the logs of etcd and kube-apiserver of each cluster
+// into dir/controlplane/<ID>, where the ID of the cluster requested without an ID is "default".
+func (p *ControlPlaneProvider) CollectArtifacts(ctx context.Context, dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+
+	for id, cp := range p.controlPlanes {
+		if id == "" {
+			id = "default"
+		}
+
+		for _, proc := range []*controlPlaneProcess{cp.etcd, cp.apiServer} {
+			data, err := os.ReadFile(proc.logPath)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to read log of %s: %v", proc.name, err))
+				continue
+			}
+
+			if err := writeArtifact(dir, filepath.Join("controlplane", id, proc.name+".log"), data); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *ControlPlaneProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*KubernetesCluster, error) {
+	var conf KubernetesClusterConfig
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if conf.Version != "" {
+		return nil, fmt.Errorf("unable to provide Kubernetes cluster of version %s: the version is determined by the binaries in %s", conf.Version, filepath.Dir(p.apiServerBin))
+	}
+
+	// Concurrent requests for the same cluster wait for the first one to start it.
+	v, err, _ := p.flights.Do(flightKey("cluster", conf.ID), func() (any, error) {
+		p.mu.Lock()
+		cp, ok := p.controlPlanes[conf.ID]
+		p.mu.Unlock()
+
+		if !ok {
+			var err error
+
+			cp, err = p.startControlPlane(p.context())
+			if err != nil {
+				return nil, err
+			}
+
+			p.mu.Lock()
+			p.controlPlanes[conf.ID] = cp
+			p.mu.Unlock()
+		}
+
+		return &KubernetesCluster{KubeconfigPath: cp.kubeconfigPath}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	kc := *v.(*KubernetesCluster)
+
+	return &kc, nil
+}
+
+func (p *ControlPlaneProvider) startControlPlane(ctx context.Context) (_ *controlPlane, err error) {
+	dir, err := os.MkdirTemp("", "testkit-controlplane-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create control plane directory: %v", err)
+	}
+
+	cp := &controlPlane{
+		dir:            dir,
+		kubeconfigPath: filepath.Join(dir, "kubeconfig"),
+	}
+
+	defer func() {
+		if err != nil {
+			if stopErr := cp.stop(context.Background()); stopErr != nil {
+				p.Debugf("%v", stopErr)
+			}
+		}
+	}()
+
+	pki, err := newControlPlanePKI(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	etcdPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	apiServerPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := p.StartTimeout
+	if timeout == 0 {
+		timeout = defaultControlPlaneStartTimeout
+	}
+
+	etcdURL := "http://127.0.0.1:" + strconv.Itoa(etcdPort)
+
+	cp.etcd, err = startControlPlaneProcess(ctx, dir, "etcd", p.etcdBin, append([]string{
+		"--data-dir", filepath.Join(dir, "etcd"),
+		"--listen-client-urls", etcdURL,
+		"--advertise-client-urls", etcdURL,
+		"--listen-peer-urls", "http://127.0.0.1:0",
+		"--unsafe-no-fsync",
+	}, p.EtcdFlags...))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cp.etcd.waitReady(ctx, timeout, http.DefaultClient, etcdURL+"/health", ""); err != nil {
+		return nil, err
+	}
+
+	token := randString(32)
+
+	tokenFile := filepath.Join(dir, "tokens.csv")
+	if err := os.WriteFile(tokenFile, []byte(token+`,testkit-admin,testkit-admin,"system:masters"`+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("unable to write token file: %v", err)
+	}
+
+	apiServerURL := "https://127.0.0.1:" + strconv.Itoa(apiServerPort)
+
+	cp.apiServer, err = startControlPlaneProcess(ctx, dir, "kube-apiserver", p.apiServerBin, append([]string{
+		"--etcd-servers=" + etcdURL,
+		"--bind-address=127.0.0.1",
+		"--advertise-address=127.0.0.1",
+		"--secure-port=" + strconv.Itoa(apiServerPort),
+		"--cert-dir=" + dir,
+		"--tls-cert-file=" + pki.servingCertPath,
+		"--tls-private-key-file=" + pki.servingKeyPath,
+		"--token-auth-file=" + tokenFile,
+		"--authorization-mode=RBAC",
+		"--service-account-issuer=" + apiServerURL,
+		"--service-account-key-file=" + pki.serviceAccountKeyPath,
+		"--service-account-signing-key-file=" + pki.serviceAccountKeyPath,
+		"--service-cluster-ip-range=10.0.0.0/24",
+		"--allow-privileged=true",
+		// There is no controller-manager to create the service account tokens the admission plugin requires.
+		"--disable-admission-plugins=ServiceAccount",
+	}, p.APIServerFlags...))
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pki.caCert)
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+
+	if err := cp.apiServer.waitReady(ctx, timeout, client, apiServerURL+"/readyz", token); err != nil {
+		return nil, err
+	}
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: testkit
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: testkit-admin
+  user:
+    token: %s
+contexts:
+- name: testkit
+  context:
+    cluster: testkit
+    user: testkit-admin
+current-context: testkit
+`, apiServerURL, base64.StdEncoding.EncodeToString(pki.caCert), token)
+
+	if err := os.WriteFile(cp.kubeconfigPath, []byte(kubeconfig), 0600); err != nil {
+		return nil, fmt.Errorf("unable to write kubeconfig: %v", err)
+	}
+
+	p.Debugf("Started control plane at %s with kubeconfig %s", apiServerURL, cp.kubeconfigPath)
+
+	return cp, nil
+}
+
+// stop stops kube-apiserver and etcd, and removes the data of the control plane.
+func (cp *controlPlane) stop(ctx context.Context) error {
+	for _, proc := range []*controlPlaneProcess{cp.apiServer, cp.etcd} {
+		if proc == nil {
+			continue
+		}
+
+		if err := proc.stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(cp.dir); err != nil {
+		return fmt.Errorf("unable to remove control plane directory: %v", err)
+	}
+
+	return nil
+}
+
+func startControlPlaneProcess(ctx context.Context, dir, name, bin string, args []string) (*controlPlaneProcess, error) {
+	logPath := filepath.Join(dir, name+".log")
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create log file of %s: %v", name, err)
+	}
+
+	c := newCommand(ctx, bin, args...)
+	c.Stdout = logFile
+	c.Stderr = logFile
+
+	if err := c.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("unable to start %s: %v", name, err)
+	}
+
+	proc := &controlPlaneProcess{
+		name:    name,
+		cmd:     c,
+		logPath: logPath,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		proc.err = c.Wait()
+		logFile.Close()
+		close(proc.done)
+	}()
+
+	return proc, nil
+}
+
+// waitReady polls the health endpoint of the process until it returns 200 OK.
+// It returns as soon as the process exits, with the tail of its log.
+func (proc *controlPlaneProcess) waitReady(ctx context.Context, timeout time.Duration, client *http.Client, url, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-proc.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conf := newPollConfig([]PollOption{PollTimeout(timeout), PollBackoff(2, time.Second)})
+
+	_, err := eventually(ctx, conf, func(ctx context.Context) (int, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+
+		return res.StatusCode, nil
+	}, func(status int) bool {
+		return status == http.StatusOK
+	})
+
+	select {
+	case <-proc.done:
+		return fmt.Errorf("%s exited before becoming ready: %v: %s", proc.name, proc.err, proc.logTail())
+	default:
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s did not become ready: %w: %s", proc.name, err, proc.logTail())
+	}
+
+	return nil
+}
+
+// controlPlaneStopTimeout is how long a process is given to exit after being interrupted.
+const controlPlaneStopTimeout = 10 * time.Second
+
+func (proc *controlPlaneProcess) stop(ctx context.Context) error {
+	select {
+	case <-proc.done:
+		return nil
+	default:
+	}
+
+	if err := proc.cmd.Process.Signal(os.Interrupt); err != nil {
+		return fmt.Errorf("unable to interrupt %s: %v", proc.name, err)
+	}
+
+	timer := time.NewTimer(controlPlaneStopTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-proc.done:
+		return nil
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	if err := proc.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("unable to kill %s: %v", proc.name, err)
+	}
+
+	<-proc.done
+
+	return nil
+}
+
+// controlPlaneLogTailSize is the maximum size of the log included in the errors.
+const controlPlaneLogTailSize = 4096
+
+func (proc *controlPlaneProcess) logTail() string {
+	data, err := os.ReadFile(proc.logPath)
+	if err != nil {
+		return fmt.Sprintf("unable to read log: %v", err)
+	}
+
+	if len(data) > controlPlaneLogTailSize {
+		data = data[len(data)-controlPlaneLogTailSize:]
+	}
+
+	return string(bytes.TrimSpace(data))
+}
+
+// freePort returns a TCP port on 127.0.0.1 that is free at the time of the call.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("unable to find free port: %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
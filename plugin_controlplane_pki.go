@@ -0,0 +1,110 @@
+package testkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// controlPlanePKI is the set of the files the API server is started with.
+type controlPlanePKI struct {
+	// caCert is the PEM-encoded certificate of the CA that signed the serving certificate.
+	caCert []byte
+
+	servingCertPath string
+	servingKeyPath  string
+	// serviceAccountKeyPath is the path to the private key the service account tokens are signed with.
+	serviceAccountKeyPath string
+}
+
+// controlPlaneCertValidity is long enough for any test run.
+const controlPlaneCertValidity = 24 * time.Hour
+
+// newControlPlanePKI writes a self-signed CA, the serving certificate for 127.0.0.1 signed by the CA,
+// and the service account signing key into dir.
+func newControlPlanePKI(dir string) (*controlPlanePKI, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate CA key: %v", err)
+	}
+
+	now := time.Now()
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "testkit-ca"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(controlPlaneCertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CA certificate: %v", err)
+	}
+
+	servingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serving key: %v", err)
+	}
+
+	servingTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "kube-apiserver"},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(controlPlaneCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost", "kubernetes", "kubernetes.default", "kubernetes.default.svc"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	servingDER, err := x509.CreateCertificate(rand.Reader, servingTemplate, caTemplate, &servingKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create serving certificate: %v", err)
+	}
+
+	servingKeyDER, err := x509.MarshalECPrivateKey(servingKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal serving key: %v", err)
+	}
+
+	// RSA keys are accepted by every version of the API server for signing service account tokens.
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate service account key: %v", err)
+	}
+
+	pki := &controlPlanePKI{
+		caCert:                pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		servingCertPath:       filepath.Join(dir, "apiserver.crt"),
+		servingKeyPath:        filepath.Join(dir, "apiserver.key"),
+		serviceAccountKeyPath: filepath.Join(dir, "sa.key"),
+	}
+
+	files := map[string][]byte{
+		pki.servingCertPath:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: servingDER}),
+		pki.servingKeyPath:        pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: servingKeyDER}),
+		pki.serviceAccountKeyPath: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(saKey)}),
+	}
+
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("unable to write %s: %v", path, err)
+		}
+	}
+
+	return pki, nil
+}
@@ -0,0 +1,134 @@
+package testkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlPlaneProvider(t *testing.T) {
+	assets := fakeControlPlaneAssets(t)
+
+	cp := &ControlPlaneProvider{BinaryAssetsDirectory: assets}
+
+	tk, err := Build(Providers(cp), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster := tk.KubernetesCluster(t)
+
+	kubeconfig, err := os.ReadFile(cluster.KubeconfigPath)
+	require.NoError(t, err)
+	require.Contains(t, string(kubeconfig), "server: https://127.0.0.1:")
+	require.Contains(t, string(kubeconfig), "certificate-authority-data: ")
+
+	// The cluster is reused, and another ID gets another cluster.
+	require.Equal(t, cluster.KubeconfigPath, tk.KubernetesCluster(t).KubeconfigPath)
+	require.NotEqual(t, cluster.KubeconfigPath, tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "other" }).KubeconfigPath)
+
+	artifacts := t.TempDir()
+	require.NoError(t, cp.CollectArtifacts(context.Background(), artifacts))
+	require.FileExists(t, filepath.Join(artifacts, "controlplane", "default", "kube-apiserver.log"))
+	require.FileExists(t, filepath.Join(artifacts, "controlplane", "other", "etcd.log"))
+
+	require.Empty(t, tk.DoCleanup())
+	require.NoFileExists(t, cluster.KubeconfigPath)
+}
+
+func TestControlPlaneProvider_Failure(t *testing.T) {
+	assets := fakeControlPlaneAssets(t)
+
+	// The fake kube-apiserver exits with an error for unknown flags, like the real one.
+	cp := &ControlPlaneProvider{BinaryAssetsDirectory: assets, APIServerFlags: []string{"--unknown"}}
+
+	tk, err := Build(Providers(cp), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	_, err = cp.GetKubernetesCluster()
+	require.ErrorContains(t, err, "kube-apiserver exited before becoming ready")
+	require.ErrorContains(t, err, "unknown flag: --unknown")
+
+	err = (&ControlPlaneProvider{BinaryAssetsDirectory: t.TempDir()}).Setup()
+	require.ErrorContains(t, err, "unable to find")
+}
+
+// fakeControlPlaneAssets returns the directory containing the fake etcd and kube-apiserver,
+// which run TestControlPlaneHelperProcess.
+func fakeControlPlaneAssets(t *testing.T) string {
+	t.Helper()
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("the fake binaries are shell scripts")
+	}
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"etcd", "kube-apiserver"} {
+		script := "#!/bin/sh\nTESTKIT_CONTROLPLANE_HELPER=" + name + " exec " + os.Args[0] + " -test.run=^TestControlPlaneHelperProcess$ -- \"$@\"\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+	}
+
+	return dir
+}
+
+// TestControlPlaneHelperProcess is not a real test.
+// It serves the health endpoint of etcd or kube-apiserver as the fake binaries.
+func TestControlPlaneHelperProcess(t *testing.T) {
+	name := os.Getenv("TESTKIT_CONTROLPLANE_HELPER")
+	if name == "" {
+		return
+	}
+
+	flags := map[string]string{}
+
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		k, v, ok := strings.Cut(args[i], "=")
+		if !ok && i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			i++
+			v = args[i]
+		}
+		flags[k] = v
+	}
+
+	switch name {
+	case "etcd":
+		u, err := url.Parse(flags["--listen-client-urls"])
+		require.NoError(t, err)
+
+		require.NoError(t, http.ListenAndServe(u.Host, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	case "kube-apiserver":
+		if _, ok := flags["--unknown"]; ok {
+			os.Stderr.WriteString("Error: unknown flag: --unknown\n")
+			os.Exit(1)
+		}
+
+		tokens, err := os.ReadFile(flags["--token-auth-file"])
+		require.NoError(t, err)
+		token, _, _ := strings.Cut(string(tokens), ",")
+
+		l, err := net.Listen("tcp", "127.0.0.1:"+flags["--secure-port"])
+		require.NoError(t, err)
+
+		require.NoError(t, http.ServeTLS(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/readyz" || r.Header.Get("Authorization") != "Bearer "+token {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}), flags["--tls-cert-file"], flags["--tls-private-key-file"]))
+	}
+}
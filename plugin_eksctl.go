@@ -2,7 +2,7 @@ package testkit
 
 type EKSCTLProvider struct {
 	// ConfigPath is the path to the eksctl config file.
-	ConfigPath string
+	ConfigPath string `yaml:"configPath"`
 }
 
 var _ Provider = &EKSCTLProvider{}
@@ -0,0 +1,398 @@
+package testkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/mumoshu/testkit/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// k3dClusterNameMaxLen is the maximum length of the name of a k3d cluster.
+const k3dClusterNameMaxLen = 32
+
+// K3dProvider provides Kubernetes clusters by running k3s in docker via k3d.
+// It's an alternative to KindProvider whose clusters start faster.
+//
+// Like KindProvider, the cluster is created on the first request,
+// reused by the later requests for the same ID, and deleted on Cleanup.
+// Note that k3d limits the names of the clusters, which contain the ID, to 32 characters,
+// so the ID of a cluster must be at most 10 characters long.
+type K3dProvider struct {
+	k3dBin string
+
+	// mu guards clusterNames, so that the provider can be used by parallel tests.
+	mu sync.Mutex
+	// clusterNames is a list of cluster names that have been created.
+	clusterNames map[string]struct{}
+	// flights deduplicates concurrent requests for the same cluster.
+	flights singleflight.Group
+
+	// kubeconfigDir is the directory where the kubeconfig files are stored.
+	kubeconfigDir string
+
+	// Servers is the number of the server nodes. Defaults to 1.
+	Servers int `yaml:"servers"`
+
+	// Agents is the number of the agent nodes. Defaults to 0.
+	Agents int `yaml:"agents"`
+
+	// Image is the k3s image to use for the nodes, like rancher/k3s:v1.29.4-k3s1.
+	// Defaults to the one chosen by k3d.
+	Image string `yaml:"image"`
+
+	// Registries configures the registries the clusters pull images from.
+	Registries K3dRegistries `yaml:"registries"`
+
+	// Ports are the ports of the nodes published to the host.
+	Ports []K3dPortMapping `yaml:"ports"`
+
+	// Wait is the timeout of waiting for the server nodes to be ready. Defaults to the one of k3d.
+	Wait time.Duration `yaml:"wait"`
+
+	// ExtraArgs are the extra arguments passed to k3d cluster create, like "--k3s-arg".
+	ExtraArgs []string `yaml:"extraArgs"`
+
+	log.L `yaml:"-"`
+
+	journaling
+	providerContext
+}
+
+// K3dRegistries configures the registries of the k3d clusters.
+// See https://k3d.io/stable/usage/registries/.
+type K3dRegistries struct {
+	// Create creates a registry along with each cluster, like "registry.localhost:0.0.0.0:5001".
+	// It's passed to k3d cluster create --registry-create, and the registry is deleted along with the cluster.
+	Create string `yaml:"create"`
+	// Use connects the clusters to the existing registries, like "k3d-registry.localhost:5000".
+	Use []string `yaml:"use"`
+	// Config is the path to the registries.yaml of k3s.
+	Config string `yaml:"config"`
+}
+
+// K3dPortMapping publishes a port of the nodes to the host.
+type K3dPortMapping struct {
+	// HostPort is the port on the host.
+	HostPort int `yaml:"hostPort"`
+	// ContainerPort is the port on the nodes.
+	ContainerPort int `yaml:"containerPort"`
+	// ListenAddress is the address on the host to listen on. Defaults to 0.0.0.0.
+	ListenAddress string `yaml:"listenAddress"`
+	// NodeFilter selects the nodes to publish the port of, like "agent:0".
+	// Defaults to "loadbalancer".
+	NodeFilter string `yaml:"nodeFilter"`
+}
+
+func (m K3dPortMapping) String() string {
+	s := strconv.Itoa(m.HostPort) + ":" + strconv.Itoa(m.ContainerPort)
+	if m.ListenAddress != "" {
+		s = m.ListenAddress + ":" + s
+	}
+
+	nodeFilter := m.NodeFilter
+	if nodeFilter == "" {
+		nodeFilter = "loadbalancer"
+	}
+
+	return s + "@" + nodeFilter
+}
+
+var _ Provider = &K3dProvider{}
+var _ ContextProvider = &K3dProvider{}
+var _ KubernetesClusterProvider = &K3dProvider{}
+
+func (p *K3dProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *K3dProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
+	const (
+		k3dBin = "k3d"
+	)
+
+	bin, err := exec.LookPath(k3dBin)
+	if err != nil {
+		return fmt.Errorf("unable to find %s binary: %v", k3dBin, err)
+	}
+
+	p.k3dBin = bin
+	p.kubeconfigDir = filepath.Join(os.TempDir(), "testkit_k3d_kubeconfigs")
+	p.clusterNames = make(map[string]struct{})
+
+	return nil
+}
+
+func (p *K3dProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *K3dProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for clusterName := range p.clusterNames {
+		out, err := p.capture(ctx, "cluster", "delete", clusterName)
+		if err != nil {
+			return fmt.Errorf("unable to delete cluster %s: %v: %s", clusterName, err, out)
+		}
+
+		delete(p.clusterNames, clusterName)
+
+		if err := p.journal.Remove("k3d", "cluster", clusterName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *K3dProvider) clusterKubeconfigPath(clusterName string) string {
+	return filepath.Join(p.kubeconfigDir, fmt.Sprintf("%s.kubeconfig", clusterName))
+}
+
+func (p *K3dProvider) capture(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, p.k3dBin, args...)
+
+	r, err := combinedOutput(ctx, c)
+	return string(r), err
+}
+
+func (p *K3dProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*KubernetesCluster, error) {
+	var conf KubernetesClusterConfig
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	// Concurrent requests for the same cluster wait for the first one to create it.
+	v, err, _ := p.flights.Do(flightKey("cluster", conf.ID, conf.Version), func() (any, error) {
+		return p.getKubernetesCluster(conf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	kc := *v.(*KubernetesCluster)
+
+	return &kc, nil
+}
+
+func (p *K3dProvider) getKubernetesCluster(conf KubernetesClusterConfig) (*KubernetesCluster, error) {
+	createArgs, err := p.createArgs(conf.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hash of the arguments in the name prevents a cluster of a different shape from being reused.
+	h := sha256.Sum256([]byte(strings.Join(createArgs, "\n")))
+
+	hash := hex.EncodeToString(h[:])[:kindConfigHashLen]
+
+	clusterName := ResourceNamePrefix
+	if conf.ID != "" {
+		clusterName += conf.ID + "-"
+	}
+	clusterName += hash + "-"
+
+	if n := len(clusterName) + clusterNameSuffixLen; n > k3dClusterNameMaxLen {
+		return nil, testkiterror.New(
+			fmt.Sprintf("cluster ID %q is too long for k3d", conf.ID),
+			testkiterror.Long(fmt.Sprintf("The name of the cluster would be %d characters long, while k3d accepts up to %d.", n, k3dClusterNameMaxLen)),
+			testkiterror.Remediation(fmt.Sprintf("Use an ID of at most %d characters.", len(conf.ID)-(n-k3dClusterNameMaxLen))),
+		)
+	}
+
+	p.mu.Lock()
+	var managedClusterName string
+	for cn := range p.clusterNames {
+		if matchClusterName(cn, conf.ID, hash) {
+			managedClusterName = cn
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	if managedClusterName != "" {
+		return p.writeKubeconfig(managedClusterName)
+	}
+
+	if p.reuse {
+		kc, err := p.reattachKubernetesCluster(conf, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if kc != nil {
+			return kc, nil
+		}
+	}
+
+	out, err := p.capture(p.context(), "cluster", "list", "--no-headers")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list clusters: %v: %s", err, out)
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !matchClusterName(fields[0], conf.ID, hash) {
+			continue
+		}
+
+		// We don't want to delete the cluster when we're done with it,
+		// because we didn't create it.
+		return p.writeKubeconfig(fields[0])
+	}
+
+	clusterName += randString(clusterNameSuffixLen)
+
+	args := append([]string{"cluster", "create", clusterName}, createArgs...)
+
+	out, err = p.capture(p.context(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cluster %s: %v: %s", clusterName, err, out)
+	}
+
+	p.mu.Lock()
+	p.clusterNames[clusterName] = struct{}{}
+	p.mu.Unlock()
+
+	kc, err := p.writeKubeconfig(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Debugf("Exported kubeconfig for cluster %s: %s", clusterName, filecontentLogVar{kc.KubeconfigPath})
+
+	if err := p.journal.Record(JournalEntry{
+		Provider:       "k3d",
+		Kind:           "cluster",
+		ID:             conf.ID,
+		Name:           clusterName,
+		KubeconfigPath: kc.KubeconfigPath,
+	}); err != nil {
+		return nil, err
+	}
+
+	return kc, nil
+}
+
+// createArgs returns the arguments to k3d cluster create following the name of the cluster.
+// They determine the shape of the cluster.
+func (p *K3dProvider) createArgs(version string) ([]string, error) {
+	// Do not let k3d touch the default kubeconfig, as the provider writes one per cluster.
+	args := []string{"--kubeconfig-update-default=false", "--kubeconfig-switch-context=false", "--wait"}
+
+	if p.Servers > 0 {
+		args = append(args, "--servers", strconv.Itoa(p.Servers))
+	}
+
+	if p.Agents > 0 {
+		args = append(args, "--agents", strconv.Itoa(p.Agents))
+	}
+
+	image := p.Image
+	if version != "" {
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+
+		// The k3s images are tagged with the patch versions of Kubernetes.
+		if strings.Count(version, ".") != 2 {
+			return nil, fmt.Errorf("unable to find k3s image for Kubernetes version %s. Use a patch version like %s.0", version, version)
+		}
+
+		image = "rancher/k3s:" + version + "-k3s1"
+	}
+
+	if image != "" {
+		args = append(args, "--image", image)
+	}
+
+	if p.Wait > 0 {
+		args = append(args, "--timeout", p.Wait.String())
+	}
+
+	for _, m := range p.Ports {
+		args = append(args, "--port", m.String())
+	}
+
+	if p.Registries.Create != "" {
+		args = append(args, "--registry-create", p.Registries.Create)
+	}
+
+	for _, r := range p.Registries.Use {
+		args = append(args, "--registry-use", r)
+	}
+
+	if p.Registries.Config != "" {
+		args = append(args, "--registry-config", p.Registries.Config)
+	}
+
+	args = append(args, p.ExtraArgs...)
+
+	return args, nil
+}
+
+func (p *K3dProvider) writeKubeconfig(clusterName string) (*KubernetesCluster, error) {
+	kubeconfigPath := p.clusterKubeconfigPath(clusterName)
+
+	if err := os.MkdirAll(p.kubeconfigDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create kubeconfig directory: %v", err)
+	}
+
+	out, err := p.capture(p.context(), "kubeconfig", "write", clusterName, "--output", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write kubeconfig for cluster %s: %v: %s", clusterName, err, out)
+	}
+
+	return &KubernetesCluster{
+		KubeconfigPath: kubeconfigPath,
+		Name:           clusterName,
+	}, nil
+}
+
+// reattachKubernetesCluster returns the cluster recorded in the journal for the ID, if any.
+// A reattached cluster is deleted on Cleanup, as if it was created by this provider.
+func (p *K3dProvider) reattachKubernetesCluster(conf KubernetesClusterConfig, hash string) (*KubernetesCluster, error) {
+	entries, err := p.journal.Find("k3d", "cluster", func(e JournalEntry) bool {
+		return e.ID == conf.ID && matchClusterName(e.Name, conf.ID, hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		kc, err := p.writeKubeconfig(e.Name)
+		if err != nil {
+			// The cluster has likely been deleted outside of testkit.
+			p.Debugf("Skipped reattaching to cluster %s recorded in run %s: %v", e.Name, e.RunID, err)
+			if err := p.journal.Remove("k3d", "cluster", e.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		p.clusterNames[e.Name] = struct{}{}
+		p.mu.Unlock()
+
+		return kc, nil
+	}
+
+	return nil, nil
+}
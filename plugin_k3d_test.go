@@ -0,0 +1,78 @@
+package testkit
+
+import (
+	"strings"
+	"testing"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+)
+
+func TestK3dProvider(t *testing.T) {
+	// The fake k3d lists a cluster of a different shape.
+	commands := fakeCommand(t, "k3d", `
+case "$1 $2" in
+"cluster list") echo "testkit-e2e-00000000-abcd   1/1       0/0      true";;
+esac`)
+
+	k3d := &K3dProvider{
+		Agents: 2,
+		Image:  "rancher/k3s:v1.29.4-k3s1",
+		Ports:  []K3dPortMapping{{HostPort: 8080, ContainerPort: 80}},
+		Registries: K3dRegistries{
+			Create: "registry.localhost:0.0.0.0:5001",
+		},
+	}
+
+	tk, err := Build(Providers(k3d), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster := tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "e2e" })
+	require.True(t, strings.HasPrefix(cluster.Name, "testkit-e2e-"), cluster.Name)
+	require.NotEqual(t, "testkit-e2e-00000000-abcd", cluster.Name)
+	require.Equal(t, k3d.clusterKubeconfigPath(cluster.Name), cluster.KubeconfigPath)
+
+	require.Equal(t, []string{
+		"cluster list --no-headers",
+		"cluster create " + cluster.Name + " --kubeconfig-update-default=false --kubeconfig-switch-context=false --wait --agents 2 --image rancher/k3s:v1.29.4-k3s1 --port 8080:80@loadbalancer --registry-create registry.localhost:0.0.0.0:5001",
+		"kubeconfig write " + cluster.Name + " --output " + cluster.KubeconfigPath,
+	}, commands())
+
+	// The cluster is reused.
+	require.Equal(t, cluster.Name, tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "e2e" }).Name)
+	require.Equal(t, 1, countPrefixed(commands(), "cluster create"))
+
+	// A cluster of another version is created separately.
+	require.NotEqual(t, cluster.Name, tk.KubernetesCluster(t, KubernetesVersion("v1.28.9")).Name)
+	require.Equal(t, 1, countContaining(commands(), "--image rancher/k3s:v1.28.9-k3s1"))
+
+	_, err = k3d.GetKubernetesCluster(KubernetesVersion("v1.28"))
+	require.ErrorContains(t, err, "unable to find k3s image for Kubernetes version v1.28")
+
+	require.Empty(t, tk.DoCleanup())
+	require.Equal(t, 2, countPrefixed(commands(), "cluster delete"))
+	require.Equal(t, 1, countPrefixed(commands(), "cluster delete "+cluster.Name))
+}
+
+func TestK3dProvider_LongID(t *testing.T) {
+	commands := fakeCommand(t, "k3d", "")
+
+	k3d := &K3dProvider{}
+
+	tk, err := Build(Providers(k3d), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster, err := k3d.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "0123456789" })
+	require.NoError(t, err)
+	require.Len(t, cluster.Name, k3dClusterNameMaxLen)
+
+	// The ID making the name too long is rejected before any cluster is created.
+	_, err = k3d.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "0123456789a" })
+	require.ErrorContains(t, err, `cluster ID "0123456789a" is too long for k3d`)
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.String(), "Use an ID of at most 10 characters.")
+	require.Equal(t, 1, countPrefixed(commands(), "cluster create"))
+}
@@ -1,44 +1,87 @@
 package testkit
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mumoshu/testkit/log"
+	"golang.org/x/sync/singleflight"
 )
 
 type KindProvider struct {
 	kindBin string
 
+	// mu guards clusterNames, loadedImages and registries, so that the provider can be used by parallel tests.
+	mu sync.Mutex
 	// clusterNames is a list of cluster names that have been created.
 	clusterNames map[string]struct{}
+	// loadedImages maps the names of the clusters to the images loaded into them via LoadImages,
+	// and the images to their IDs.
+	loadedImages map[string]map[string]string
+	// registries maps the names of the clusters to the endpoints of their local registries.
+	registries map[string]string
+	// flights deduplicates concurrent requests for the same cluster.
+	flights singleflight.Group
 
 	// kubeconfigDir is the directory where the kubeconfig files are stored.
 	kubeconfigDir string
 
 	// Wait for control plane node to be ready (default 0s)
-	Wait time.Duration
+	Wait time.Duration `yaml:"wait"`
 
 	// node docker image to use for booting the cluster
-	Image string
+	Image string `yaml:"image"`
+
+	// NodeImages maps the Kubernetes versions requested via KubernetesVersion, like "v1.29",
+	// to the node images used for booting the clusters of the versions.
+	// Versions missing in NodeImages default to the images built for kind v0.23.0,
+	// and patch versions like "v1.29.4" default to kindest/node:<version>.
+	NodeImages map[string]string `yaml:"nodeImages"`
 
 	// ConfigPath is the path to a kind configuration file
-	ConfigPath string
+	ConfigPath string `yaml:"configPath"`
+
+	// LocalRegistry enables the local registry for each cluster when set.
+	// See KindLocalRegistry.
+	LocalRegistry *KindLocalRegistry `yaml:"localRegistry"`
+
+	// ClusterConfig is the configuration of the clusters, like the nodes and the port mappings.
+	// It's rendered into a temporary kind configuration file.
+	// Only one of ClusterConfig and ConfigPath can be set.
+	//
+	// An existing cluster is reused only when it was created with the same configuration and Image,
+	// which is checked via the hash of them included in the name of the cluster.
+	// Without ClusterConfig, ConfigPath, LocalRegistry and Image, the name includes no hash.
+	ClusterConfig *KindClusterConfig `yaml:"clusterConfig"`
 
 	// Retain retains nodes for debugging when cluster creation fails
-	Retain bool
+	Retain bool `yaml:"retain"`
+
+	log.L `yaml:"-"`
 
-	log.L
+	journaling
+	providerContext
 }
 
 var _ Provider = &KindProvider{}
+var _ ContextProvider = &KindProvider{}
+var _ ArtifactCollector = &KindProvider{}
 var _ KubernetesClusterProvider = &KindProvider{}
 
 func (p *KindProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *KindProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
 	const (
 		kindBin = "kind"
 	)
@@ -51,30 +94,74 @@ func (p *KindProvider) Setup() error {
 	p.kindBin = bin
 	p.kubeconfigDir = filepath.Join(os.TempDir(), "testkit_kind_kubeconfigs")
 	p.clusterNames = make(map[string]struct{})
+	p.loadedImages = make(map[string]map[string]string)
+	p.registries = make(map[string]string)
 
 	return nil
 }
 
 func (p *KindProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *KindProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	for clusterName := range p.clusterNames {
-		_, err := p.capture(p.clusterKubeconfigPath(clusterName), "delete", "cluster", "--name", clusterName)
+		_, err := p.capture(ctx, p.clusterKubeconfigPath(clusterName), "delete", "cluster", "--name", clusterName)
 		if err != nil {
 			return fmt.Errorf("unable to delete cluster %s: %v", clusterName, err)
 		}
+
+		delete(p.loadedImages, clusterName)
+
+		if _, ok := p.registries[clusterName]; ok {
+			if err := p.stopLocalRegistry(ctx, clusterName); err != nil {
+				return err
+			}
+			delete(p.registries, clusterName)
+		}
+
+		if err := p.journal.Remove("kind", "cluster", clusterName); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// CollectArtifacts exports the logs of the clusters created by the provider
+// into dir/kind/<cluster name> via kind export logs.
+func (p *KindProvider) CollectArtifacts(ctx context.Context, dir string) error {
+	p.mu.Lock()
+	var clusterNames []string
+	for clusterName := range p.clusterNames {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+
+	for _, clusterName := range clusterNames {
+		out, err := p.capture(ctx, p.clusterKubeconfigPath(clusterName), "export", "logs", filepath.Join(dir, "kind", clusterName), "--name", clusterName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to export logs of cluster %s: %v: %s", clusterName, err, out))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func (p *KindProvider) clusterKubeconfigPath(clusterName string) string {
 	return filepath.Join(p.kubeconfigDir, fmt.Sprintf("%s.kubeconfig", clusterName))
 }
 
-func (p *KindProvider) capture(kubeconfigPath string, args ...string) (string, error) {
-	c := exec.Command(p.kindBin, args...)
+func (p *KindProvider) capture(ctx context.Context, kubeconfigPath string, args ...string) (string, error) {
+	c := newCommand(ctx, p.kindBin, args...)
 	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath))
 
-	r, err := c.CombinedOutput()
+	r, err := combinedOutput(ctx, c)
 	return string(r), err
 }
 
@@ -85,29 +172,95 @@ func (p *KindProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*K
 		opt(&conf)
 	}
 
-	clusterName := "testkit-"
+	// Concurrent requests for the same cluster wait for the first one to create it.
+	v, err, _ := p.flights.Do(flightKey("cluster", conf.ID, conf.Version), func() (any, error) {
+		return p.getKubernetesCluster(conf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	kc := *v.(*KubernetesCluster)
+
+	return &kc, nil
+}
+
+func (p *KindProvider) getKubernetesCluster(conf KubernetesClusterConfig) (*KubernetesCluster, error) {
+	kc, err := p.getOrCreateKubernetesCluster(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.LocalRegistry != nil {
+		kc.Registry, err = p.localRegistry(p.context(), kc.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kc, nil
+}
+
+func (p *KindProvider) getOrCreateKubernetesCluster(conf KubernetesClusterConfig) (*KubernetesCluster, error) {
+	image, err := p.nodeImage(conf.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	config, configHash, err := p.clusterConfig(image)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hash of the configuration in the name prevents a cluster of a different shape from being reused.
+	clusterName := ResourceNamePrefix
 	if conf.ID != "" {
 		clusterName += conf.ID + "-"
 	}
+	if configHash != "" {
+		clusterName += configHash + "-"
+	}
 
+	p.mu.Lock()
+	var managedClusterName string
 	for cn := range p.clusterNames {
-		if strings.HasPrefix(cn, clusterName) {
-			kubeconfigPath := p.clusterKubeconfigPath(cn)
+		if matchClusterName(cn, conf.ID, configHash) {
+			managedClusterName = cn
+			break
+		}
+	}
+	p.mu.Unlock()
 
-			msg, err := p.capture(kubeconfigPath, "export", "kubeconfig", "--name", cn)
-			if err != nil {
-				return nil, fmt.Errorf("unable to export kubeconfig for cluster %s: %v: %s", cn, err, msg)
-			}
+	if cn := managedClusterName; cn != "" {
+		kubeconfigPath := p.clusterKubeconfigPath(cn)
 
-			return &KubernetesCluster{
-				KubeconfigPath: kubeconfigPath,
-			}, nil
+		msg, err := p.capture(p.context(), kubeconfigPath, "export", "kubeconfig", "--name", cn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to export kubeconfig for cluster %s: %v: %s", cn, err, msg)
+		}
+
+		return &KubernetesCluster{
+			KubeconfigPath: kubeconfigPath,
+			Name:           cn,
+		}, nil
+	}
+
+	if p.reuse {
+		kc, err := p.reattachKubernetesCluster(conf, configHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if kc != nil {
+			return kc, nil
 		}
 	}
 
 	var unmanagedAvailableClusterNames []string
 	{
-		r, err := p.capture("", "get", "clusters")
+		r, err := p.capture(p.context(), "", "get", "clusters")
 		if err != nil {
 			return nil, fmt.Errorf("unable to get clusters: %v", err)
 		}
@@ -123,10 +276,10 @@ func (p *KindProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*K
 	}
 
 	for _, cn := range unmanagedAvailableClusterNames {
-		if strings.HasPrefix(cn, clusterName) {
+		if matchClusterName(cn, conf.ID, configHash) {
 			kubeconfigPath := p.clusterKubeconfigPath(cn)
 
-			msg, err := p.capture(kubeconfigPath, "export", "kubeconfig", "--name", cn)
+			msg, err := p.capture(p.context(), kubeconfigPath, "export", "kubeconfig", "--name", cn)
 			if err != nil {
 				return nil, fmt.Errorf("unable to export kubeconfig for cluster %s: %v: %s", cn, err, msg)
 			}
@@ -137,11 +290,12 @@ func (p *KindProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*K
 
 			return &KubernetesCluster{
 				KubeconfigPath: kubeconfigPath,
+				Name:           cn,
 			}, nil
 		}
 	}
 
-	clusterName += randString(4)
+	clusterName += randString(clusterNameSuffixLen)
 
 	kubeconfigPath := p.clusterKubeconfigPath(clusterName)
 
@@ -150,32 +304,132 @@ func (p *KindProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*K
 		args = append(args, "--wait", p.Wait.String())
 	}
 
-	if p.Image != "" {
-		args = append(args, "--image", p.Image)
+	if image != "" {
+		args = append(args, "--image", image)
 	}
 
-	if p.ConfigPath != "" {
+	switch {
+	case p.ConfigPath != "":
 		args = append(args, "--config", p.ConfigPath)
+	case config != nil:
+		f, err := os.CreateTemp("", "testkit-kind-config-*.yaml")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create kind config file: %v", err)
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.Write(config)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to write kind config file: %v", err)
+		}
+
+		args = append(args, "--config", f.Name())
 	}
 
 	if p.Retain {
 		args = append(args, "--retain")
 	}
 
-	_, err := p.capture(kubeconfigPath, args...)
+	_, err = p.capture(p.context(), kubeconfigPath, args...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create cluster %s: %v", clusterName, err)
 	}
 
 	p.Debugf("Exported kubeconfig for cluster %s: %s", clusterName, filecontentLogVar{kubeconfigPath})
 
+	p.mu.Lock()
 	p.clusterNames[clusterName] = struct{}{}
+	p.mu.Unlock()
+
+	var attrs map[string]string
+	if configHash != "" {
+		attrs = map[string]string{"configHash": configHash}
+	}
+
+	if err := p.journal.Record(JournalEntry{
+		Provider:       "kind",
+		Kind:           "cluster",
+		ID:             conf.ID,
+		Name:           clusterName,
+		KubeconfigPath: kubeconfigPath,
+		Attributes:     attrs,
+	}); err != nil {
+		return nil, err
+	}
 
 	return &KubernetesCluster{
 		KubeconfigPath: kubeconfigPath,
+		Name:           clusterName,
 	}, nil
 }
 
+// reattachKubernetesCluster returns the cluster recorded in the journal for the ID, if any.
+// Only the clusters whose names have the ID and the hash of the configuration are reattached.
+// A reattached cluster is deleted on Cleanup, as if it was created by this provider.
+func (p *KindProvider) reattachKubernetesCluster(conf KubernetesClusterConfig, configHash string) (*KubernetesCluster, error) {
+	entries, err := p.journal.Find("kind", "cluster", func(e JournalEntry) bool {
+		return e.ID == conf.ID && matchClusterName(e.Name, conf.ID, configHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		kubeconfigPath := p.clusterKubeconfigPath(e.Name)
+
+		msg, err := p.capture(p.context(), kubeconfigPath, "export", "kubeconfig", "--name", e.Name)
+		if err != nil {
+			// The cluster has likely been deleted outside of testkit.
+			p.Debugf("Skipped reattaching to cluster %s recorded in run %s: %v: %s", e.Name, e.RunID, err, msg)
+			if err := p.journal.Remove("kind", "cluster", e.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		p.clusterNames[e.Name] = struct{}{}
+		p.mu.Unlock()
+
+		return &KubernetesCluster{
+			KubeconfigPath: kubeconfigPath,
+			Name:           e.Name,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// clusterNameSuffixLen is the length of the random suffix of the names of the clusters.
+const clusterNameSuffixLen = 4
+
+// matchClusterName reports whether the cluster of the name was created for the ID and the configuration hash.
+// The name is parsed back into testkit-[<ID>-][<hash>-]<random suffix>, and the ID and the hash must match exactly,
+// so that a request without a hash never gets a cluster of a custom shape, nor a request without an ID the cluster of another ID.
+func matchClusterName(name, id, hash string) bool {
+	rest, ok := strings.CutPrefix(name, ResourceNamePrefix)
+	if !ok || len(rest) < clusterNameSuffixLen {
+		return false
+	}
+
+	middle, suffix := rest[:len(rest)-clusterNameSuffixLen], rest[len(rest)-clusterNameSuffixLen:]
+	if strings.Trim(suffix, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+		return false
+	}
+
+	var want string
+	for _, part := range []string{id, hash} {
+		if part != "" {
+			want += part + "-"
+		}
+	}
+
+	return middle == want
+}
+
 type filecontentLogVar struct {
 	path string
 }
@@ -0,0 +1,180 @@
+package testkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// KindClusterConfig is the configuration of the clusters created by KindProvider.
+// It's rendered into a kind configuration file of the kind.x-k8s.io/v1alpha4 API.
+//
+// See https://kind.sigs.k8s.io/docs/user/configuration/ for the details of each field.
+//
+//	kind := &testkit.KindProvider{
+//		ClusterConfig: &testkit.KindClusterConfig{
+//			Nodes: []testkit.KindNode{
+//				{
+//					Role: testkit.KindControlPlane,
+//					ExtraPortMappings: []testkit.KindPortMapping{
+//						{ContainerPort: 30080, HostPort: 8080},
+//					},
+//				},
+//				{Role: testkit.KindWorker},
+//				{Role: testkit.KindWorker},
+//			},
+//			FeatureGates: map[string]bool{"InPlacePodVerticalScaling": true},
+//		},
+//	}
+type KindClusterConfig struct {
+	// Nodes are the nodes of the cluster.
+	// Defaults to a single control-plane node.
+	Nodes []KindNode `yaml:"nodes,omitempty"`
+	// Networking is the network configuration of the cluster.
+	Networking *KindNetworking `yaml:"networking,omitempty"`
+	// FeatureGates are the Kubernetes feature gates to enable or disable.
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+	// RuntimeConfig are the API server runtime configuration, like "api/alpha": "false".
+	RuntimeConfig map[string]string `yaml:"runtimeConfig,omitempty"`
+	// KubeadmConfigPatches are the patches to the kubeadm configuration of all the nodes.
+	KubeadmConfigPatches []string `yaml:"kubeadmConfigPatches,omitempty"`
+	// ContainerdConfigPatches are the patches to the containerd configuration of all the nodes,
+	// like the ones to configure registry mirrors.
+	ContainerdConfigPatches []string `yaml:"containerdConfigPatches,omitempty"`
+}
+
+const (
+	// KindControlPlane is the role of the control-plane nodes.
+	KindControlPlane = "control-plane"
+	// KindWorker is the role of the worker nodes.
+	KindWorker = "worker"
+)
+
+// KindNode is a node of a kind cluster.
+type KindNode struct {
+	// Role is either KindControlPlane or KindWorker.
+	Role string `yaml:"role"`
+	// Image is the node image of the node.
+	// Defaults to KindProvider.Image.
+	Image string `yaml:"image,omitempty"`
+	// Labels are the Kubernetes labels of the node.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// ExtraMounts are the host paths mounted into the node.
+	ExtraMounts []KindMount `yaml:"extraMounts,omitempty"`
+	// ExtraPortMappings are the ports of the node exposed on the host.
+	ExtraPortMappings []KindPortMapping `yaml:"extraPortMappings,omitempty"`
+	// KubeadmConfigPatches are the patches to the kubeadm configuration of the node.
+	KubeadmConfigPatches []string `yaml:"kubeadmConfigPatches,omitempty"`
+}
+
+// KindMount is a host path mounted into a node.
+type KindMount struct {
+	HostPath      string `yaml:"hostPath"`
+	ContainerPath string `yaml:"containerPath"`
+	ReadOnly      bool   `yaml:"readOnly,omitempty"`
+	// Propagation is the mount propagation, one of "None", "HostToContainer" and "Bidirectional".
+	Propagation string `yaml:"propagation,omitempty"`
+}
+
+// KindPortMapping is a port of a node exposed on the host.
+type KindPortMapping struct {
+	ContainerPort int32 `yaml:"containerPort"`
+	HostPort      int32 `yaml:"hostPort,omitempty"`
+	// ListenAddress is the host address to listen on. Defaults to 0.0.0.0.
+	ListenAddress string `yaml:"listenAddress,omitempty"`
+	// Protocol is one of "TCP", "UDP" and "SCTP". Defaults to TCP.
+	Protocol string `yaml:"protocol,omitempty"`
+}
+
+// KindNetworking is the network configuration of a kind cluster.
+type KindNetworking struct {
+	// IPFamily is one of "ipv4", "ipv6" and "dual".
+	IPFamily         string `yaml:"ipFamily,omitempty"`
+	APIServerAddress string `yaml:"apiServerAddress,omitempty"`
+	APIServerPort    int32  `yaml:"apiServerPort,omitempty"`
+	PodSubnet        string `yaml:"podSubnet,omitempty"`
+	ServiceSubnet    string `yaml:"serviceSubnet,omitempty"`
+	// DisableDefaultCNI disables kindnet, so that you can install your own CNI.
+	DisableDefaultCNI bool `yaml:"disableDefaultCNI,omitempty"`
+	// KubeProxyMode is one of "iptables", "ipvs" and "none".
+	KubeProxyMode string `yaml:"kubeProxyMode,omitempty"`
+}
+
+// kindConfigFile is the kind configuration file rendered from KindClusterConfig.
+type kindConfigFile struct {
+	Kind              string `yaml:"kind"`
+	APIVersion        string `yaml:"apiVersion"`
+	KindClusterConfig `yaml:",inline"`
+}
+
+// render returns the content of the kind configuration file.
+func (c *KindClusterConfig) render() ([]byte, error) {
+	return yaml.Marshal(kindConfigFile{
+		Kind:              "Cluster",
+		APIVersion:        "kind.x-k8s.io/v1alpha4",
+		KindClusterConfig: *c,
+	})
+}
+
+// kindConfigHashLen is the length of the hash of the cluster configuration
+// included in the names of the clusters.
+const kindConfigHashLen = 8
+
+// clusterConfig returns the content of the kind configuration file to create the clusters with, if any,
+// and the hash of everything that determines the shape of the clusters,
+// which are the configuration file and the node image.
+// The configuration contains the containerd configuration for the local registry, if enabled.
+//
+// The hash is empty when there is neither a configuration file nor a node image,
+// so that the clusters of the default shape keep being named testkit-<ID>-xxxx and are reused as before.
+func (p *KindProvider) clusterConfig(image string) ([]byte, string, error) {
+	if p.ClusterConfig != nil && p.ConfigPath != "" {
+		return nil, "", fmt.Errorf("only one of ClusterConfig and ConfigPath can be set")
+	}
+
+	cc := p.ClusterConfig
+
+	if p.LocalRegistry != nil {
+		if p.ConfigPath != "" {
+			return nil, "", fmt.Errorf("LocalRegistry cannot be used with ConfigPath. Use ClusterConfig instead")
+		}
+
+		var c KindClusterConfig
+		if cc != nil {
+			c = *cc
+		}
+		c.ContainerdConfigPatches = append(append([]string(nil), c.ContainerdConfigPatches...), containerdRegistryConfigPatch)
+		cc = &c
+	}
+
+	var (
+		config []byte
+		err    error
+	)
+
+	switch {
+	case cc != nil:
+		config, err = cc.render()
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to render kind config: %v", err)
+		}
+	case p.ConfigPath != "":
+		config, err = os.ReadFile(p.ConfigPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read kind config: %v", err)
+		}
+	}
+
+	if config == nil && image == "" {
+		return nil, "", nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "image=%s\n", image)
+	h.Write(config)
+
+	return config, hex.EncodeToString(h.Sum(nil))[:kindConfigHashLen], nil
+}
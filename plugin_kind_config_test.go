@@ -0,0 +1,151 @@
+package testkit
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindClusterConfig_Render(t *testing.T) {
+	c := &KindClusterConfig{
+		Nodes: []KindNode{
+			{
+				Role: KindControlPlane,
+				ExtraPortMappings: []KindPortMapping{
+					{ContainerPort: 30080, HostPort: 8080},
+				},
+				ExtraMounts: []KindMount{
+					{HostPath: "/tmp/data", ContainerPath: "/data", ReadOnly: true},
+				},
+			},
+			{Role: KindWorker, Labels: map[string]string{"tier": "app"}},
+		},
+		Networking:              &KindNetworking{DisableDefaultCNI: true, PodSubnet: "10.244.0.0/16"},
+		FeatureGates:            map[string]bool{"InPlacePodVerticalScaling": true},
+		ContainerdConfigPatches: []string{"[plugins.\"io.containerd.grpc.v1.cri\".registry]\n  config_path = \"/etc/containerd/certs.d\"\n"},
+	}
+
+	data, err := c.render()
+	require.NoError(t, err)
+	require.Equal(t, `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+  extraMounts:
+  - hostPath: /tmp/data
+    containerPath: /data
+    readOnly: true
+  extraPortMappings:
+  - containerPort: 30080
+    hostPort: 8080
+- role: worker
+  labels:
+    tier: app
+networking:
+  podSubnet: 10.244.0.0/16
+  disableDefaultCNI: true
+featureGates:
+  InPlacePodVerticalScaling: true
+containerdConfigPatches:
+- |
+  [plugins."io.containerd.grpc.v1.cri".registry]
+    config_path = "/etc/containerd/certs.d"
+`, string(data))
+}
+
+func TestKindProvider_ClusterConfig(t *testing.T) {
+	configs := t.TempDir()
+
+	// The fake kind lists a cluster of a different shape, and saves the config of the created cluster.
+	commands := fakeCommand(t, "kind", `
+case "$1" in
+get) echo testkit-e2e-00000000-abcd;;
+create) while [ "$#" -gt 0 ]; do [ "$1" = --config ] && cp "$2" `+configs+`/config.yaml; shift; done;;
+esac`)
+
+	kind := &KindProvider{
+		Image: "kindest/node:v1.29.2",
+		ClusterConfig: &KindClusterConfig{
+			Nodes: []KindNode{{Role: KindControlPlane}, {Role: KindWorker}},
+		},
+	}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	_, hash, err := kind.clusterConfig(kind.Image)
+	require.NoError(t, err)
+
+	kc, err := kind.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "e2e" })
+	require.NoError(t, err)
+	require.Contains(t, kc.KubeconfigPath, "testkit-e2e-"+hash+"-")
+
+	// The cluster of a different shape is never reused.
+	require.Equal(t, 1, countPrefixed(commands(), "create cluster --name testkit-e2e-"+hash+"-"))
+	require.Zero(t, countPrefixed(commands(), "export kubeconfig --name testkit-e2e-00000000-abcd"))
+
+	config, err := os.ReadFile(configs + "/config.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "kind: Cluster\napiVersion: kind.x-k8s.io/v1alpha4\nnodes:\n- role: control-plane\n- role: worker\n", string(config))
+
+	// Changing the image changes the shape of the cluster.
+	_, hash2, err := kind.clusterConfig("kindest/node:v1.28.7")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, hash2)
+
+	kind.ConfigPath = "kind.yaml"
+	_, _, err = kind.clusterConfig(kind.Image)
+	require.EqualError(t, err, "only one of ClusterConfig and ConfigPath can be set")
+
+	require.Empty(t, tk.DoCleanup())
+	require.True(t, strings.HasPrefix(commands()[len(commands())-1], "delete cluster --name testkit-e2e-"+hash+"-"))
+}
+
+func TestKindProvider_NoClusterConfig(t *testing.T) {
+	// The fake kind lists a cluster created without a configuration,
+	// along with the clusters of custom shapes created with and without an ID.
+	commands := fakeCommand(t, "kind", `
+case "$1" in
+get) printf 'testkit-e2e-0123abcd-wxyz\ntestkit-0123abcd-wxyz\ntestkit-e2e-abcd\n';;
+esac`)
+
+	kind := &KindProvider{}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	_, hash, err := kind.clusterConfig(kind.Image)
+	require.NoError(t, err)
+	require.Empty(t, hash)
+
+	// The name of the cluster created without a configuration includes no hash,
+	// so the existing cluster is reused, but not the one of a custom shape.
+	kc, err := kind.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "e2e" })
+	require.NoError(t, err)
+	require.Equal(t, "testkit-e2e-abcd", kc.Name)
+	require.Zero(t, countPrefixed(commands(), "create cluster"))
+
+	// The request without an ID gets neither the cluster of a custom shape, nor the cluster of another ID.
+	kc, err = kind.GetKubernetesCluster()
+	require.NoError(t, err)
+	require.Regexp(t, `^testkit-[a-z0-9]{4}$`, kc.Name)
+	require.Equal(t, 1, countPrefixed(commands(), "create cluster --name "+kc.Name))
+}
+
+func TestMatchClusterName(t *testing.T) {
+	require.True(t, matchClusterName("testkit-abcd", "", ""))
+	require.True(t, matchClusterName("testkit-e2e-abcd", "e2e", ""))
+	require.True(t, matchClusterName("testkit-e2e-0123abcd-wxyz", "e2e", "0123abcd"))
+	require.True(t, matchClusterName("testkit-0123abcd-wxyz", "", "0123abcd"))
+
+	require.False(t, matchClusterName("testkit-0123abcd-wxyz", "", ""))
+	require.False(t, matchClusterName("testkit-e2e-0123abcd-wxyz", "e2e", ""))
+	require.False(t, matchClusterName("testkit-e2e-abcd", "", ""))
+	require.False(t, matchClusterName("testkit-e2e-abcd", "e2", ""))
+	require.False(t, matchClusterName("testkit-e2e-0123abcd-wxyz", "e2e", "ffffffff"))
+	require.False(t, matchClusterName("kind", "", ""))
+}
@@ -0,0 +1,81 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// LoadImages loads the local docker images into the kind cluster via kind load docker-image,
+// so that the pods in the cluster can run them without pulling them from a registry.
+// The cluster must be the one obtained from the provider.
+//
+// The provider tracks the images loaded into each cluster by their image IDs,
+// so loading an image that has not changed since it was loaded into the cluster is skipped.
+// This makes it cheap to call LoadImages in every test that shares the cluster.
+//
+//	cluster := tk.KubernetesCluster(t)
+//	testkit.DockerBuild(t, "example.com/controller:test", "..")
+//	kind.LoadImages(t, cluster, "example.com/controller:test")
+//	tk.Helm(cluster.KubeconfigPath).UpgradeOrInstall(t, "controller", "../charts/controller")
+func (p *KindProvider) LoadImages(t *testing.T, cluster *KubernetesCluster, images ...string) {
+	t.Helper()
+
+	ctx, cancel := testContext(t)
+	defer cancel()
+
+	require.NoError(t, p.loadImages(ctx, cluster, images...))
+}
+
+func (p *KindProvider) loadImages(ctx context.Context, cluster *KubernetesCluster, images ...string) error {
+	if cluster == nil || cluster.Name == "" {
+		return fmt.Errorf("unable to load images: the cluster has no name. Pass the cluster obtained from KindProvider")
+	}
+
+	for _, image := range images {
+		id, err := dockerImageID(ctx, image)
+		if err != nil {
+			return fmt.Errorf("unable to get ID of image %s: %v", image, err)
+		}
+
+		// Concurrent requests for the same image wait for the first one to load it.
+		_, err, _ = p.flights.Do(flightKey("image", cluster.Name, image, id), func() (any, error) {
+			return nil, p.loadImage(ctx, cluster.Name, image, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadImage loads the image into the cluster unless the image with the same ID has already been loaded.
+func (p *KindProvider) loadImage(ctx context.Context, clusterName, image, id string) error {
+	p.mu.Lock()
+	loaded := p.loadedImages[clusterName][image] == id
+	p.mu.Unlock()
+
+	if loaded {
+		p.Debugf("Skipped loading image %s (%s) into cluster %s, as it's already loaded", image, id, clusterName)
+		return nil
+	}
+
+	out, err := p.capture(ctx, p.clusterKubeconfigPath(clusterName), "load", "docker-image", image, "--name", clusterName)
+	if err != nil {
+		return fmt.Errorf("unable to load image %s into cluster %s: %v: %s", image, clusterName, err, out)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.loadedImages[clusterName] == nil {
+		p.loadedImages[clusterName] = make(map[string]string)
+	}
+
+	p.loadedImages[clusterName][image] = id
+
+	return nil
+}
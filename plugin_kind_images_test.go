@@ -0,0 +1,46 @@
+package testkit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindProvider_LoadImages(t *testing.T) {
+	// The fake docker returns the image ID stored in a file, so that the test can "rebuild" the image.
+	imageID := filepath.Join(t.TempDir(), "id")
+	require.NoError(t, os.WriteFile(imageID, []byte("sha256:1111\n"), 0644))
+
+	dockerCommands := fakeCommand(t, "docker", `case "$1" in image) cat `+imageID+`;; esac`)
+	kindCommands := fakeCommand(t, "kind", "")
+
+	kind := &KindProvider{}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster := tk.KubernetesCluster(t)
+	require.NotEmpty(t, cluster.Name)
+
+	DockerBuild(t, "example.com/app:test", "testdata/app", func(c *DockerBuildConfig) {
+		c.BuildArgs = map[string]string{"VERSION": "1.0", "GOOS": "linux"}
+	})
+	require.Equal(t, "build --tag example.com/app:test --build-arg GOOS=linux --build-arg VERSION=1.0 testdata/app", dockerCommands()[0])
+
+	kind.LoadImages(t, cluster, "example.com/app:test")
+	kind.LoadImages(t, cluster, "example.com/app:test")
+
+	load := "load docker-image example.com/app:test --name " + cluster.Name
+	require.Equal(t, 1, countPrefixed(kindCommands(), load))
+
+	// A rebuilt image is loaded again.
+	require.NoError(t, os.WriteFile(imageID, []byte("sha256:2222\n"), 0644))
+	kind.LoadImages(t, cluster, "example.com/app:test")
+	require.Equal(t, 2, countPrefixed(kindCommands(), load))
+
+	require.ErrorContains(t, kind.loadImages(context.Background(), &KubernetesCluster{KubeconfigPath: "kubeconfig"}, "example.com/app:test"), "the cluster has no name")
+}
@@ -0,0 +1,207 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KindLocalRegistry makes KindProvider run a local registry for each cluster,
+// so that the images pushed to the registry from the host can be pulled by the cluster
+// without loading them one by one.
+//
+// The registry runs as a docker container attached to the kind network,
+// and containerd on every node of the cluster is configured to pull the images
+// referenced as <KubernetesCluster.Registry>/<repository> from it.
+// The local-registry-hosting ConfigMap in kube-public advertises the registry to the tools
+// that support KEP-1755, like Tilt and Skaffold.
+//
+// The registry is removed along with the cluster.
+//
+//	kind := &testkit.KindProvider{LocalRegistry: &testkit.KindLocalRegistry{}}
+//	...
+//	cluster := tk.KubernetesCluster(t)
+//	image := cluster.Registry + "/controller:test"
+//	// docker build -t $image . && docker push $image
+type KindLocalRegistry struct {
+	// Image is the image of the registry.
+	// Defaults to registry:2.
+	Image string `yaml:"image"`
+}
+
+const (
+	defaultKindRegistryImage = "registry:2"
+
+	// kindRegistryPort is the port the registry listens on within the kind network.
+	kindRegistryPort = "5000"
+
+	// kindNetwork is the docker network kind creates the nodes in.
+	kindNetwork = "kind"
+
+	// containerdRegistryConfigPatch makes containerd read the registry hosts from /etc/containerd/certs.d,
+	// where the provider writes the hosts.toml of the local registry.
+	containerdRegistryConfigPatch = `[plugins."io.containerd.grpc.v1.cri".registry]
+  config_path = "/etc/containerd/certs.d"
+`
+)
+
+func kindRegistryName(clusterName string) string {
+	return clusterName + "-registry"
+}
+
+// localRegistry returns the endpoint of the local registry of the cluster,
+// starting and wiring it into the cluster if it's not running yet.
+// The registry of a cluster created or reattached by the provider is removed along with the cluster.
+//
+// A registry is never started for a cluster the provider does not own, like an existing cluster it adopted,
+// as nothing would remove the registry.
+func (p *KindProvider) localRegistry(ctx context.Context, clusterName string) (string, error) {
+	p.mu.Lock()
+	endpoint, ok := p.registries[clusterName]
+	_, owned := p.clusterNames[clusterName]
+	p.mu.Unlock()
+
+	if ok {
+		return endpoint, nil
+	}
+
+	endpoint, err := p.localRegistryEndpoint(ctx, clusterName)
+	if err != nil {
+		if !owned {
+			return "", fmt.Errorf("local registry %s of cluster %s is not running, and it is not started for a cluster not created by testkit: %v. Start the registry, or let testkit create the cluster", kindRegistryName(clusterName), clusterName, err)
+		}
+
+		// The registry is not running yet.
+		endpoint, err = p.startLocalRegistry(ctx, clusterName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if owned {
+		p.mu.Lock()
+		p.registries[clusterName] = endpoint
+		p.mu.Unlock()
+	}
+
+	return endpoint, nil
+}
+
+func (p *KindProvider) startLocalRegistry(ctx context.Context, clusterName string) (_ string, err error) {
+	name := kindRegistryName(clusterName)
+
+	image := p.LocalRegistry.Image
+	if image == "" {
+		image = defaultKindRegistryImage
+	}
+
+	// Let docker choose the host port, so that the registries of parallel clusters do not conflict.
+	if _, err := docker(ctx, "run", "--detach", "--publish", "127.0.0.1::"+kindRegistryPort, "--name", name, image); err != nil {
+		return "", fmt.Errorf("unable to start local registry %s: %v", name, err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rmErr := p.stopLocalRegistry(context.Background(), clusterName); rmErr != nil {
+				p.Debugf("%v", rmErr)
+			}
+		}
+	}()
+
+	if _, err := docker(ctx, "network", "connect", kindNetwork, name); err != nil {
+		return "", fmt.Errorf("unable to connect local registry %s to network %s: %v", name, kindNetwork, err)
+	}
+
+	endpoint, err := p.localRegistryEndpoint(ctx, clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	kubeconfigPath := p.clusterKubeconfigPath(clusterName)
+
+	nodes, err := p.capture(ctx, kubeconfigPath, "get", "nodes", "--name", clusterName)
+	if err != nil {
+		return "", fmt.Errorf("unable to get nodes of cluster %s: %v: %s", clusterName, err, nodes)
+	}
+
+	// Map the endpoint seen from the host to the registry container seen from the nodes.
+	hostsDir := "/etc/containerd/certs.d/" + endpoint
+	script := fmt.Sprintf(`mkdir -p %s && printf '[host."http://%s:%s"]\n' > %s/hosts.toml`, hostsDir, name, kindRegistryPort, hostsDir)
+
+	for _, node := range strings.Fields(nodes) {
+		if _, err := docker(ctx, "exec", node, "sh", "-c", script); err != nil {
+			return "", fmt.Errorf("unable to configure node %s to use local registry: %v", node, err)
+		}
+	}
+
+	if err := applyLocalRegistryHosting(ctx, kubeconfigPath, endpoint); err != nil {
+		return "", err
+	}
+
+	p.Debugf("Started local registry %s at %s for cluster %s", name, endpoint, clusterName)
+
+	return endpoint, nil
+}
+
+// localRegistryEndpoint returns the endpoint of the running local registry of the cluster seen from the host.
+func (p *KindProvider) localRegistryEndpoint(ctx context.Context, clusterName string) (string, error) {
+	name := kindRegistryName(clusterName)
+
+	out, err := docker(ctx, "port", name, kindRegistryPort)
+	if err != nil {
+		return "", fmt.Errorf("unable to get port of local registry %s: %v", name, err)
+	}
+
+	// The output is like "127.0.0.1:49153".
+	lines := strings.Fields(out)
+	if len(lines) == 0 {
+		return "", fmt.Errorf("local registry %s does not publish port %s", name, kindRegistryPort)
+	}
+
+	i := strings.LastIndex(lines[0], ":")
+
+	return "localhost" + lines[0][i:], nil
+}
+
+func (p *KindProvider) stopLocalRegistry(ctx context.Context, clusterName string) error {
+	name := kindRegistryName(clusterName)
+
+	if _, err := docker(ctx, "rm", "--force", name); err != nil {
+		return fmt.Errorf("unable to remove local registry %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// applyLocalRegistryHosting documents the local registry in the cluster as described in KEP-1755.
+func applyLocalRegistryHosting(ctx context.Context, kubeconfigPath, endpoint string) error {
+	f, err := os.CreateTemp("", "testkit-local-registry-hosting-*.yaml")
+	if err != nil {
+		return fmt.Errorf("unable to create local-registry-hosting manifest: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = fmt.Fprintf(f, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "%s"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+`, endpoint)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write local-registry-hosting manifest: %v", err)
+	}
+
+	if _, err := NewKubectl(kubeconfigPath).captureContext(ctx, "apply", "-f", f.Name()); err != nil {
+		return fmt.Errorf("unable to apply local-registry-hosting ConfigMap: %v", err)
+	}
+
+	return nil
+}
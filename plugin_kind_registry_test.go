@@ -0,0 +1,79 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindProvider_LocalRegistry(t *testing.T) {
+	// The fake docker publishes the registry once it's run, and forgets it once it's removed.
+	running := filepath.Join(t.TempDir(), "running")
+
+	dockerCommands := fakeCommand(t, "docker", `
+case "$1" in
+run) touch `+running+`;;
+rm) rm -f `+running+`;;
+port) [ -f `+running+` ] && echo 127.0.0.1:49153 || exit 1;;
+esac`)
+	kindCommands := fakeCommand(t, "kind", `if [ "$1 $2" = "get nodes" ]; then printf 'n1-control-plane\nn1-worker\n'; fi`)
+	kubectlCommands := fakeCommand(t, "kubectl", "")
+
+	kind := &KindProvider{LocalRegistry: &KindLocalRegistry{}}
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster := tk.KubernetesCluster(t)
+	require.Equal(t, "localhost:49153", cluster.Registry)
+
+	registry := cluster.Name + "-registry"
+
+	require.Equal(t, []string{
+		"port " + registry + " 5000",
+		"run --detach --publish 127.0.0.1::5000 --name " + registry + " registry:2",
+		"network connect kind " + registry,
+		"port " + registry + " 5000",
+		"exec n1-control-plane sh -c mkdir -p /etc/containerd/certs.d/localhost:49153 && printf '[host.\"http://" + registry + ":5000\"]\\n' > /etc/containerd/certs.d/localhost:49153/hosts.toml",
+		"exec n1-worker sh -c mkdir -p /etc/containerd/certs.d/localhost:49153 && printf '[host.\"http://" + registry + ":5000\"]\\n' > /etc/containerd/certs.d/localhost:49153/hosts.toml",
+	}, dockerCommands())
+
+	createCluster := kindCommands()[1]
+	require.True(t, strings.HasPrefix(createCluster, "create cluster --name "+cluster.Name+" --config "), createCluster)
+	require.Equal(t, 1, countPrefixed(kubectlCommands(), "apply -f "))
+
+	// The cluster is reused along with its registry.
+	require.Equal(t, cluster.Registry, tk.KubernetesCluster(t).Registry)
+	require.Equal(t, 1, countPrefixed(dockerCommands(), "run "))
+
+	require.Empty(t, tk.DoCleanup())
+	require.Equal(t, "rm --force "+registry, dockerCommands()[len(dockerCommands())-1])
+
+	_, err = os.Stat(running)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestKindProvider_LocalRegistry_AdoptedCluster(t *testing.T) {
+	kind := &KindProvider{LocalRegistry: &KindLocalRegistry{}}
+
+	_, configHash, err := kind.clusterConfig("")
+	require.NoError(t, err)
+	clusterName := "testkit-" + configHash + "-abcd"
+
+	dockerCommands := fakeCommand(t, "docker", `if [ "$1" = port ]; then exit 1; fi`)
+	fakeCommand(t, "kind", `if [ "$1 $2" = "get clusters" ]; then echo `+clusterName+`; fi`)
+	fakeCommand(t, "kubectl", "")
+
+	tk, err := Build(Providers(kind), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	// No registry is started for the cluster testkit did not create, as nothing would remove it.
+	_, err = kind.GetKubernetesCluster()
+	require.ErrorContains(t, err, "local registry "+clusterName+"-registry of cluster "+clusterName+" is not running")
+	require.Zero(t, countPrefixed(dockerCommands(), "run "))
+}
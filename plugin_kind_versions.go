@@ -0,0 +1,62 @@
+package testkit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultKindNodeImages maps the Kubernetes minor versions to the node images built for kind v0.23.0.
+// See https://github.com/kubernetes-sigs/kind/releases/tag/v0.23.0.
+var defaultKindNodeImages = map[string]string{
+	"v1.30": "kindest/node:v1.30.0",
+	"v1.29": "kindest/node:v1.29.4",
+	"v1.28": "kindest/node:v1.28.9",
+	"v1.27": "kindest/node:v1.27.13",
+	"v1.26": "kindest/node:v1.26.15",
+	"v1.25": "kindest/node:v1.25.16",
+}
+
+// nodeImage returns the node image to boot the cluster of the Kubernetes version with.
+// It returns Image when the version is not specified.
+func (p *KindProvider) nodeImage(version string) (string, error) {
+	if version == "" {
+		return p.Image, nil
+	}
+
+	if p.ClusterConfig != nil {
+		for _, n := range p.ClusterConfig.Nodes {
+			if n.Image != "" {
+				return "", fmt.Errorf("unable to create cluster of Kubernetes version %s: the node image is set in ClusterConfig", version)
+			}
+		}
+	}
+
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	if image, ok := p.NodeImages[version]; ok {
+		return image, nil
+	}
+
+	if image, ok := defaultKindNodeImages[version]; ok {
+		return image, nil
+	}
+
+	// Patch versions like v1.29.4 are the tags of the node images.
+	if strings.Count(version, ".") == 2 {
+		return "kindest/node:" + version, nil
+	}
+
+	var versions []string
+	for v := range defaultKindNodeImages {
+		versions = append(versions, v)
+	}
+	for v := range p.NodeImages {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	return "", fmt.Errorf("unable to find node image for Kubernetes version %s. Use one of %s, a patch version like %s.0, or add it to NodeImages", version, strings.Join(versions, ", "), version)
+}
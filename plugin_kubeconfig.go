@@ -0,0 +1,228 @@
+package testkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"golang.org/x/sync/singleflight"
+)
+
+// KubeconfigProvider provides the clusters of the contexts in an existing kubeconfig,
+// so that the tests can run against whatever cluster the developer already has.
+//
+// The ID of the requested cluster is mapped to a context via Contexts.
+// For each cluster, a minified kubeconfig that contains only the context is written,
+// so that the tests and the tools run by them cannot touch the other clusters.
+//
+// The clusters are checked to be reachable before being returned,
+// and are never deleted, as they are not created by the provider.
+//
+//	tk := testkit.New(t, testkit.Providers(&testkit.KubeconfigProvider{
+//		Contexts: map[string]string{"": "kind-dev", "staging": "arn:aws:eks:us-east-1:123456789012:cluster/staging"},
+//	}))
+type KubeconfigProvider struct {
+	// Path is the path to the kubeconfig.
+	// Defaults to KUBECONFIG, and then to the default of kubectl.
+	Path string `yaml:"kubeconfig"`
+
+	// Contexts maps the IDs of the clusters to the names of the contexts.
+	// An ID missing in Contexts is used as the name of the context as is,
+	// and the cluster requested without an ID defaults to the current context.
+	Contexts map[string]string `yaml:"contexts"`
+
+	// RequestTimeout bounds the request checking that the cluster is reachable.
+	// Defaults to 10 seconds.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+
+	// kubeconfigDir is the directory where the minified kubeconfig files are stored.
+	kubeconfigDir string
+
+	// mu guards clusters, so that the provider can be used by parallel tests.
+	mu sync.Mutex
+	// clusters maps the context names to the reachable clusters.
+	clusters map[string]*KubernetesCluster
+	// flights deduplicates concurrent requests for the same cluster.
+	flights singleflight.Group
+
+	providerContext
+}
+
+var _ Provider = &KubeconfigProvider{}
+var _ ContextProvider = &KubeconfigProvider{}
+var _ KubernetesClusterProvider = &KubeconfigProvider{}
+
+const defaultKubeconfigRequestTimeout = 10 * time.Second
+
+func (p *KubeconfigProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *KubeconfigProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
+	dir, err := os.MkdirTemp("", "testkit_kubeconfigs_*")
+	if err != nil {
+		return fmt.Errorf("unable to create kubeconfig directory: %v", err)
+	}
+
+	p.kubeconfigDir = dir
+	p.clusters = make(map[string]*KubernetesCluster)
+
+	return nil
+}
+
+func (p *KubeconfigProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+// CleanupContext removes the minified kubeconfig files.
+// The clusters are left as is.
+func (p *KubeconfigProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clusters = make(map[string]*KubernetesCluster)
+
+	if err := os.RemoveAll(p.kubeconfigDir); err != nil {
+		return fmt.Errorf("unable to remove kubeconfig directory: %v", err)
+	}
+
+	return nil
+}
+
+func (p *KubeconfigProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*KubernetesCluster, error) {
+	var conf KubernetesClusterConfig
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if conf.Version != "" {
+		return nil, fmt.Errorf("unable to provide Kubernetes cluster of version %s: the version of the cluster is managed outside of testkit", conf.Version)
+	}
+
+	contextName, ok := p.Contexts[conf.ID]
+	if !ok {
+		contextName = conf.ID
+	}
+
+	// Concurrent requests for the same cluster wait for the first one to check it.
+	v, err, _ := p.flights.Do(flightKey("cluster", contextName), func() (any, error) {
+		p.mu.Lock()
+		kc, ok := p.clusters[contextName]
+		p.mu.Unlock()
+
+		if ok {
+			return kc, nil
+		}
+
+		kc, err := p.getKubernetesCluster(p.context(), contextName)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		p.clusters[contextName] = kc
+		p.mu.Unlock()
+
+		return kc, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	kc := *v.(*KubernetesCluster)
+
+	return &kc, nil
+}
+
+// getKubernetesCluster writes the minified kubeconfig of the context, and checks that the cluster is reachable.
+// The current context is used when contextName is empty.
+func (p *KubeconfigProvider) getKubernetesCluster(ctx context.Context, contextName string) (*KubernetesCluster, error) {
+	path := p.Path
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+
+	args := []string{"config", "view", "--minify", "--flatten"}
+	if contextName != "" {
+		args = append(args, "--context", contextName)
+	}
+
+	contextDesc := "the current context"
+	if contextName != "" {
+		contextDesc = fmt.Sprintf("context %q", contextName)
+	}
+
+	kubeconfigDesc := path
+	if kubeconfigDesc == "" {
+		kubeconfigDesc = "the default kubeconfig"
+	}
+
+	kubeconfig, err := NewKubectl(path).captureContext(ctx, args...)
+	if err != nil {
+		return nil, testkiterror.New(
+			fmt.Sprintf("unable to read %s from %s", contextDesc, kubeconfigDesc),
+			testkiterror.Cause(err),
+			testkiterror.Long(strings.TrimSpace(kubeconfig)),
+			testkiterror.Remediation("Run kubectl config get-contexts to list the available contexts, "+
+				"and map the ID of the cluster to one of them via KubeconfigProvider.Contexts, "+
+				"or set KubeconfigProvider.Path or KUBECONFIG to the kubeconfig containing the context."),
+		)
+	}
+
+	kubeconfigPath := filepath.Join(p.kubeconfigDir, kubeconfigFileName(contextName))
+
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfig), 0600); err != nil {
+		return nil, fmt.Errorf("unable to write kubeconfig of %s: %v", contextDesc, err)
+	}
+
+	timeout := p.RequestTimeout
+	if timeout == 0 {
+		timeout = defaultKubeconfigRequestTimeout
+	}
+
+	out, err := NewKubectl(kubeconfigPath).captureContext(ctx, "get", "--raw", "/version", "--request-timeout", timeout.String())
+	if err != nil {
+		return nil, testkiterror.New(
+			fmt.Sprintf("cluster of %s in %s is not reachable", contextDesc, kubeconfigDesc),
+			testkiterror.Cause(err),
+			testkiterror.Long(strings.TrimSpace(out)),
+			testkiterror.Remediation(fmt.Sprintf("Check that the cluster is running and that the credentials are valid via KUBECONFIG=%s kubectl get --raw /version. "+
+				"You may need to connect to the VPN, renew the credentials, or start the cluster.", kubeconfigPath)),
+		)
+	}
+
+	return &KubernetesCluster{
+		KubeconfigPath: kubeconfigPath,
+	}, nil
+}
+
+// kubeconfigFileName returns the name of the file of the minified kubeconfig of the context.
+// The name contains a short hash of the context name, so that the contexts whose names differ
+// only in the characters unsafe for file names, like a:b and a_b, do not share the file.
+func kubeconfigFileName(contextName string) string {
+	name := contextName
+	if name == "" {
+		name = "current-context"
+	}
+
+	h := sha256.Sum256([]byte(contextName))
+
+	return unsafeFileNameChars.ReplaceAllString(name, "_") + "-" + hex.EncodeToString(h[:4]) + ".kubeconfig"
+}
+
+// unsafeFileNameChars matches the characters of the context names that cannot be used in file names,
+// like the ones in the ARNs of EKS clusters.
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
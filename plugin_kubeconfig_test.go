@@ -0,0 +1,66 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubeconfigProvider(t *testing.T) {
+	// The fake kubectl knows the contexts dev and offline, and the cluster of offline is not reachable.
+	commands := fakeCommand(t, "kubectl", `
+case "$*" in
+"config view --minify --flatten"|"config view --minify --flatten --context dev") echo "current-context: dev";;
+"config view --minify --flatten --context offline") echo "current-context: offline";;
+"config view "*) echo "error: context was not found for specified context: $6" >&2; exit 1;;
+"get --raw /version "*) grep -q offline "$KUBECONFIG" && { echo "Unable to connect to the server: dial tcp: i/o timeout" >&2; exit 1; } || echo '{"gitVersion":"v1.29.2"}';;
+esac`)
+
+	kubeconfig := &KubeconfigProvider{
+		Path:     "kubeconfig",
+		Contexts: map[string]string{"": "dev", "unreachable": "offline"},
+	}
+
+	tk, err := Build(Providers(kubeconfig), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	cluster := tk.KubernetesCluster(t)
+	require.Equal(t, kubeconfigFileName("dev"), filepath.Base(cluster.KubeconfigPath))
+	require.True(t, strings.HasPrefix(filepath.Base(cluster.KubeconfigPath), "dev-"), cluster.KubeconfigPath)
+
+	data, err := os.ReadFile(cluster.KubeconfigPath)
+	require.NoError(t, err)
+	require.Equal(t, "current-context: dev\n", string(data))
+
+	// The ID is used as the name of the context unless mapped, and the reachable cluster is memoized.
+	require.Equal(t, cluster.KubeconfigPath, tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "dev" }).KubeconfigPath)
+	require.Equal(t, 1, countPrefixed(commands(), "get --raw /version"))
+
+	_, err = kubeconfig.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "missing" })
+	require.EqualError(t, err, `unable to read context "missing" from kubeconfig`)
+
+	_, _, err = resolve(tk, "Kubernetes cluster", func(p KubernetesClusterProvider) (*KubernetesCluster, error) {
+		return p.GetKubernetesCluster(func(c *KubernetesClusterConfig) { c.ID = "unreachable" })
+	})
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.String(), `*testkit.KubeconfigProvider: cluster of context "offline" in kubeconfig is not reachable`)
+	require.Contains(t, e.String(), "Unable to connect to the server: dial tcp: i/o timeout")
+	require.Contains(t, e.String(), "Check that the cluster is running")
+
+	require.Empty(t, tk.DoCleanup())
+	require.NoFileExists(t, cluster.KubeconfigPath)
+}
+
+func TestKubeconfigFileName(t *testing.T) {
+	// Context names that differ only in the characters unsafe for file names get different files.
+	require.NotEqual(t, kubeconfigFileName("a:b"), kubeconfigFileName("a_b"))
+	require.NotEqual(t, kubeconfigFileName(""), kubeconfigFileName("current-context"))
+	require.Regexp(t, `^arn_aws_eks_us-east-1_123456789012_cluster_e2e-[0-9a-f]{8}\.kubeconfig$`, kubeconfigFileName("arn:aws:eks:us-east-1:123456789012:cluster/e2e"))
+}
@@ -1,42 +1,90 @@
 package testkit
 
 import (
+	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
 )
 
 type KubectlProvider struct {
 	// DefaultKubeconfigPath is the path to the kubeconfig file.
-	DefaultKubeconfigPath string
-
+	DefaultKubeconfigPath string `yaml:"kubeconfig"`
+
+	// Cluster is the provider of the Kubernetes cluster to use
+	// when DefaultKubeconfigPath is empty.
+	// If Cluster is also a Provider, KubectlProvider depends on it,
+	// so that the harness sets up Cluster before KubectlProvider.
+	//
+	// For example, the following makes KubectlProvider create namespaces
+	// in the cluster created by KindProvider:
+	//
+	//	kind := &testkit.KindProvider{}
+	//	tk := testkit.New(t, testkit.Providers(kind, &testkit.KubectlProvider{Cluster: kind}))
+	//
+	// In the harness configuration file, this is set via the cluster field
+	// that refers to the name of the provider of the cluster.
+	Cluster KubernetesClusterProvider `yaml:"-"`
+
+	// mu guards kubeconfigToResources, so that the provider can be used by parallel tests.
+	mu                    sync.Mutex
 	kubeconfigToResources map[string]*kubectlResources
+	// flights deduplicates concurrent requests for the same resource.
+	flights singleflight.Group
+
+	journaling
+	providerContext
 }
 
+// kubectlResources maps the names of the resources to the scopes they were created in.
 type kubectlResources struct {
-	configmaps map[string]map[string]struct{}
-	namespaces map[string]struct{}
+	configmaps map[string]map[string]string
+	namespaces map[string]string
+	// objects are the objects applied via KubernetesManifest, in the order they were first applied,
+	// so that they can be deleted in reverse order.
+	objects []KubernetesObjectRef
 }
 
-func (p *kubectlResources) addConfigMap(ns, name string) {
+func (p *kubectlResources) addConfigMap(ns, name, scope string) {
 	if p.configmaps == nil {
-		p.configmaps = make(map[string]map[string]struct{})
+		p.configmaps = make(map[string]map[string]string)
 	}
 
 	if p.configmaps[ns] == nil {
-		p.configmaps[ns] = make(map[string]struct{})
+		p.configmaps[ns] = make(map[string]string)
 	}
 
-	p.configmaps[ns][name] = struct{}{}
+	p.configmaps[ns][name] = scope
 }
 
-func (p *kubectlResources) addNamespace(name string) {
+func (p *kubectlResources) addNamespace(name, scope string) {
 	if p.namespaces == nil {
-		p.namespaces = make(map[string]struct{})
+		p.namespaces = make(map[string]string)
+	}
+
+	p.namespaces[name] = scope
+}
+
+// addObject tracks the applied object, unless it's already tracked.
+func (p *kubectlResources) addObject(ref KubernetesObjectRef) {
+	if !p.hasObject(ref) {
+		p.objects = append(p.objects, ref)
 	}
+}
+
+func (p *kubectlResources) hasObject(ref KubernetesObjectRef) bool {
+	return slices.Contains(p.objects, ref)
+}
 
-	p.namespaces[name] = struct{}{}
+func (p *kubectlResources) removeObject(ref KubernetesObjectRef) {
+	p.objects = slices.DeleteFunc(p.objects, func(o KubernetesObjectRef) bool { return o == ref })
 }
 
 func (p *kubectlResources) getNamespaces() []string {
@@ -49,9 +97,38 @@ func (p *kubectlResources) getNamespaces() []string {
 }
 
 var _ Provider = &KubectlProvider{}
+var _ ContextProvider = &KubectlProvider{}
+var _ DependentProvider = &KubectlProvider{}
 var _ KubernetesNamespaceProvider = &KubectlProvider{}
+var _ KubernetesManifestProvider = &KubectlProvider{}
+var _ ResourceDeleter = &KubectlProvider{}
+var _ ArtifactCollector = &KubectlProvider{}
+var _ scopedProvider = &KubectlProvider{}
+
+func (p *KubectlProvider) DependsOn() []Provider {
+	if cp, ok := p.Cluster.(Provider); ok {
+		return []Provider{cp}
+	}
+
+	return nil
+}
 
 func (p *KubectlProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *KubectlProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
+	if p.DefaultKubeconfigPath == "" && p.Cluster != nil {
+		kc, err := p.Cluster.GetKubernetesCluster()
+		if err != nil {
+			return fmt.Errorf("unable to get kubernetes cluster: %v", err)
+		}
+
+		p.DefaultKubeconfigPath = kc.KubeconfigPath
+	}
+
 	if p.DefaultKubeconfigPath != "" {
 		_, err := os.Stat(p.DefaultKubeconfigPath)
 		if err != nil {
@@ -65,29 +142,120 @@ func (p *KubectlProvider) Setup() error {
 }
 
 func (p *KubectlProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *KubectlProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	for kubeconfigPath, resources := range p.kubeconfigToResources {
 		kubectl := NewKubectl(kubeconfigPath)
 
+		// The objects are deleted in reverse order, so that the ones depending on the others,
+		// like the custom resources of a CRD, are deleted first.
+		for i := len(resources.objects) - 1; i >= 0; i-- {
+			if err := deleteKubernetesObject(ctx, kubectl, resources.objects[i]); err != nil {
+				return fmt.Errorf("unable to delete %s in %s: %v", resources.objects[i], kubeconfigPath, err)
+			}
+
+			resources.objects = resources.objects[:i]
+		}
+
 		for ns, cms := range resources.configmaps {
 			for cm := range cms {
-				_, err := kubectl.capture("delete", "configmap", cm, "--namespace", ns)
+				_, err := kubectl.captureContext(ctx, "delete", "configmap", cm, "--namespace", ns)
 				if err != nil {
 					return fmt.Errorf("unable to delete configmap %s/%s: %v", kubeconfigPath, cm, err)
 				}
+
+				if err := p.journal.Remove("kubectl", "configmap", cm); err != nil {
+					return err
+				}
 			}
 		}
 
 		for _, ns := range resources.getNamespaces() {
-			_, err := kubectl.capture("delete", "namespace", ns)
+			_, err := kubectl.captureContext(ctx, append([]string{"delete", "namespace", ns}, namespaceDeleteFlags...)...)
 			if err != nil {
 				return fmt.Errorf("unable to delete namespace %s/%s: %v", kubeconfigPath, ns, err)
 			}
+
+			if err := p.journal.Remove("kubectl", "namespace", ns); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// CollectArtifacts writes the events, the descriptions of the resources, and the logs of the pods
+// in the namespaces created by the provider into dir/kubectl/<namespace>.
+func (p *KubectlProvider) CollectArtifacts(ctx context.Context, dir string) error {
+	return p.collectArtifacts(ctx, dir, func(string) bool { return true })
+}
+
+// CollectArtifacts collects the artifacts of the namespaces created in the scope only.
+func (p *scopedKubectlProvider) CollectArtifacts(ctx context.Context, dir string) error {
+	return p.KubectlProvider.collectArtifacts(ctx, dir, func(scope string) bool { return scope == p.scope })
+}
+
+func (p *KubectlProvider) collectArtifacts(ctx context.Context, dir string, inScope func(scope string) bool) error {
+	p.mu.Lock()
+	namespaces := map[string][]string{}
+	for kubeconfigPath, resources := range p.kubeconfigToResources {
+		for ns, scope := range resources.namespaces {
+			if inScope(scope) {
+				namespaces[kubeconfigPath] = append(namespaces[kubeconfigPath], ns)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	var errs []error
+
+	capture := func(kubectl *Kubectl, name string, args ...string) string {
+		out, err := kubectl.captureContext(ctx, args...)
+		if err != nil {
+			errs = append(errs, err)
+			return ""
+		}
+
+		if name != "" {
+			if err := writeArtifact(dir, name, []byte(out)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return out
+	}
+
+	for kubeconfigPath, nss := range namespaces {
+		kubectl := NewKubectl(kubeconfigPath)
+
+		for _, ns := range nss {
+			base := filepath.Join("kubectl", ns)
+
+			capture(kubectl, filepath.Join(base, "events.txt"), "get", "events", "--namespace", ns, "--sort-by", ".lastTimestamp")
+			capture(kubectl, filepath.Join(base, "describe.txt"), "describe", "all", "--namespace", ns)
+
+			pods := capture(kubectl, "", "get", "pods", "--namespace", ns, "-o", "name")
+			for _, pod := range strings.Fields(pods) {
+				name := strings.TrimPrefix(pod, "pod/")
+				capture(kubectl, filepath.Join(base, "logs", name+".log"), "logs", pod, "--namespace", ns, "--all-containers", "--prefix")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResourceNamePrefix is the prefix of the names of the resources created by the providers,
+// like kind clusters, Kubernetes namespaces and ConfigMaps.
+// It is used to find the resources left behind by retained or crashed runs.
+const ResourceNamePrefix = "testkit-"
+
 func randString(n int) string {
 	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
 
@@ -114,41 +282,47 @@ func (p *KubectlProvider) KubernetesConfigMap(opts ...KubernetesConfigMapOption)
 		config.KubeconfigPath = p.DefaultKubeconfigPath
 	}
 
-	resources, ok := p.kubeconfigToResources[config.KubeconfigPath]
-	if !ok {
-		resources = &kubectlResources{}
-		p.kubeconfigToResources[config.KubeconfigPath] = resources
+	if config.Namespace == "" {
+		config.Namespace = "default"
 	}
 
-	if resources.configmaps == nil {
-		resources.configmaps = make(map[string]map[string]struct{})
+	// Concurrent requests for the same ConfigMap wait for the first one to create it.
+	key := flightKey("configmap", config.KubeconfigPath, config.Scope, config.Namespace, config.ID)
+	v, err, _ := p.flights.Do(key, func() (any, error) {
+		return p.kubernetesConfigMap(config)
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	cm := *v.(*KubernetesConfigMap)
+
+	return &cm, nil
+}
+
+func (p *KubectlProvider) kubernetesConfigMap(config *KubernetesConfigMapConfig) (*KubernetesConfigMap, error) {
 	nsName := config.Namespace
-	if nsName == "" {
-		nsName = "default"
-	}
 
 	// cmName can be empty, in which case we'll use the first namespace, if any.
 	// If there are no namespaces, we'll create one.
-	cmName := "testkit-"
+	cmName := ResourceNamePrefix
 	if config.ID != "" {
 		cmName += config.ID + "-"
 	}
 
-	cms := resources.configmaps[nsName]
-	if cms == nil {
-		cms = make(map[string]struct{})
-		resources.configmaps[nsName] = cms
-	}
+	p.mu.Lock()
+	resources := p.resourcesFor(config.KubeconfigPath)
 
 	var foundCMName string
-	for cm := range cms {
-		if strings.HasPrefix(cm, cmName) {
+	for cm, scope := range resources.configmaps[nsName] {
+		if strings.HasPrefix(cm, cmName) && scope == config.Scope {
 			foundCMName = cm
 			break
 		}
 	}
+	p.mu.Unlock()
 
 	if foundCMName != "" {
 		return &KubernetesConfigMap{
@@ -161,12 +335,26 @@ func (p *KubectlProvider) KubernetesConfigMap(opts ...KubernetesConfigMapOption)
 
 	kubectl := NewKubectl(config.KubeconfigPath)
 
-	_, err := kubectl.capture("create", "configmap", cmName, "--kubeconfig", config.KubeconfigPath, "--namespace", nsName)
+	_, err := kubectl.captureContext(p.context(), "create", "configmap", cmName, "--kubeconfig", config.KubeconfigPath, "--namespace", nsName)
 	if err != nil {
 		return nil, err
 	}
 
-	resources.addConfigMap(nsName, cmName)
+	p.mu.Lock()
+	resources.addConfigMap(nsName, cmName, config.Scope)
+	p.mu.Unlock()
+
+	if err := p.journal.Record(JournalEntry{
+		Provider:       "kubectl",
+		Kind:           "configmap",
+		ID:             config.ID,
+		Name:           cmName,
+		Namespace:      nsName,
+		KubeconfigPath: config.KubeconfigPath,
+		Attributes:     scopeAttributes(config.Scope),
+	}); err != nil {
+		return nil, err
+	}
 
 	return &KubernetesConfigMap{
 		Namespace: nsName,
@@ -184,26 +372,41 @@ func (p *KubectlProvider) KubernetesNamespace(opts ...KubernetesNamespaceOption)
 		config.KubeconfigPath = p.DefaultKubeconfigPath
 	}
 
-	resources, ok := p.kubeconfigToResources[config.KubeconfigPath]
-	if !ok {
-		resources = &kubectlResources{}
-		p.kubeconfigToResources[config.KubeconfigPath] = resources
+	// Concurrent requests for the same namespace wait for the first one to create it.
+	key := flightKey("namespace", config.KubeconfigPath, config.Scope, config.ID)
+	v, err, _ := p.flights.Do(key, func() (any, error) {
+		return p.kubernetesNamespace(config)
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	ns := *v.(*KubernetesNamespace)
+
+	return &ns, nil
+}
+
+func (p *KubectlProvider) kubernetesNamespace(config *KubernetesNamespaceConfig) (*KubernetesNamespace, error) {
 	// nsName can be empty, in which case we'll use the first namespace, if any.
 	// If there are no namespaces, we'll create one.
-	nsName := "testkit-"
+	nsName := ResourceNamePrefix
 	if config.ID != "" {
 		nsName += config.ID + "-"
 	}
 
+	p.mu.Lock()
+	resources := p.resourcesFor(config.KubeconfigPath)
+
 	var foundNsName string
-	for _, ns := range resources.getNamespaces() {
-		if strings.HasPrefix(ns, nsName) {
+	for ns, scope := range resources.namespaces {
+		if strings.HasPrefix(ns, nsName) && scope == config.Scope {
 			foundNsName = ns
 			break
 		}
 	}
+	p.mu.Unlock()
 
 	if foundNsName != "" {
 		return &KubernetesNamespace{
@@ -211,18 +414,201 @@ func (p *KubectlProvider) KubernetesNamespace(opts ...KubernetesNamespaceOption)
 		}, nil
 	}
 
+	if p.reuse {
+		ns, err := p.reattachKubernetesNamespace(resources, config)
+		if err != nil {
+			return nil, err
+		}
+
+		if ns != nil {
+			return ns, nil
+		}
+	}
+
 	nsName += randString(5)
 
 	kubectl := NewKubectl(config.KubeconfigPath)
 
-	_, err := kubectl.capture("create", "namespace", nsName, "--kubeconfig", config.KubeconfigPath)
+	_, err := kubectl.captureContext(p.context(), "create", "namespace", nsName, "--kubeconfig", config.KubeconfigPath)
 	if err != nil {
 		return nil, err
 	}
 
-	resources.addNamespace(nsName)
+	p.mu.Lock()
+	resources.addNamespace(nsName, config.Scope)
+	p.mu.Unlock()
+
+	if err := p.journal.Record(JournalEntry{
+		Provider:       "kubectl",
+		Kind:           "namespace",
+		ID:             config.ID,
+		Name:           nsName,
+		KubeconfigPath: config.KubeconfigPath,
+		Attributes:     scopeAttributes(config.Scope),
+	}); err != nil {
+		return nil, err
+	}
 
 	return &KubernetesNamespace{
 		Name: nsName,
 	}, nil
 }
+
+// resourcesFor returns the resources created in the cluster of the kubeconfig.
+// The caller must hold p.mu.
+func (p *KubectlProvider) resourcesFor(kubeconfigPath string) *kubectlResources {
+	resources, ok := p.kubeconfigToResources[kubeconfigPath]
+	if !ok {
+		resources = &kubectlResources{}
+		p.kubeconfigToResources[kubeconfigPath] = resources
+	}
+
+	return resources
+}
+
+// reattachKubernetesNamespace returns the namespace recorded in the journal for the ID, if any.
+// A reattached namespace is deleted on Cleanup, as if it was created by this provider.
+func (p *KubectlProvider) reattachKubernetesNamespace(resources *kubectlResources, config *KubernetesNamespaceConfig) (*KubernetesNamespace, error) {
+	entries, err := p.journal.Find("kubectl", "namespace", func(e JournalEntry) bool {
+		return e.ID == config.ID && e.KubeconfigPath == config.KubeconfigPath && e.Attributes["scope"] == config.Scope
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kubectl := NewKubectl(config.KubeconfigPath)
+
+	for _, e := range entries {
+		if _, err := kubectl.captureContext(p.context(), "get", "namespace", e.Name); err != nil {
+			// The namespace has likely been deleted outside of testkit.
+			if err := p.journal.Remove("kubectl", "namespace", e.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		resources.addNamespace(e.Name, config.Scope)
+		p.mu.Unlock()
+
+		return &KubernetesNamespace{
+			Name: e.Name,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// scopeAttributes returns the journal attributes of a resource created in the scope.
+func scopeAttributes(scope string) map[string]string {
+	if scope == "" {
+		return nil
+	}
+
+	return map[string]string{"scope": scope}
+}
+
+// DeleteResource deletes the namespace, the ConfigMap or the objects of the manifest returned by the provider,
+// so that a child harness returned by TestKit.Sub can delete them when the subtest finishes.
+func (p *KubectlProvider) DeleteResource(ctx context.Context, r any) error {
+	var (
+		kind, name, ns string
+		owned          func(*kubectlResources) bool
+		forget         func(*kubectlResources)
+	)
+
+	switch r := r.(type) {
+	case *KubernetesManifest:
+		return p.deleteKubernetesManifest(ctx, r)
+	case *KubernetesNamespace:
+		kind, name = "namespace", r.Name
+		owned = func(resources *kubectlResources) bool {
+			_, ok := resources.namespaces[r.Name]
+			return ok
+		}
+		forget = func(resources *kubectlResources) {
+			delete(resources.namespaces, r.Name)
+		}
+	case *KubernetesConfigMap:
+		kind, name, ns = "configmap", r.Name, r.Namespace
+		owned = func(resources *kubectlResources) bool {
+			_, ok := resources.configmaps[r.Namespace][r.Name]
+			return ok
+		}
+		forget = func(resources *kubectlResources) {
+			delete(resources.configmaps[r.Namespace], r.Name)
+		}
+	default:
+		return nil
+	}
+
+	// The lock is not held while deleting the resource,
+	// so that parallel subtests finishing at the same time do not wait for each other.
+	p.mu.Lock()
+	var (
+		kubeconfigPath string
+		resources      *kubectlResources
+	)
+	for kc, res := range p.kubeconfigToResources {
+		if owned(res) {
+			kubeconfigPath, resources = kc, res
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	if resources == nil {
+		return nil
+	}
+
+	args := []string{"delete", kind, name}
+	if ns != "" {
+		args = append(args, "--namespace", ns)
+	}
+	if kind == "namespace" {
+		args = append(args, namespaceDeleteFlags...)
+	}
+
+	if _, err := NewKubectl(kubeconfigPath).captureContext(ctx, args...); err != nil {
+		return fmt.Errorf("unable to delete %s %s/%s: %v", kind, kubeconfigPath, name, err)
+	}
+
+	p.mu.Lock()
+	forget(resources)
+	p.mu.Unlock()
+
+	return p.journal.Remove("kubectl", kind, name)
+}
+
+// namespaceDeleteFlags makes kubectl return without waiting for the namespace to be finalized.
+// Waiting is slow as every pod in the namespace needs to terminate,
+// and never finishes in clusters without the namespace controller, like the ones of ControlPlaneProvider.
+var namespaceDeleteFlags = []string{"--wait=false"}
+
+// flightKey returns the key to deduplicate concurrent requests for the same resource.
+func flightKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+func (p *KubectlProvider) withScope(scope string) Provider {
+	return &scopedKubectlProvider{KubectlProvider: p, scope: scope}
+}
+
+// scopedKubectlProvider is the view of a KubectlProvider for a child harness.
+// It creates namespaces and ConfigMaps separate from the ones created in other scopes.
+type scopedKubectlProvider struct {
+	*KubectlProvider
+	scope string
+}
+
+func (p *scopedKubectlProvider) KubernetesConfigMap(opts ...KubernetesConfigMapOption) (*KubernetesConfigMap, error) {
+	return p.KubectlProvider.KubernetesConfigMap(append(opts, func(c *KubernetesConfigMapConfig) {
+		c.Scope = p.scope
+	})...)
+}
+
+func (p *scopedKubectlProvider) KubernetesNamespace(opts ...KubernetesNamespaceOption) (*KubernetesNamespace, error) {
+	return p.KubectlProvider.KubernetesNamespace(append(opts, func(c *KubernetesNamespaceConfig) {
+		c.Scope = p.scope
+	})...)
+}
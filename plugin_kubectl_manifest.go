@@ -0,0 +1,234 @@
+package testkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// KubernetesManifest applies the manifest via kubectl apply, and tracks the applied objects,
+// so that they are deleted in reverse order on Cleanup, before the ConfigMaps and the namespaces created by the provider.
+//
+// The objects updated by the manifest are tracked as well as the ones created by it,
+// as the objects in a manifest applied by a test are considered to be owned by the test.
+func (p *KubectlProvider) KubernetesManifest(opts ...KubernetesManifestOption) (*KubernetesManifest, error) {
+	config := &KubernetesManifestConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if config.KubeconfigPath == "" {
+		config.KubeconfigPath = p.DefaultKubeconfigPath
+	}
+
+	if len(config.Sources) == 0 {
+		return nil, fmt.Errorf("unable to apply manifest: no file, YAML or template is given")
+	}
+
+	manifest, err := renderKubernetesManifest(config)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "testkit_manifest_*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create manifest file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(manifest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to write manifest file: %v", err)
+	}
+
+	var nsArgs []string
+	if config.Namespace != "" {
+		nsArgs = []string{"--namespace", config.Namespace}
+	}
+
+	kubectl := NewKubectl(config.KubeconfigPath)
+
+	out, applyErr := kubectl.outputContext(p.context(), append([]string{"apply", "-f", f.Name(), "-o", "json"}, nsArgs...)...)
+	if applyErr != nil {
+		// Some of the objects may have been applied before kubectl failed.
+		// Track the ones existing now, so that they are deleted on Cleanup.
+		// kubectl get fails as well when the manifest contains an object it cannot get,
+		// like the one that made kubectl apply fail, after printing the ones it got.
+		// The error is ignored, as the error of kubectl apply is returned anyway.
+		out, _ = kubectl.outputContext(p.context(), append([]string{"get", "-f", f.Name(), "-o", "json", "--ignore-not-found"}, nsArgs...)...)
+	}
+
+	objects, err := parseKubernetesObjectRefs(out)
+	if err != nil && applyErr == nil {
+		return nil, fmt.Errorf("unable to read objects applied by kubectl: %v", err)
+	}
+
+	p.mu.Lock()
+	resources := p.resourcesFor(config.KubeconfigPath)
+	for _, o := range objects {
+		resources.addObject(o)
+	}
+	p.mu.Unlock()
+
+	if applyErr != nil {
+		return nil, fmt.Errorf("unable to apply manifest: %v", applyErr)
+	}
+
+	return &KubernetesManifest{Objects: objects}, nil
+}
+
+// renderKubernetesManifest concatenates the sources of the manifest into a multi-document YAML,
+// rendering the templates along the way.
+func renderKubernetesManifest(config *KubernetesManifestConfig) (string, error) {
+	var docs []string
+
+	for _, s := range config.Sources {
+		name, content := "manifest", s.Content
+
+		if s.Path != "" {
+			data, err := os.ReadFile(s.Path)
+			if err != nil {
+				return "", fmt.Errorf("unable to read manifest: %v", err)
+			}
+
+			name, content = s.Path, string(data)
+		}
+
+		if s.Template {
+			vars := map[string]any{"Namespace": config.Namespace}
+			for k, v := range s.Vars {
+				vars[k] = v
+			}
+
+			// Missing variables are errors, so that typos do not end up in empty fields of the applied objects.
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+			if err != nil {
+				return "", fmt.Errorf("unable to parse manifest template: %v", err)
+			}
+
+			var b strings.Builder
+			if err := tmpl.Execute(&b, vars); err != nil {
+				return "", fmt.Errorf("unable to render manifest template: %v", err)
+			}
+
+			content = b.String()
+		}
+
+		docs = append(docs, content)
+	}
+
+	return strings.Join(docs, "\n---\n"), nil
+}
+
+// kubectlObject is the part of an object, or a list of objects, printed by kubectl -o json
+// that identifies the objects.
+type kubectlObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"metadata"`
+	Items []kubectlObject `json:"items"`
+}
+
+// parseKubernetesObjectRefs returns the objects printed by kubectl -o json, in the order they were printed.
+func parseKubernetesObjectRefs(out string) ([]KubernetesObjectRef, error) {
+	var refs []KubernetesObjectRef
+
+	var add func(o kubectlObject)
+	add = func(o kubectlObject) {
+		if o.Kind == "List" {
+			for _, item := range o.Items {
+				add(item)
+			}
+			return
+		}
+
+		refs = append(refs, KubernetesObjectRef{
+			APIVersion: o.APIVersion,
+			Kind:       o.Kind,
+			Namespace:  o.Metadata.Namespace,
+			Name:       o.Metadata.Name,
+		})
+	}
+
+	d := json.NewDecoder(strings.NewReader(out))
+	for {
+		var o kubectlObject
+		if err := d.Decode(&o); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return refs, err
+		}
+
+		add(o)
+	}
+
+	return refs, nil
+}
+
+// deleteKubernetesObject deletes the object, considering the object that does not exist deleted.
+func deleteKubernetesObject(ctx context.Context, kubectl *Kubectl, ref KubernetesObjectRef) error {
+	// The kind is qualified with the version and the group, so that it's not confused with the kinds of the same name in other groups.
+	resource := ref.Kind
+	if group, version, ok := strings.Cut(ref.APIVersion, "/"); ok {
+		resource += "." + version + "." + group
+	}
+
+	args := []string{"delete", resource + "/" + ref.Name, "--ignore-not-found"}
+	if ref.Namespace != "" {
+		args = append(args, "--namespace", ref.Namespace)
+	}
+	if ref.Kind == "Namespace" && ref.APIVersion == "v1" {
+		args = append(args, namespaceDeleteFlags...)
+	}
+
+	_, err := kubectl.captureContext(ctx, args...)
+
+	return err
+}
+
+// deleteKubernetesManifest deletes the objects of the manifest tracked by the provider in reverse order.
+func (p *KubectlProvider) deleteKubernetesManifest(ctx context.Context, m *KubernetesManifest) error {
+	for i := len(m.Objects) - 1; i >= 0; i-- {
+		ref := m.Objects[i]
+
+		// The lock is not held while deleting the object,
+		// so that parallel subtests finishing at the same time do not wait for each other.
+		p.mu.Lock()
+		var (
+			kubeconfigPath string
+			resources      *kubectlResources
+		)
+		for kc, res := range p.kubeconfigToResources {
+			if res.hasObject(ref) {
+				kubeconfigPath, resources = kc, res
+				break
+			}
+		}
+		p.mu.Unlock()
+
+		if resources == nil {
+			continue
+		}
+
+		if err := deleteKubernetesObject(ctx, NewKubectl(kubeconfigPath), ref); err != nil {
+			return fmt.Errorf("unable to delete %s in %s: %v", ref, kubeconfigPath, err)
+		}
+
+		p.mu.Lock()
+		resources.removeObject(ref)
+		p.mu.Unlock()
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package testkit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubectlProvider_KubernetesManifest(t *testing.T) {
+	dir := t.TempDir()
+	applied := filepath.Join(dir, "applied.yaml")
+
+	// The fake kubectl prints the objects of the manifest depending on its content,
+	// and fails to apply and get the broken manifest after applying and getting a Secret.
+	commands := fakeCommand(t, "kubectl", fmt.Sprintf(`
+case "$1" in
+apply)
+  cat "$3" >> %s
+  if grep -q broken "$3"; then echo 'error: unable to recognize "broken"' >&2; exit 1; fi
+  if grep -q "kind: Foo" "$3"; then
+    echo '{"apiVersion":"v1","kind":"List","items":['
+    echo '{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition","metadata":{"name":"foos.example.com"}},'
+    echo '{"apiVersion":"v1","kind":"ConfigMap","metadata":{"namespace":"app","name":"config"}},'
+    echo '{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"namespace":"app","name":"foo"}}'
+    echo ']}'
+  else
+    echo '{"apiVersion":"v1","kind":"Secret","metadata":{"namespace":"app","name":"secret"}}'
+  fi;;
+get)
+  echo '{"apiVersion":"v1","kind":"Secret","metadata":{"namespace":"app","name":"secret"}}'
+  if grep -q broken "$3"; then echo 'error: unable to recognize "broken"' >&2; exit 1; fi;;
+esac`, applied))
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, nil, 0644))
+
+	tk, err := Build(Providers(&KubectlProvider{DefaultKubeconfigPath: kubeconfig}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	crd := filepath.Join(dir, "crd.yaml")
+	require.NoError(t, os.WriteFile(crd, []byte("kind: CustomResourceDefinition\n"), 0644))
+
+	m := tk.KubernetesManifest(t,
+		KubernetesManifestNamespace("app"),
+		KubernetesManifestFiles(crd),
+		KubernetesManifestYAML("kind: ConfigMap\n"),
+		KubernetesManifestTemplate("kind: Foo\nmetadata:\n  namespace: {{ .Namespace }}\n  labels:\n    app: {{ .App }}\n", map[string]any{"App": "web"}),
+	)
+	require.Equal(t, []KubernetesObjectRef{
+		{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "foos.example.com"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "app", Name: "config"},
+		{APIVersion: "example.com/v1", Kind: "Foo", Namespace: "app", Name: "foo"},
+	}, m.Objects)
+
+	data, err := os.ReadFile(applied)
+	require.NoError(t, err)
+	require.Equal(t, "kind: CustomResourceDefinition\n\n---\nkind: ConfigMap\n\n---\nkind: Foo\nmetadata:\n  namespace: app\n  labels:\n    app: web\n", string(data))
+	require.Contains(t, commands()[0], " -o json --namespace app")
+
+	_, err = tk.availableProviders[0].(*KubectlProvider).KubernetesManifest(KubernetesManifestTemplate("app: {{ .Missing }}", nil))
+	require.ErrorContains(t, err, `map has no entry for key "Missing"`)
+
+	t.Run("sub", func(t *testing.T) {
+		sub := tk.Sub(t)
+
+		// The Secret applied before kubectl failed is tracked, and deleted only once with the manifest applying it again.
+		_, _, err := resolve(sub, "Kubernetes manifest", func(p KubernetesManifestProvider) (*KubernetesManifest, error) {
+			return p.KubernetesManifest(KubernetesManifestYAML("kind: Secret\n---\nbroken\n"))
+		})
+		var e *testkiterror.E
+		require.ErrorAs(t, err, &e)
+		require.Contains(t, e.String(), `unable to recognize "broken"`)
+
+		// The Secret printed by kubectl get before failing is tracked.
+		p := tk.availableProviders[0].(*KubectlProvider)
+		p.mu.Lock()
+		tracked := p.resourcesFor(kubeconfig).hasObject(KubernetesObjectRef{APIVersion: "v1", Kind: "Secret", Namespace: "app", Name: "secret"})
+		p.mu.Unlock()
+		require.True(t, tracked)
+
+		sub.KubernetesManifest(t, KubernetesManifestYAML("kind: Secret\n"))
+	})
+
+	require.Equal(t, 1, countPrefixed(commands(), "delete Secret/secret --ignore-not-found --namespace app"))
+
+	require.Empty(t, tk.DoCleanup())
+
+	// The objects are deleted in reverse order, and the Secret already deleted by the subtest is not deleted again.
+	deletes := commands()[len(commands())-3:]
+	require.Equal(t, []string{
+		"delete Foo.v1.example.com/foo --ignore-not-found --namespace app",
+		"delete ConfigMap/config --ignore-not-found --namespace app",
+		"delete CustomResourceDefinition.v1.apiextensions.k8s.io/foos.example.com --ignore-not-found",
+	}, deletes)
+	require.Equal(t, 1, countPrefixed(commands(), "delete Secret/secret"))
+}
@@ -2,22 +2,23 @@ package testkit
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
 
 type TerraformProvider struct {
 	// WorkspacePath is the path to the Terraform workspace.
-	WorkspacePath string
+	WorkspacePath string `yaml:"workspacePath"`
 	// Vars is the map of Terraform variables.
-	Vars map[string]string
+	Vars map[string]string `yaml:"vars"`
 
 	// BackendConfig is the map of Terraform backend configuration.
 	// For example, to configure the S3 backend, the configuration is:
@@ -27,18 +28,25 @@ type TerraformProvider struct {
 	// 		"key":    "path/to/terraform.tfstate",
 	// 		"region": "us-east-1",
 	// 	},
-	BackendConfig map[string]string
+	BackendConfig map[string]string `yaml:"backendConfig"`
 
 	// KubeconfigDir is the directory where the kubeconfig files for EKS clusters are stored.
-	KubeconfigDir string
+	KubeconfigDir string `yaml:"kubeconfigDir"`
 
+	// mu guards tfShowJSONBytes and the kubeconfig files,
+	// so that the provider can be used by parallel tests.
+	mu              sync.Mutex
 	tfShowJSONBytes []byte
+
+	journaling
 }
 
 var _ S3BucketProvider = &TerraformProvider{}
 var _ EKSClusterProvider = &TerraformProvider{}
 var _ KubernetesClusterProvider = &TerraformProvider{}
 var _ Provider = &TerraformProvider{}
+var _ ContextProvider = &TerraformProvider{}
+var _ ArtifactCollector = &TerraformProvider{}
 
 func (p *TerraformProvider) GetEKSCluster(opts ...EKSClusterOption) (*EKSCluster, error) {
 	if p.KubeconfigDir == "" {
@@ -68,6 +76,10 @@ func (p *TerraformProvider) GetKubernetesCluster(opts ...KubernetesClusterOption
 		opt(&conf)
 	}
 
+	if conf.Version != "" {
+		return nil, fmt.Errorf("unable to provide Kubernetes cluster of version %s: the version of the cluster is managed by terraform", conf.Version)
+	}
+
 	resource, err := p.getEKSClusterResource()
 	if err != nil {
 		return nil, err
@@ -84,7 +96,7 @@ func (p *TerraformProvider) GetKubernetesCluster(opts ...KubernetesClusterOption
 }
 
 func (p *TerraformProvider) getEKSClusterResource() (tfResource, error) {
-	resources, err := p.readEKSClusterResources(bytes.NewReader(p.tfShowJSONBytes))
+	resources, err := p.readEKSClusterResources(bytes.NewReader(p.showJSON()))
 	if err != nil {
 		return tfResource{}, err
 	}
@@ -140,6 +152,10 @@ func (p *TerraformProvider) generateKubeconfigFile(values *tfEKSClusterValues) (
 		return "", fmt.Errorf("unable to marshal kubeconfig: %v", err)
 	}
 
+	// Parallel tests requesting the same cluster write the same kubeconfig file.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if err := os.MkdirAll(p.KubeconfigDir, 0755); err != nil {
 		return "", fmt.Errorf("unable to create kubeconfig directory %q: %v", p.KubeconfigDir, err)
 	}
@@ -193,7 +209,7 @@ type KubeconfigUser struct {
 }
 
 func (p *TerraformProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, error) {
-	resources, err := p.readS3BucketResources(bytes.NewReader(p.tfShowJSONBytes))
+	resources, err := p.readS3BucketResources(bytes.NewReader(p.showJSON()))
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +229,7 @@ func (p *TerraformProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, erro
 }
 
 func (p *TerraformProvider) GetECRImageRepository(opts ...ECRImageRepositoryOption) (*ECRImageRepository, error) {
-	resources, err := p.readECRImageRepository(bytes.NewReader(p.tfShowJSONBytes))
+	resources, err := p.readECRImageRepository(bytes.NewReader(p.showJSON()))
 	if err != nil {
 		return nil, err
 	}
@@ -311,8 +327,16 @@ type tfShowRootModule struct {
 	Resources []tfResource `json:"resources"`
 }
 
-func (p *TerraformProvider) captureTerraformShowJSON() ([]byte, error) {
-	output, err := p.runTerraformCommand("show", "-json")
+// showJSON returns the output of terraform show -json captured on setup.
+func (p *TerraformProvider) showJSON() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.tfShowJSONBytes
+}
+
+func (p *TerraformProvider) captureTerraformShowJSON(ctx context.Context) ([]byte, error) {
+	output, err := p.runTerraformCommand(ctx, "show", "-json")
 	if err != nil {
 		return nil, err
 	}
@@ -320,7 +344,7 @@ func (p *TerraformProvider) captureTerraformShowJSON() ([]byte, error) {
 	return output, nil
 }
 
-func (p *TerraformProvider) runTerraformCommand(args ...string) ([]byte, error) {
+func (p *TerraformProvider) runTerraformCommand(ctx context.Context, args ...string) ([]byte, error) {
 	var argsWithVars []string
 
 	argsWithVars = append(argsWithVars, args...)
@@ -329,10 +353,10 @@ func (p *TerraformProvider) runTerraformCommand(args ...string) ([]byte, error)
 		argsWithVars = append(argsWithVars, "-var", k+"="+v)
 	}
 
-	return p.runTerraformCommandNoVars(argsWithVars...)
+	return p.runTerraformCommandNoVars(ctx, argsWithVars...)
 }
 
-func (p *TerraformProvider) runTerraformInit() ([]byte, error) {
+func (p *TerraformProvider) runTerraformInit(ctx context.Context) ([]byte, error) {
 	var args []string
 
 	args = append(args, "init")
@@ -341,14 +365,17 @@ func (p *TerraformProvider) runTerraformInit() ([]byte, error) {
 		args = append(args, "-backend-config", k+"="+v)
 	}
 
-	return p.runTerraformCommand(args...)
+	return p.runTerraformCommand(ctx, args...)
 }
 
-func (p *TerraformProvider) runTerraformCommandNoVars(args ...string) ([]byte, error) {
-	c := exec.Command("terraform", args...)
+// runTerraformCommandNoVars runs terraform in the workspace.
+// When ctx is done, terraform is interrupted rather than killed,
+// so that it can save the state of the resources it has created so far.
+func (p *TerraformProvider) runTerraformCommandNoVars(ctx context.Context, args ...string) ([]byte, error) {
+	c := newCommand(ctx, "terraform", args...)
 	c.Dir = p.WorkspacePath
 
-	r, err := c.CombinedOutput()
+	r, err := combinedOutput(ctx, c)
 	if err != nil {
 		return nil, fmt.Errorf("unable to run terraform command: %v\n%s", err, string(r))
 	}
@@ -447,7 +474,21 @@ func (p *TerraformProvider) readResources(r io.Reader) ([]tfResource, error) {
 	return output.Values.RootModule.Resources, nil
 }
 
+// CollectArtifacts writes the output of terraform show into dir/terraform/<workspace name>/show.txt.
+func (p *TerraformProvider) CollectArtifacts(ctx context.Context, dir string) error {
+	out, err := p.runTerraformCommandNoVars(ctx, "show", "-no-color")
+	if err != nil {
+		return err
+	}
+
+	return writeArtifact(dir, filepath.Join("terraform", filepath.Base(p.WorkspacePath), "show.txt"), out)
+}
+
 func (p *TerraformProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *TerraformProvider) SetupContext(ctx context.Context) error {
 	if p.KubeconfigDir == "" {
 		p.KubeconfigDir = filepath.Join(os.TempDir(), "testkit_terraform_kubeconfigs")
 	}
@@ -465,31 +506,96 @@ func (p *TerraformProvider) Setup() error {
 		p.Vars = make(map[string]string)
 	}
 
-	_, err = p.runTerraformInit()
+	_, err = p.runTerraformInit(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to run terraform init: %v", err)
 	}
 
-	_, err = p.runTerraformCommand("apply", "-auto-approve")
+	_, err = p.runTerraformCommand(ctx, "apply", "-auto-approve")
 	if err != nil {
 		return fmt.Errorf("unable to run terraform apply: %v", err)
 	}
 
-	output, err := p.runTerraformCommandNoVars("show", "-json")
+	output, err := p.runTerraformCommandNoVars(ctx, "show", "-json")
 	if err != nil {
 		return fmt.Errorf("unable to run terraform show: %v", err)
 	}
 
+	p.mu.Lock()
 	p.tfShowJSONBytes = output
+	p.mu.Unlock()
+
+	if err := p.recordWorkspace(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// recordWorkspace records the workspace into the journal,
+// along with the names of the variables and the backend configuration required to destroy it later.
+func (p *TerraformProvider) recordWorkspace() error {
+	if p.journal == nil {
+		return nil
+	}
+
+	workspacePath, err := filepath.Abs(p.WorkspacePath)
+	if err != nil {
+		return fmt.Errorf("unable to get absolute path of workspace %s: %v", p.WorkspacePath, err)
+	}
+
+	resources, err := p.readResources(bytes.NewReader(p.showJSON()))
+	if err != nil {
+		return fmt.Errorf("unable to read resources in workspace %s: %v", p.WorkspacePath, err)
+	}
+
+	var addresses []string
+	for _, r := range resources {
+		addresses = append(addresses, r.Address)
+	}
+
+	// Only the names of the variables and the backend configuration are recorded,
+	// as their values may be secrets like passwords and access keys.
+	attrs := map[string]string{
+		"resources":      strings.Join(addresses, ","),
+		"vars":           strings.Join(sortedKeys(p.Vars), ","),
+		"backend-config": strings.Join(sortedKeys(p.BackendConfig), ","),
+	}
+
+	// Remove the entry recorded by the previous apply, if any,
+	// so that reapplying the same workspace does not duplicate it.
+	if err := p.journal.Remove("terraform", "workspace", workspacePath); err != nil {
+		return err
+	}
+
+	return p.journal.Record(JournalEntry{
+		Provider:   "terraform",
+		Kind:       "workspace",
+		Name:       workspacePath,
+		Attributes: attrs,
+	})
+}
+
 func (p *TerraformProvider) Cleanup() error {
-	_, err := p.runTerraformCommand("destroy", "-auto-approve")
+	return p.CleanupContext(context.Background())
+}
+
+func (p *TerraformProvider) CleanupContext(ctx context.Context) error {
+	_, err := p.runTerraformCommand(ctx, "destroy", "-auto-approve")
 	if err != nil {
 		return err
 	}
 
+	if p.journal != nil {
+		workspacePath, err := filepath.Abs(p.WorkspacePath)
+		if err != nil {
+			return fmt.Errorf("unable to get absolute path of workspace %s: %v", p.WorkspacePath, err)
+		}
+
+		if err := p.journal.Remove("terraform", "workspace", workspacePath); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,317 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/mumoshu/testkit/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// VClusterProvider provides virtual clusters created by vcluster within a host cluster.
+// Each virtual cluster has its own API server and cluster-scoped resources like CRDs and ClusterRoles,
+// while it runs in a namespace of the host cluster, so that the tests get cluster-level isolation
+// at roughly the cost of a namespace.
+//
+// A virtual cluster is created for each KubernetesClusterConfig.ID on the first request,
+// reused by the later requests, and deleted along with its host namespace on Cleanup.
+//
+//	kind := &testkit.KindProvider{}
+//	vcluster := &testkit.VClusterProvider{Host: kind}
+//	tk := testkit.New(t, testkit.Providers(kind, vcluster))
+//	cluster := tk.KubernetesCluster(t, func(c *testkit.KubernetesClusterConfig) { c.ID = t.Name() })
+type VClusterProvider struct {
+	// Host is the provider of the host cluster
+	// when HostKubeconfigPath is empty.
+	// If Host is also a Provider, VClusterProvider depends on it,
+	// so that the harness sets up Host before VClusterProvider.
+	//
+	// In the harness configuration file, this is set via the cluster field
+	// that refers to the name of the provider of the host cluster.
+	Host KubernetesClusterProvider `yaml:"-"`
+
+	// HostKubeconfigPath is the path to the kubeconfig of the host cluster.
+	HostKubeconfigPath string `yaml:"hostKubeconfig"`
+
+	// ChartVersion is the version of the vcluster chart. Defaults to the one of the vcluster CLI.
+	ChartVersion string `yaml:"chartVersion"`
+
+	// Values are the paths to the values files of the vcluster chart.
+	Values []string `yaml:"values"`
+
+	// ConnectArgs are the extra arguments passed to vcluster connect,
+	// like "--server=https://vcluster.example.com", when the default way of connecting
+	// to the virtual cluster does not work for the host cluster.
+	ConnectArgs []string `yaml:"connectArgs"`
+
+	vclusterBin string
+
+	// mu guards clusters, so that the provider can be used by parallel tests.
+	mu sync.Mutex
+	// clusters maps the IDs to the virtual clusters created by the provider.
+	clusters map[string]*vcluster
+	// flights deduplicates concurrent requests for the same cluster.
+	flights singleflight.Group
+
+	// kubeconfigDir is the directory where the kubeconfig files of the virtual clusters are stored.
+	kubeconfigDir string
+
+	log.L `yaml:"-"`
+
+	journaling
+	providerContext
+}
+
+// vcluster is a virtual cluster created by VClusterProvider.
+// The host namespace has the same name as the virtual cluster.
+type vcluster struct {
+	name           string
+	kubeconfigPath string
+}
+
+var _ Provider = &VClusterProvider{}
+var _ ContextProvider = &VClusterProvider{}
+var _ DependentProvider = &VClusterProvider{}
+var _ KubernetesClusterProvider = &VClusterProvider{}
+
+func (p *VClusterProvider) DependsOn() []Provider {
+	if hp, ok := p.Host.(Provider); ok {
+		return []Provider{hp}
+	}
+
+	return nil
+}
+
+func (p *VClusterProvider) Setup() error {
+	return p.SetupContext(context.Background())
+}
+
+func (p *VClusterProvider) SetupContext(ctx context.Context) error {
+	p.setContext(ctx)
+
+	const (
+		vclusterBin = "vcluster"
+	)
+
+	bin, err := exec.LookPath(vclusterBin)
+	if err != nil {
+		return fmt.Errorf("unable to find %s binary: %v", vclusterBin, err)
+	}
+
+	p.vclusterBin = bin
+
+	if p.HostKubeconfigPath == "" {
+		if p.Host == nil {
+			return fmt.Errorf("either Host or HostKubeconfigPath must be set")
+		}
+
+		kc, err := p.Host.GetKubernetesCluster()
+		if err != nil {
+			return fmt.Errorf("unable to get host cluster: %v", err)
+		}
+
+		p.HostKubeconfigPath = kc.KubeconfigPath
+	}
+
+	p.kubeconfigDir = filepath.Join(os.TempDir(), "testkit_vcluster_kubeconfigs")
+	p.clusters = make(map[string]*vcluster)
+
+	return nil
+}
+
+func (p *VClusterProvider) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+func (p *VClusterProvider) CleanupContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, vc := range p.clusters {
+		out, err := p.capture(ctx, "delete", vc.name, "--namespace", vc.name, "--delete-namespace")
+		if err != nil {
+			return fmt.Errorf("unable to delete vcluster %s: %v: %s", vc.name, err, out)
+		}
+
+		delete(p.clusters, id)
+
+		if err := os.Remove(vc.kubeconfigPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove kubeconfig of vcluster %s: %v", vc.name, err)
+		}
+
+		if err := p.journal.Remove("vcluster", "cluster", vc.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *VClusterProvider) capture(ctx context.Context, args ...string) (string, error) {
+	c := newCommand(ctx, p.vclusterBin, args...)
+	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", p.HostKubeconfigPath))
+
+	r, err := combinedOutput(ctx, c)
+	return string(r), err
+}
+
+func (p *VClusterProvider) GetKubernetesCluster(opts ...KubernetesClusterOption) (*KubernetesCluster, error) {
+	var conf KubernetesClusterConfig
+
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if conf.Version != "" {
+		return nil, fmt.Errorf("unable to provide Kubernetes cluster of version %s: set the version of the virtual clusters via the values of the vcluster chart", conf.Version)
+	}
+
+	// Concurrent requests for the same cluster wait for the first one to create it.
+	v, err, _ := p.flights.Do(flightKey("cluster", conf.ID), func() (any, error) {
+		return p.getKubernetesCluster(conf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result shared by the concurrent requests,
+	// so that each caller can modify its own.
+	kc := *v.(*KubernetesCluster)
+
+	return &kc, nil
+}
+
+func (p *VClusterProvider) getKubernetesCluster(conf KubernetesClusterConfig) (*KubernetesCluster, error) {
+	p.mu.Lock()
+	vc, ok := p.clusters[conf.ID]
+	p.mu.Unlock()
+
+	if ok {
+		return &KubernetesCluster{KubeconfigPath: vc.kubeconfigPath, Name: vc.name}, nil
+	}
+
+	if p.reuse {
+		kc, err := p.reattachKubernetesCluster(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		if kc != nil {
+			return kc, nil
+		}
+	}
+
+	name := ResourceNamePrefix
+	if conf.ID != "" {
+		name += conf.ID + "-"
+	}
+	name += randString(4)
+
+	args := []string{"create", name, "--namespace", name, "--connect=false"}
+
+	if p.ChartVersion != "" {
+		args = append(args, "--chart-version", p.ChartVersion)
+	}
+
+	for _, v := range p.Values {
+		args = append(args, "--values", v)
+	}
+
+	out, err := p.capture(p.context(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vcluster %s: %v: %s", name, err, out)
+	}
+
+	vc = &vcluster{name: name, kubeconfigPath: p.clusterKubeconfigPath(name)}
+
+	// Track the virtual cluster before connecting to it, so that it's deleted even if connecting fails.
+	p.mu.Lock()
+	p.clusters[conf.ID] = vc
+	p.mu.Unlock()
+
+	if err := p.journal.Record(JournalEntry{
+		Provider:       "vcluster",
+		Kind:           "cluster",
+		ID:             conf.ID,
+		Name:           name,
+		KubeconfigPath: p.HostKubeconfigPath,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := p.writeKubeconfig(vc); err != nil {
+		return nil, err
+	}
+
+	p.Debugf("Exported kubeconfig for vcluster %s: %s", name, filecontentLogVar{vc.kubeconfigPath})
+
+	return &KubernetesCluster{KubeconfigPath: vc.kubeconfigPath, Name: name}, nil
+}
+
+func (p *VClusterProvider) clusterKubeconfigPath(name string) string {
+	return filepath.Join(p.kubeconfigDir, fmt.Sprintf("%s.kubeconfig", name))
+}
+
+// writeKubeconfig writes the kubeconfig of the virtual cluster printed by vcluster connect.
+func (p *VClusterProvider) writeKubeconfig(vc *vcluster) error {
+	args := append([]string{"connect", vc.name, "--namespace", vc.name, "--print"}, p.ConnectArgs...)
+
+	c := newCommand(p.context(), p.vclusterBin, args...)
+	c.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", p.HostKubeconfigPath))
+
+	// Only the standard output is the kubeconfig.
+	kubeconfig, err := output(p.context(), c)
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return fmt.Errorf("unable to connect to vcluster %s: %v: %s", vc.name, err, stderr)
+	}
+
+	if err := os.MkdirAll(p.kubeconfigDir, 0755); err != nil {
+		return fmt.Errorf("unable to create kubeconfig directory: %v", err)
+	}
+
+	if err := os.WriteFile(vc.kubeconfigPath, kubeconfig, 0600); err != nil {
+		return fmt.Errorf("unable to write kubeconfig of vcluster %s: %v", vc.name, err)
+	}
+
+	return nil
+}
+
+// reattachKubernetesCluster returns the virtual cluster recorded in the journal for the ID, if any.
+// A reattached virtual cluster is deleted on Cleanup, as if it was created by this provider.
+func (p *VClusterProvider) reattachKubernetesCluster(conf KubernetesClusterConfig) (*KubernetesCluster, error) {
+	entries, err := p.journal.Find("vcluster", "cluster", func(e JournalEntry) bool {
+		return e.ID == conf.ID && e.KubeconfigPath == p.HostKubeconfigPath
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		vc := &vcluster{name: e.Name, kubeconfigPath: p.clusterKubeconfigPath(e.Name)}
+
+		if err := p.writeKubeconfig(vc); err != nil {
+			// The virtual cluster has likely been deleted outside of testkit.
+			p.Debugf("Skipped reattaching to vcluster %s recorded in run %s: %v", e.Name, e.RunID, err)
+			if err := p.journal.Remove("vcluster", "cluster", e.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		p.clusters[conf.ID] = vc
+		p.mu.Unlock()
+
+		return &KubernetesCluster{KubeconfigPath: vc.kubeconfigPath, Name: vc.name}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,47 @@
+package testkit
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVClusterProvider(t *testing.T) {
+	// The fake vcluster prints the kubeconfig to stdout and the progress to stderr, like the real one.
+	commands := fakeCommand(t, "vcluster", `
+case "$1" in
+connect) echo "done: Virtual cluster kubeconfig printed" >&2; echo "server: https://$2.example.com";;
+esac
+[ "$KUBECONFIG" = host.kubeconfig ] || exit 1`)
+
+	vcluster := &VClusterProvider{HostKubeconfigPath: "host.kubeconfig", Values: []string{"values.yaml"}}
+
+	tk, err := Build(Providers(vcluster), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	a := tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "a" })
+	require.True(t, strings.HasPrefix(a.Name, "testkit-a-"), a.Name)
+
+	kubeconfig, err := os.ReadFile(a.KubeconfigPath)
+	require.NoError(t, err)
+	require.Equal(t, "server: https://"+a.Name+".example.com\n", string(kubeconfig))
+
+	require.Equal(t, []string{
+		"create " + a.Name + " --namespace " + a.Name + " --connect=false --values values.yaml",
+		"connect " + a.Name + " --namespace " + a.Name + " --print",
+	}, commands())
+
+	// The virtual cluster is reused for the same ID, and another ID gets another one.
+	require.Equal(t, a.KubeconfigPath, tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "a" }).KubeconfigPath)
+	b := tk.KubernetesCluster(t, func(c *KubernetesClusterConfig) { c.ID = "b" })
+	require.NotEqual(t, a.Name, b.Name)
+	require.Equal(t, 2, countPrefixed(commands(), "create "))
+
+	require.Empty(t, tk.DoCleanup())
+	require.Contains(t, commands(), "delete "+a.Name+" --namespace "+a.Name+" --delete-namespace")
+	require.Contains(t, commands(), "delete "+b.Name+" --namespace "+b.Name+" --delete-namespace")
+	require.NoFileExists(t, a.KubeconfigPath)
+}
@@ -1,21 +1,20 @@
 package testkit
 
 import (
+	"context"
 	"testing"
 	"time"
 )
 
+// PollUntil polls the condition every 100ms until it returns true,
+// and fails the test if it does not return true within the timeout.
+//
+// Deprecated: Use Eventually, which supports conditions that return errors,
+// backoff, and reports the last error on failure.
 func PollUntil(t *testing.T, condition func() bool, timeout time.Duration) {
 	t.Helper()
 
-	start := time.Now()
-	for {
-		if condition() {
-			return
-		}
-		if time.Since(start) > timeout {
-			t.Fatal("timeout")
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
+	Eventually(t, func(context.Context) (bool, error) {
+		return condition(), nil
+	}, PollTimeout(timeout))
 }
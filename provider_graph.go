@@ -0,0 +1,209 @@
+package testkit
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DependentProvider is a provider that depends on other providers.
+//
+// The harness sets up a DependentProvider only after all the providers
+// returned by DependsOn have been set up successfully,
+// and cleans it up before any of them.
+// Providers that do not depend on each other are set up and cleaned up in parallel.
+//
+// Every provider returned by DependsOn must also be passed to the harness
+// via the Providers option.
+type DependentProvider interface {
+	Provider
+
+	// DependsOn returns the providers this provider depends on.
+	DependsOn() []Provider
+}
+
+// providerGraph is a dependency graph of providers.
+type providerGraph struct {
+	providers []Provider
+
+	// deps maps the index of a provider in providers
+	// to the indices of the providers it depends on.
+	deps [][]int
+}
+
+// newProviderGraph builds a dependency graph out of the providers.
+// Dependencies are taken from DependentProvider.DependsOn and the extra map,
+// which is populated by the DependsOn option.
+//
+// It returns an error when a provider depends on a provider that is not in
+// the providers list, or when the dependencies form a cycle.
+func newProviderGraph(providers []Provider, extra map[Provider][]Provider) (*providerGraph, error) {
+	g := &providerGraph{
+		providers: providers,
+		deps:      make([][]int, len(providers)),
+	}
+
+	index := func(p Provider) int {
+		for i, q := range providers {
+			if q == p {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for i, p := range providers {
+		var deps []Provider
+
+		if dp, ok := p.(DependentProvider); ok {
+			deps = append(deps, dp.DependsOn()...)
+		}
+
+		deps = append(deps, extra[p]...)
+
+		for _, d := range deps {
+			j := index(d)
+			if j < 0 {
+				return nil, fmt.Errorf("provider %v depends on provider %v, which is not in the providers list", p, d)
+			}
+
+			if j == i {
+				return nil, fmt.Errorf("provider %v depends on itself", p)
+			}
+
+			g.deps[i] = append(g.deps[i], j)
+		}
+	}
+
+	if err := g.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func (g *providerGraph) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(g.providers))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("providers have a circular dependency involving provider %v", g.providers[i])
+		case visited:
+			return nil
+		}
+
+		state[i] = visiting
+		for _, j := range g.deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+
+		return nil
+	}
+
+	for i := range g.providers {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// subgraph returns the graph that consists only of the providers for which keep returns true.
+// Dependencies on providers that are not kept are dropped.
+func (g *providerGraph) subgraph(keep func(Provider) bool) *providerGraph {
+	newIndex := make([]int, len(g.providers))
+
+	sub := &providerGraph{}
+	for i, p := range g.providers {
+		newIndex[i] = -1
+		if keep(p) {
+			newIndex[i] = len(sub.providers)
+			sub.providers = append(sub.providers, p)
+		}
+	}
+
+	sub.deps = make([][]int, len(sub.providers))
+	for i, deps := range g.deps {
+		if newIndex[i] < 0 {
+			continue
+		}
+
+		for _, j := range deps {
+			if newIndex[j] >= 0 {
+				sub.deps[newIndex[i]] = append(sub.deps[newIndex[i]], newIndex[j])
+			}
+		}
+	}
+
+	return sub
+}
+
+// walk calls fn for every provider in the graph, concurrently.
+// fn is called for a provider only after it has returned for all the providers the provider waits for.
+//
+// When reverse is false, a provider waits for its dependencies.
+// Otherwise, it waits for the providers that depend on it.
+//
+// When skipOnError is true, fn is not called for a provider if any of the providers it waits for
+// has failed or has been skipped. The skipped provider gets an error describing why.
+//
+// The returned slice contains the error for each provider, in the order of g.providers.
+func (g *providerGraph) walk(reverse, skipOnError bool, fn func(Provider) error) []error {
+	waitsFor := g.deps
+	if reverse {
+		waitsFor = make([][]int, len(g.providers))
+		for i, deps := range g.deps {
+			for _, j := range deps {
+				waitsFor[j] = append(waitsFor[j], i)
+			}
+		}
+	}
+
+	var (
+		errs = make([]error, len(g.providers))
+		done = make([]chan struct{}, len(g.providers))
+		wg   sync.WaitGroup
+	)
+
+	for i := range g.providers {
+		done[i] = make(chan struct{})
+	}
+
+	for i := range g.providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, j := range waitsFor[i] {
+				<-done[j]
+			}
+
+			if skipOnError {
+				for _, j := range waitsFor[i] {
+					if errs[j] != nil {
+						errs[i] = fmt.Errorf("skipped because provider %v failed", g.providers[j])
+						return
+					}
+				}
+			}
+
+			errs[i] = fn(g.providers[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,382 @@
+package testkit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mumoshu/testkit/internal/redact"
+)
+
+// EnvReportDir is the name of the environment variable that contains
+// the directory to write the run report into.
+const EnvReportDir = "TESTKIT_REPORT_DIR"
+
+// ReportDir makes the harness write the run report into dir when the cleanup finishes.
+//
+// The report is written as testkit-<run ID>.json, and as testkit-<run ID>.xml
+// that contains the same information as JUnit <properties>,
+// so that CI dashboards can show it along with the test results.
+func ReportDir(dir string) Option {
+	return func(tk *Config) {
+		tk.ReportDir = dir
+	}
+}
+
+// Report is the report of a run of the harness.
+type Report struct {
+	RunID      string    `json:"runID"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Providers lists the providers the harness tried to set up, in the configured order.
+	Providers []ProviderReport `json:"providers"`
+	// Resources lists the resources requested via the harness, in the requested order.
+	Resources []ResourceReport `json:"resources"`
+	// Retained lists the resources that have been left behind,
+	// either retained via RetainResources or RetainResourcesOnFailure, or failed to be deleted.
+	// The provider-specific attributes of the resources are omitted, as they may contain secrets.
+	Retained []JournalEntry `json:"retained,omitempty"`
+	// RetainedError is the error that occurred while reading the retained resources from the journal, if any.
+	RetainedError string `json:"retainedError,omitempty"`
+}
+
+// ProviderReport is the report of a provider.
+type ProviderReport struct {
+	// Name is the type of the provider, like "testkit.KindProvider".
+	Name    string  `json:"name"`
+	Setup   *Timing `json:"setup,omitempty"`
+	Cleanup *Timing `json:"cleanup,omitempty"`
+}
+
+// ResourceReport is the report of a resource requested via the harness.
+type ResourceReport struct {
+	// Kind is the kind of the resource, like "Kubernetes namespace".
+	Kind string `json:"kind"`
+	// Provider is the type of the provider that returned the resource.
+	// It's empty when no provider succeeded.
+	Provider string `json:"provider,omitempty"`
+	// Attributes are the fields of the resource, like the name of the bucket
+	// and the path to the kubeconfig.
+	// Fields that may contain secrets, like tokens, are omitted.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Timing
+}
+
+// Timing is the timing of an operation done by the harness.
+type Timing struct {
+	StartedAt time.Time `json:"startedAt"`
+	Seconds   float64   `json:"seconds"`
+	// Error is the error that occurred, if any.
+	Error string `json:"error,omitempty"`
+}
+
+func newTiming(start time.Time, err error) Timing {
+	t := Timing{
+		StartedAt: start,
+		Seconds:   time.Since(start).Seconds(),
+	}
+
+	if err != nil {
+		t.Error = err.Error()
+	}
+
+	return t
+}
+
+// reportRecorder records what the harness has done for the report.
+// It's shared between the harness and its child harnesses.
+//
+// The record methods are safe to call on a nil reportRecorder, in which case they do nothing.
+type reportRecorder struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	setup     map[Provider]Timing
+	cleanup   map[Provider]Timing
+	resources []ResourceReport
+}
+
+func newReportRecorder() *reportRecorder {
+	return &reportRecorder{
+		startedAt: time.Now(),
+		setup:     make(map[Provider]Timing),
+		cleanup:   make(map[Provider]Timing),
+	}
+}
+
+func (r *reportRecorder) recordSetup(p Provider, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setup[p] = newTiming(start, err)
+}
+
+func (r *reportRecorder) recordCleanup(p Provider, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cleanup[p] = newTiming(start, err)
+}
+
+func (r *reportRecorder) recordResource(kind string, res any, p Provider, start time.Time, err error) {
+	if r == nil {
+		return
+	}
+
+	rr := ResourceReport{
+		Kind:   kind,
+		Timing: newTiming(start, err),
+	}
+
+	if p != nil {
+		rr.Provider = providerName(p)
+	}
+
+	if err == nil {
+		rr.Attributes = resourceAttributes(res)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resources = append(r.resources, rr)
+}
+
+// Report returns the report of what the harness has done so far.
+func (tk *TestKit) Report() *Report {
+	if tk.parent != nil {
+		return tk.parent.Report()
+	}
+
+	r := tk.report
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{
+		RunID:      tk.RunID(),
+		StartedAt:  r.startedAt,
+		FinishedAt: time.Now(),
+		Resources:  append([]ResourceReport(nil), r.resources...),
+	}
+
+	if tk.setupGraph != nil {
+		for _, p := range tk.setupGraph.providers {
+			pr := ProviderReport{Name: providerName(p)}
+
+			if t, ok := r.setup[p]; ok {
+				pr.Setup = &t
+			}
+
+			if t, ok := r.cleanup[p]; ok {
+				pr.Cleanup = &t
+			}
+
+			report.Providers = append(report.Providers, pr)
+		}
+	}
+
+	entries, err := tk.journal.Entries()
+	if err != nil {
+		report.RetainedError = err.Error()
+	}
+
+	for _, e := range entries {
+		e.Attributes = nil
+		report.Retained = append(report.Retained, e)
+	}
+
+	return report
+}
+
+// writeReport writes the report into the report directory, if any.
+func (tk *TestKit) writeReport() error {
+	if tk.ReportDir == "" {
+		return nil
+	}
+
+	return tk.Report().Write(tk.ReportDir)
+}
+
+// Write writes the report into dir as testkit-<run ID>.json and testkit-<run ID>.xml.
+func (r *Report) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create report directory %s: %v", dir, err)
+	}
+
+	jsonData, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal report: %v", err)
+	}
+
+	xmlData, err := r.JUnit()
+	if err != nil {
+		return fmt.Errorf("unable to marshal report: %v", err)
+	}
+
+	base := filepath.Join(dir, "testkit-"+r.RunID)
+
+	if err := os.WriteFile(base+".json", append(jsonData, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write report: %v", err)
+	}
+
+	if err := os.WriteFile(base+".xml", xmlData, 0644); err != nil {
+		return fmt.Errorf("unable to write report: %v", err)
+	}
+
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName    xml.Name     `xml:"testsuites"`
+	TestSuites []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnit returns the report as a JUnit XML document with a test suite named "testkit",
+// whose <properties> contain the report.
+func (r *Report) JUnit() ([]byte, error) {
+	suite := junitSuite{
+		Name:      "testkit",
+		Time:      fmt.Sprintf("%.3f", r.FinishedAt.Sub(r.StartedAt).Seconds()),
+		Timestamp: r.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+	}
+
+	add := func(name, value string) {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "testkit." + name, Value: value})
+	}
+
+	add("runID", r.RunID)
+
+	for i, p := range r.Providers {
+		prefix := fmt.Sprintf("providers.%d.", i)
+
+		add(prefix+"name", p.Name)
+		if p.Setup != nil {
+			add(prefix+"setup", p.Setup.String())
+		}
+		if p.Cleanup != nil {
+			add(prefix+"cleanup", p.Cleanup.String())
+		}
+	}
+
+	for i, res := range r.Resources {
+		prefix := fmt.Sprintf("resources.%d.", i)
+
+		add(prefix+"kind", res.Kind)
+		if res.Provider != "" {
+			add(prefix+"provider", res.Provider)
+		}
+		for _, k := range sortedKeys(res.Attributes) {
+			add(prefix+k, res.Attributes[k])
+		}
+		add(prefix+"get", res.Timing.String())
+	}
+
+	for i, e := range r.Retained {
+		add(fmt.Sprintf("retained.%d", i), fmt.Sprintf("%s %s %s", e.Provider, e.Kind, e.Name))
+	}
+	if r.RetainedError != "" {
+		add("retained.error", r.RetainedError)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{TestSuites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// String returns the duration, followed by the error if any.
+func (t Timing) String() string {
+	s := fmt.Sprintf("%.3fs", t.Seconds)
+	if t.Error != "" {
+		s += " failed: " + t.Error
+	}
+	return s
+}
+
+func providerName(p Provider) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", p), "*")
+}
+
+// resourceAttributes returns the exported fields of the resource that have values
+// of basic types, except the ones that may contain secrets.
+func resourceAttributes(res any) map[string]string {
+	v := reflect.ValueOf(res)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	attrs := map[string]string{}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || redact.IsSecretName(f.Name) {
+			continue
+		}
+
+		fv := v.Field(i)
+
+		switch fv.Kind() {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if fv.IsZero() {
+				continue
+			}
+			attrs[f.Name] = fmt.Sprint(fv.Interface())
+		}
+	}
+
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	return attrs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package testkit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type reportTestProvider struct{}
+
+func (p *reportTestProvider) Setup() error   { return nil }
+func (p *reportTestProvider) Cleanup() error { return nil }
+
+func (p *reportTestProvider) GetSlackChannel(opts ...SlackChannelOption) (*SlackChannel, error) {
+	return &SlackChannel{ID: "testkit", BotToken: "xoxb-secret"}, nil
+}
+
+func (p *reportTestProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, error) {
+	return &S3Bucket{Name: "testkit-bucket", Region: "us-east-1"}, nil
+}
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv(EnvReportDir, dir)
+
+	tk, err := Build(Providers(&reportTestProvider{}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+
+	tk.S3Bucket(t)
+	tk.SlackChannel(t)
+
+	_, err = get[*EKSCluster, EKSClusterOption](tk, nil)
+	require.Error(t, err)
+
+	require.NoError(t, tk.journal.Record(JournalEntry{Provider: "kind", Kind: "cluster", Name: "testkit-abcd", Attributes: map[string]string{"password": "hunter2"}}))
+
+	require.Empty(t, tk.DoCleanup())
+
+	data, err := os.ReadFile(filepath.Join(dir, "testkit-"+tk.RunID()+".json"))
+	require.NoError(t, err)
+
+	var r Report
+	require.NoError(t, json.Unmarshal(data, &r))
+
+	require.Equal(t, tk.RunID(), r.RunID)
+	require.Len(t, r.Providers, 1)
+	require.Equal(t, "testkit.reportTestProvider", r.Providers[0].Name)
+	require.NotNil(t, r.Providers[0].Setup)
+	require.NotNil(t, r.Providers[0].Cleanup)
+
+	require.Len(t, r.Resources, 3)
+	require.Equal(t, "S3 bucket", r.Resources[0].Kind)
+	require.Equal(t, "testkit.reportTestProvider", r.Resources[0].Provider)
+	require.Equal(t, map[string]string{"Name": "testkit-bucket", "Region": "us-east-1"}, r.Resources[0].Attributes)
+	// Secrets are not reported.
+	require.Equal(t, map[string]string{"ID": "testkit"}, r.Resources[1].Attributes)
+	require.Equal(t, "EKS cluster", r.Resources[2].Kind)
+	require.Equal(t, "unable to get EKS cluster: none of the 1 providers succeeded", r.Resources[2].Error)
+
+	require.Len(t, r.Retained, 1)
+	require.Equal(t, "testkit-abcd", r.Retained[0].Name)
+	// The attributes of the retained resources are not reported, as they may contain secrets.
+	require.Nil(t, r.Retained[0].Attributes)
+	require.NotContains(t, string(data), "hunter2")
+	require.Empty(t, r.RetainedError)
+
+	xml, err := os.ReadFile(filepath.Join(dir, "testkit-"+tk.RunID()+".xml"))
+	require.NoError(t, err)
+	require.NotContains(t, string(xml), "xoxb-secret")
+
+	for _, s := range []string{
+		`<testsuite name="testkit"`,
+		`<property name="testkit.runID" value="` + tk.RunID() + `"></property>`,
+		`<property name="testkit.providers.0.name" value="testkit.reportTestProvider"></property>`,
+		`<property name="testkit.resources.0.Name" value="testkit-bucket"></property>`,
+		`<property name="testkit.retained.0" value="kind cluster testkit-abcd"></property>`,
+	} {
+		require.True(t, strings.Contains(string(xml), s), "%s does not contain %s", xml, s)
+	}
+}
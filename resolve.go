@@ -0,0 +1,102 @@
+package testkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+)
+
+// resolve returns the resource obtained from the first available provider that
+// implements P and successfully returns the resource via get,
+// along with the provider.
+//
+// Providers are tried in the order they were given to the harness.
+// When no provider succeeds, it returns a *testkiterror.E that lists
+// why each provider refused, along with a remediation.
+//
+// kind is the human-readable name of the resource, like "S3 bucket".
+func resolve[P any, R any](tk *TestKit, kind string, get func(P) (R, error)) (R, Provider, error) {
+	var (
+		zero    R
+		reasons []string
+	)
+
+	iface := reflect.TypeOf((*P)(nil)).Elem().Name()
+
+	for _, p := range tk.availableProviders {
+		cp, ok := p.(P)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%T: does not implement %s", p, iface))
+			continue
+		}
+
+		r, err := get(cp)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%T: %s", p, reason(err)))
+			continue
+		}
+
+		if reflect.ValueOf(&r).Elem().IsZero() {
+			reasons = append(reasons, fmt.Sprintf("%T: returned no %s", p, kind))
+			continue
+		}
+
+		return r, p, nil
+	}
+
+	if len(tk.availableProviders) == 0 {
+		reasons = append(reasons, "no provider is available")
+	}
+
+	return zero, nil, testkiterror.New(
+		fmt.Sprintf("unable to get %s: none of the %d providers succeeded", kind, len(tk.availableProviders)),
+		testkiterror.Long("Providers tried, in order:\n  - "+strings.Join(reasons, "\n  - ")),
+		testkiterror.Remediation(fmt.Sprintf(
+			"Add a provider that implements %s to the harness via testkit.Providers, "+
+				"or fix the errors reported by the providers above.",
+			iface,
+		)),
+	)
+}
+
+// reason describes why a provider refused to provide the resource.
+// The details and the remediation of a *testkiterror.E are indented under its short description.
+func reason(err error) string {
+	var e *testkiterror.E
+	if !errors.As(err, &e) {
+		return err.Error()
+	}
+
+	var b strings.Builder
+	b.WriteString(e.Short)
+
+	for _, s := range []string{e.Long, e.Remediation} {
+		if s == "" {
+			continue
+		}
+
+		for _, l := range strings.Split(s, "\n") {
+			b.WriteString("\n    ")
+			b.WriteString(l)
+		}
+	}
+
+	return b.String()
+}
+
+// fatal fails the test with the full diagnostic message when err is or wraps a *testkiterror.E.
+func fatal(t testing.TB, err error) {
+	t.Helper()
+
+	var e *testkiterror.E
+	if errors.As(err, &e) {
+		t.Fatalf("%s", e.String())
+		return
+	}
+
+	t.Fatalf("%v", err)
+}
@@ -0,0 +1,125 @@
+package testkit
+
+import (
+	"fmt"
+	"testing"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"github.com/stretchr/testify/require"
+)
+
+type failingS3BucketProvider struct {
+	Provider
+}
+
+func (p *failingS3BucketProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, error) {
+	return nil, fmt.Errorf("no credentials")
+}
+
+type emptyS3BucketProvider struct {
+	Provider
+}
+
+func (p *emptyS3BucketProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, error) {
+	return nil, nil
+}
+
+type staticS3BucketProvider struct {
+	Provider
+}
+
+func (p *staticS3BucketProvider) GetS3Bucket(opts ...S3BucketOption) (*S3Bucket, error) {
+	return &S3Bucket{Name: "bucket"}, nil
+}
+
+func TestResolve(t *testing.T) {
+	get := func(p S3BucketProvider) (*S3Bucket, error) {
+		return p.GetS3Bucket()
+	}
+
+	tk := &TestKit{availableProviders: []Provider{
+		&KubectlProvider{},
+		&failingS3BucketProvider{},
+		&emptyS3BucketProvider{},
+		&staticS3BucketProvider{},
+	}}
+
+	b, p, err := resolve(tk, "S3 bucket", get)
+	require.NoError(t, err)
+	require.Equal(t, "bucket", b.Name)
+	require.Same(t, tk.availableProviders[3], p)
+
+	tk.availableProviders = tk.availableProviders[:3]
+
+	_, _, err = resolve(tk, "S3 bucket", get)
+	require.EqualError(t, err, "unable to get S3 bucket: none of the 3 providers succeeded")
+
+	var e *testkiterror.E
+	require.ErrorAs(t, err, &e)
+	require.Contains(t, e.String(), `│ Providers tried, in order:
+│   - *testkit.KubectlProvider: does not implement S3BucketProvider
+│   - *testkit.failingS3BucketProvider: no credentials
+│   - *testkit.emptyS3BucketProvider: returned no S3 bucket
+`)
+}
+
+func TestGet_TypedOptions(t *testing.T) {
+	tk, err := Build(Providers(&reportTestProvider{}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	// The provider returns a fresh copy of the same bucket on each call, which is tracked only once.
+	// The function literal is accepted as an S3BucketOption.
+	a := Get[*S3Bucket](tk, t, func(c *S3BucketConfig) { c.ID = "bucket" })
+	b := Get[*S3Bucket, S3BucketOption](tk, t)
+	require.NotSame(t, a, b)
+	require.Len(t, tk.resources, 1)
+
+	_, err = get[*S3Bucket, SlackChannelOption](tk, nil)
+	require.EqualError(t, err, "unable to get S3 bucket: the options are testkit.S3BucketOption, not testkit.SlackChannelOption")
+}
+
+type trackTestResource struct {
+	name string
+}
+
+func TestTrack(t *testing.T) {
+	tk, err := Build(Providers(&reportTestProvider{}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	p := tk.Providers[0]
+
+	// Copies of a keyed resource are tracked once, even with fresh clients in them.
+	tk.track("Slack channel", &SlackChannel{ID: "a", SlackMessaging: NewSlackMessagingClient("xoxb", "a")}, p)
+	tk.track("Slack channel", &SlackChannel{ID: "a", SlackMessaging: NewSlackMessagingClient("xoxb", "a")}, p)
+	tk.track("Slack channel", &SlackChannel{ID: "b"}, p)
+
+	// Other resources are tracked once per address.
+	r := &trackTestResource{name: "a"}
+	tk.track("test", r, p)
+	tk.track("test", r, p)
+	tk.track("test", &trackTestResource{name: "a"}, p)
+
+	require.Len(t, tk.resources, 4)
+}
+
+// fatalRecorder records the message of Fatalf instead of failing the test.
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.msg = fmt.Sprintf(format, args...)
+}
+
+func TestFatal_WrappedError(t *testing.T) {
+	e := testkiterror.New("no S3 bucket is available", testkiterror.Remediation("Add a provider of S3 buckets."))
+
+	var r fatalRecorder
+	fatal(&r, fmt.Errorf("unable to get S3 bucket: %w", e))
+	require.Equal(t, e.String(), r.msg)
+}
@@ -11,33 +11,25 @@ type ChatworkRoom struct {
 	Token string
 }
 
+// ResourceKey returns the ID of the room, which identifies it among the copies returned by the provider.
+func (r *ChatworkRoom) ResourceKey() string {
+	return r.ID
+}
+
 type ChatworkRoomConfig struct {
 	ID string
 }
 
 type ChatworkRoomOption func(*ChatworkRoomConfig)
 
+func init() {
+	RegisterResourceKind("Chatwork room", ChatworkRoomProvider.GetChatworkRoom)
+}
+
+// ChatworkRoom returns a Chatwork room from the first available provider that succeeds.
+// It fails the test with the reason reported by each provider if none succeeds.
 func (tk *TestKit) ChatworkRoom(t *testing.T, opts ...ChatworkRoomOption) *ChatworkRoom {
 	t.Helper()
 
-	var cp ChatworkRoomProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(ChatworkRoomProvider)
-		if ok {
-			break
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no ChatworkRoomProvider found")
-	}
-
-	r, err := cp.GetChatworkRoom(opts...)
-	if err != nil {
-		t.Fatalf("unable to get Chatwork room: %v", err)
-	}
-
-	return r
+	return Get[*ChatworkRoom](tk, t, opts...)
 }
@@ -36,6 +36,11 @@ type ECRImageRepository struct {
 	RegistryID string `json:"registry_id"`
 }
 
+// ResourceKey returns the ARN of the repository, which identifies it among the copies returned by the provider.
+func (r *ECRImageRepository) ResourceKey() string {
+	return r.ARN
+}
+
 // ECRImageRepositoryOptions is the options for creating an ECR image repository.
 // The zero value is a valid value.
 type ECRImageRepositoryConfig struct {
@@ -48,28 +53,16 @@ type ECRImageRepositoryConfig struct {
 
 type ECRImageRepositoryOption func(*ECRImageRepositoryConfig)
 
+func init() {
+	RegisterResourceKind("ECR image repository", ECRImageRepositoryProvider.GetECRImageRepository)
+}
+
 // ECRImageRepository creates an ECR image repository.
+//
+// It falls back to the next available provider when a provider fails or returns nothing,
+// and fails the test with the reason reported by each provider if none succeeds.
 func (tk *TestKit) ECRImageRepository(t *testing.T, opts ...ECRImageRepositoryOption) *ECRImageRepository {
 	t.Helper()
 
-	var cp ECRImageRepositoryProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(ECRImageRepositoryProvider)
-		if ok {
-			break
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no ECRImageRepositoryProvider found")
-	}
-
-	ecrImageRepository, err := cp.GetECRImageRepository(opts...)
-	if err != nil {
-		t.Fatalf("unable to get ecr image repository: %v", err)
-	}
-
-	return ecrImageRepository
+	return Get[*ECRImageRepository](tk, t, opts...)
 }
@@ -19,6 +19,11 @@ type EKSCluster struct {
 	KubeconfigPath string
 }
 
+// ResourceKey returns the endpoint of the cluster, which identifies it among the copies returned by the provider.
+func (c *EKSCluster) ResourceKey() string {
+	return c.Endpoint
+}
+
 // EKSClusterOptions is the options for creating an EKS cluster.
 // The zero value is a valid value.
 type EKSClusterConfig struct {
@@ -31,28 +36,16 @@ type EKSClusterConfig struct {
 
 type EKSClusterOption func(*EKSClusterConfig)
 
+func init() {
+	RegisterResourceKind("EKS cluster", EKSClusterProvider.GetEKSCluster)
+}
+
 // EKSCluster creates an EKS cluster.
+//
+// It falls back to the next available provider when a provider fails or returns nothing,
+// and fails the test with the reason reported by each provider if none succeeds.
 func (tk *TestKit) EKSCluster(t *testing.T, opts ...EKSClusterOption) *EKSCluster {
 	t.Helper()
 
-	var cp EKSClusterProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(EKSClusterProvider)
-		if ok {
-			break
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no EKSClusterProvider found")
-	}
-
-	eksCluster, err := cp.GetEKSCluster(opts...)
-	if err != nil {
-		t.Fatalf("unable to get eks cluster: %v", err)
-	}
-
-	return eksCluster
+	return Get[*EKSCluster](tk, t, opts...)
 }
@@ -21,12 +21,21 @@ type GitHubRepository struct {
 	Token string
 }
 
+// ResourceKey returns the name of the repository, which identifies it among the copies returned by the provider.
+func (r *GitHubRepository) ResourceKey() string {
+	return r.Name
+}
+
 type GitHubRepositoryConfig struct {
 	ID string
 }
 
 type GitHubRepositoryOption func(*GitHubRepositoryConfig)
 
+func init() {
+	RegisterResourceKind("GitHub repository", GitHubRepositoryProvider.GetGitHubRepository)
+}
+
 // GitHubRepository creates a GitHub repository.
 // The repository is created by the provider implementation.
 // The provider implementation may create a new repository,
@@ -40,25 +49,5 @@ type GitHubRepositoryOption func(*GitHubRepositoryConfig)
 func (tk *TestKit) GitHubRepository(t *testing.T, opts ...GitHubRepositoryOption) *GitHubRepository {
 	t.Helper()
 
-	var cp GitHubRepositoryProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(GitHubRepositoryProvider)
-		if ok {
-			ghRepo, err := cp.GetGitHubRepository(opts...)
-			if err != nil {
-				t.Logf("unable to get GitHub repository: %v", err)
-				continue
-			}
-
-			return ghRepo
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no GitHubRepositoryProvider found")
-	}
-
-	return nil
+	return Get[*GitHubRepository](tk, t, opts...)
 }
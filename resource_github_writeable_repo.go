@@ -27,12 +27,21 @@ type GitHubWritableRepository struct {
 	git.Service
 }
 
+// ResourceKey returns the name of the repository, which identifies it among the copies returned by the provider.
+func (r *GitHubWritableRepository) ResourceKey() string {
+	return r.Name
+}
+
 type GitHubWritableRepositoryConfig struct {
 	ID string
 }
 
 type GitHubWritableRepositoryOption func(*GitHubWritableRepositoryConfig)
 
+func init() {
+	RegisterResourceKind("writable GitHub repository", GitHubWritableRepositoriesProvider.GetGitHubWritableRepository)
+}
+
 // GitHubWritableRepository retrieves a writable GitHub repository.
 //
 // It iterates over the available providers and calls the GetGitHubWritableRepository method on each provider.
@@ -42,25 +51,5 @@ type GitHubWritableRepositoryOption func(*GitHubWritableRepositoryConfig)
 func (tk *TestKit) GitHubWritableRepository(t *testing.T, opts ...GitHubWritableRepositoryOption) *GitHubWritableRepository {
 	t.Helper()
 
-	var cp GitHubWritableRepositoriesProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(GitHubWritableRepositoriesProvider)
-		if ok {
-			ghRepo, err := cp.GetGitHubWritableRepository(opts...)
-			if err != nil {
-				t.Logf("unable to get GitHub writable repository: %v", err)
-				continue
-			}
-
-			return ghRepo
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no GitHubWritableRepositoriesProvider found")
-	}
-
-	return nil
+	return Get[*GitHubWritableRepository](tk, t, opts...)
 }
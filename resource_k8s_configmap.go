@@ -13,10 +13,19 @@ type KubernetesConfigMap struct {
 	Name      string
 }
 
+// ResourceKey returns the namespace and the name of the ConfigMap, which identifies it among the copies returned by the provider.
+func (c *KubernetesConfigMap) ResourceKey() string {
+	return c.Namespace + "/" + c.Name
+}
+
 type KubernetesConfigMapConfig struct {
 	ID             string
 	Namespace      string
 	KubeconfigPath string
+
+	// Scope separates the ConfigMaps created for different child harnesses returned by TestKit.Sub.
+	// ConfigMaps with the same ID are memoized per scope.
+	Scope string
 }
 
 type KubernetesConfigMapOption func(*KubernetesConfigMapConfig)
@@ -33,6 +42,10 @@ func KubernetesConfigMapNamespace(namespace string) KubernetesConfigMapOption {
 	}
 }
 
+func init() {
+	RegisterResourceKind("Kubernetes ConfigMap", KubernetesConfigMapProvider.KubernetesConfigMap)
+}
+
 // KubernetesConfigMap returns a KubernetesConfigMap.
 // It does so by iterating over the available providers and calling the KubernetesConfigMap method on each provider.
 // If no provider implements KubernetesConfigMap, it fails the test.
@@ -41,25 +54,5 @@ func KubernetesConfigMapNamespace(namespace string) KubernetesConfigMapOption {
 func (tk *TestKit) KubernetesConfigMap(t *testing.T, opts ...KubernetesConfigMapOption) *KubernetesConfigMap {
 	t.Helper()
 
-	var cp KubernetesConfigMapProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(KubernetesConfigMapProvider)
-		if ok {
-			ns, err := cp.KubernetesConfigMap(opts...)
-			if err != nil {
-				t.Logf("unable to get configmap: %v", err)
-				continue
-			}
-
-			return ns
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no KubernetesConfigMapProvider found")
-	}
-
-	return nil
+	return Get[*KubernetesConfigMap](tk, t, opts...)
 }
@@ -0,0 +1,121 @@
+package testkit
+
+import "testing"
+
+// KubernetesManifestProvider is a provider that can apply a manifest of Kubernetes objects.
+// Any provider that can apply and delete arbitrary Kubernetes objects should implement this interface.
+type KubernetesManifestProvider interface {
+	KubernetesManifest(opts ...KubernetesManifestOption) (*KubernetesManifest, error)
+}
+
+// KubernetesManifest is a manifest applied to a cluster.
+type KubernetesManifest struct {
+	// Objects are the objects applied, in the order they were applied.
+	Objects []KubernetesObjectRef
+}
+
+// KubernetesObjectRef identifies an object applied as a part of a KubernetesManifest.
+type KubernetesObjectRef struct {
+	APIVersion string
+	Kind       string
+	// Namespace is empty for cluster-scoped objects.
+	Namespace string
+	Name      string
+}
+
+func (r KubernetesObjectRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + " " + r.Name
+	}
+
+	return r.Kind + " " + r.Namespace + "/" + r.Name
+}
+
+type KubernetesManifestConfig struct {
+	KubeconfigPath string
+
+	// Namespace is the namespace of the namespaced objects that do not specify one.
+	// Defaults to the namespace of the kubeconfig context.
+	// It's also available to the templates as {{ .Namespace }}.
+	Namespace string
+
+	// Sources are the sources of the manifest, concatenated in order.
+	Sources []KubernetesManifestSource
+}
+
+// KubernetesManifestSource is a part of a manifest, either YAML or a Go template of YAML.
+type KubernetesManifestSource struct {
+	// Path is the path to the file containing the manifest.
+	Path string
+	// Content is the manifest itself, used when Path is empty.
+	Content string
+
+	// Template makes the manifest rendered as a Go template with Vars
+	// and the namespace as .Namespace, before being applied.
+	Template bool
+	Vars     map[string]any
+}
+
+type KubernetesManifestOption func(*KubernetesManifestConfig)
+
+func KubernetesManifestKubeconfigPath(path string) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		c.KubeconfigPath = path
+	}
+}
+
+func KubernetesManifestNamespace(namespace string) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		c.Namespace = namespace
+	}
+}
+
+// KubernetesManifestFiles adds the YAML files to the manifest.
+func KubernetesManifestFiles(paths ...string) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		for _, path := range paths {
+			c.Sources = append(c.Sources, KubernetesManifestSource{Path: path})
+		}
+	}
+}
+
+// KubernetesManifestYAML adds the YAML to the manifest.
+func KubernetesManifestYAML(yaml string) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		c.Sources = append(c.Sources, KubernetesManifestSource{Content: yaml})
+	}
+}
+
+// KubernetesManifestTemplate adds the YAML rendered from the Go template with the variables to the manifest.
+// The namespace given via KubernetesManifestNamespace is available as {{ .Namespace }},
+// unless vars has its own Namespace.
+func KubernetesManifestTemplate(tmpl string, vars map[string]any) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		c.Sources = append(c.Sources, KubernetesManifestSource{Content: tmpl, Template: true, Vars: vars})
+	}
+}
+
+// KubernetesManifestTemplateFile is KubernetesManifestTemplate for a template in a file.
+func KubernetesManifestTemplateFile(path string, vars map[string]any) KubernetesManifestOption {
+	return func(c *KubernetesManifestConfig) {
+		c.Sources = append(c.Sources, KubernetesManifestSource{Path: path, Template: true, Vars: vars})
+	}
+}
+
+func init() {
+	RegisterResourceKind("Kubernetes manifest", KubernetesManifestProvider.KubernetesManifest)
+}
+
+// KubernetesManifest applies a manifest and returns the applied objects.
+// It does so by iterating over the available providers and calling the KubernetesManifest method on each provider.
+// If no provider implements KubernetesManifest, it fails the test.
+// If multiple providers implement KubernetesManifest, it returns the first successful one.
+// If multiple providers implement KubernetesManifest and all of them fail, it fails the test.
+//
+// Unlike the other resources, manifests are not memoized.
+// Each call applies the manifest again, which updates the objects applied by the previous calls.
+func (tk *TestKit) KubernetesManifest(t *testing.T, opts ...KubernetesManifestOption) *KubernetesManifest {
+	t.Helper()
+
+	return Get[*KubernetesManifest](tk, t, opts...)
+}
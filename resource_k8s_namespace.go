@@ -12,9 +12,18 @@ type KubernetesNamespace struct {
 	Name string
 }
 
+// ResourceKey returns the name of the namespace, which identifies it among the copies returned by the provider.
+func (n *KubernetesNamespace) ResourceKey() string {
+	return n.Name
+}
+
 type KubernetesNamespaceConfig struct {
 	ID             string
 	KubeconfigPath string
+
+	// Scope separates the namespaces created for different child harnesses returned by TestKit.Sub.
+	// Namespaces with the same ID are memoized per scope.
+	Scope string
 }
 
 type KubernetesNamespaceOption func(*KubernetesNamespaceConfig)
@@ -25,6 +34,10 @@ func KubeconfigPath(path string) KubernetesNamespaceOption {
 	}
 }
 
+func init() {
+	RegisterResourceKind("Kubernetes namespace", KubernetesNamespaceProvider.KubernetesNamespace)
+}
+
 // KubernetesNamespace returns a KubernetesNamespace.
 // It does so by iterating over the available providers and calling the KubernetesNamespace method on each provider.
 // If no provider implements KubernetesNamespace, it fails the test.
@@ -33,25 +46,5 @@ func KubeconfigPath(path string) KubernetesNamespaceOption {
 func (tk *TestKit) KubernetesNamespace(t *testing.T, opts ...KubernetesNamespaceOption) *KubernetesNamespace {
 	t.Helper()
 
-	var cp KubernetesNamespaceProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(KubernetesNamespaceProvider)
-		if ok {
-			ns, err := cp.KubernetesNamespace(opts...)
-			if err != nil {
-				t.Logf("unable to get s3 bucket: %v", err)
-				continue
-			}
-
-			return ns
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no KubernetesNamespaceProvider found")
-	}
-
-	return nil
+	return Get[*KubernetesNamespace](tk, t, opts...)
 }
@@ -0,0 +1,270 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	testkiterror "github.com/mumoshu/testkit/error"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// resourceKind is a kind of resources registered via RegisterResourceKind.
+type resourceKind struct {
+	// name is the human-readable name of the kind, like "S3 bucket".
+	name string
+	// optionType is the type of the options of the kind, like S3BucketOption.
+	optionType reflect.Type
+	// get resolves the resource from the available providers of the harness.
+	// opts is the slice of the options of optionType.
+	// It returns the provider that returned the resource as well.
+	get func(tk *TestKit, opts any) (any, Provider, error)
+}
+
+// resourceKinds maps the type of the resource to its kind.
+var resourceKinds struct {
+	mu    sync.RWMutex
+	kinds map[reflect.Type]*resourceKind
+}
+
+// RegisterResourceKind registers a kind of resources of type T,
+// so that the resources can be obtained via Get.
+//
+// name is the human-readable name of the kind, like "S3 bucket".
+// get obtains the resource from a provider implementing P.
+// It's typically a method expression of the provider interface:
+//
+//	type MyQueueProvider interface {
+//		GetMyQueue(opts ...MyQueueOption) (*MyQueue, error)
+//	}
+//
+//	func init() {
+//		testkit.RegisterResourceKind("my queue", MyQueueProvider.GetMyQueue)
+//	}
+//
+// Like the built-in kinds, the resource is obtained from the first available provider
+// that implements P and returns the resource without an error.
+//
+// It panics if a kind of resources of type T is already registered,
+// as it's a programming error.
+func RegisterResourceKind[T any, P any, O any](name string, get func(P, ...O) (T, error)) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	k := &resourceKind{
+		name:       name,
+		optionType: reflect.TypeOf((*O)(nil)).Elem(),
+		get: func(tk *TestKit, opts any) (any, Provider, error) {
+			typedOpts, _ := opts.([]O)
+
+			return resolve(tk, name, func(p P) (T, error) {
+				return get(p, typedOpts...)
+			})
+		},
+	}
+
+	resourceKinds.mu.Lock()
+	defer resourceKinds.mu.Unlock()
+
+	if _, ok := resourceKinds.kinds[typ]; ok {
+		panic(fmt.Sprintf("testkit: resource kind %v is already registered", typ))
+	}
+
+	if resourceKinds.kinds == nil {
+		resourceKinds.kinds = make(map[reflect.Type]*resourceKind)
+	}
+
+	resourceKinds.kinds[typ] = k
+}
+
+// Get returns the resource of type T from the first available provider that succeeds.
+// It fails the test with the reason reported by each provider if none succeeds.
+//
+// opts are the options of the kind of resources, like S3BucketOption for *S3Bucket.
+// O is inferred from opts. Without opts, specify it along with T, like Get[*S3Bucket, S3BucketOption](tk, t).
+//
+// The resource is tracked by the harness.
+// If it implements ResourceCleaner, it's cleaned up along with the harness,
+// before the providers are cleaned up.
+// If the harness is a child harness returned by Sub, and the provider of the resource
+// implements ResourceDeleter, the resource is deleted when the subtest finishes.
+func Get[T any, O any](tk *TestKit, t *testing.T, opts ...O) T {
+	t.Helper()
+
+	r, err := get[T](tk, opts)
+	if err != nil {
+		fatal(t, err)
+	}
+
+	return r
+}
+
+func get[T any, O any](tk *TestKit, opts []O) (T, error) {
+	var zero T
+
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	resourceKinds.mu.RLock()
+	k, ok := resourceKinds.kinds[typ]
+	resourceKinds.mu.RUnlock()
+
+	if !ok {
+		return zero, testkiterror.New(
+			fmt.Sprintf("unable to get %v: no resource kind is registered for the type", typ),
+			testkiterror.Remediation("Register the kind via testkit.RegisterResourceKind, typically in an init function of the package that defines the type."),
+		)
+	}
+
+	// Options of an unnamed type, like a function literal, are converted to the named type of the kind.
+	if optionType := reflect.TypeOf((*O)(nil)).Elem(); !optionType.AssignableTo(k.optionType) {
+		return zero, testkiterror.New(
+			fmt.Sprintf("unable to get %s: the options are %v, not %v", k.name, k.optionType, optionType),
+			testkiterror.Remediation(fmt.Sprintf("Pass the options of type %v, like testkit.Get[%v, %v](tk, t, opts...).", k.optionType, typ, k.optionType)),
+		)
+	}
+
+	kindOpts := reflect.MakeSlice(reflect.SliceOf(k.optionType), 0, len(opts))
+	for i := range opts {
+		kindOpts = reflect.Append(kindOpts, reflect.ValueOf(&opts[i]).Elem().Convert(k.optionType))
+	}
+
+	start := time.Now()
+	_, span := startSpan(trace.ContextWithSpan(context.Background(), tk.span), "get "+k.name)
+
+	r, p, err := k.get(tk, kindOpts.Interface())
+
+	if p != nil {
+		span.SetAttributes(attribute.String("testkit.provider", providerName(p)))
+	}
+	if err == nil {
+		for name, v := range resourceAttributes(r) {
+			span.SetAttributes(attribute.String("testkit.resource."+name, v))
+		}
+	}
+	endSpan(span, err)
+
+	tk.report.recordResource(k.name, r, p, start, err)
+
+	if err != nil {
+		return zero, err
+	}
+
+	tk.track(k.name, r, p)
+
+	return r.(T), nil
+}
+
+// ResourceCleaner is implemented by resources that need to be cleaned up
+// by the harness, in addition to the cleanup done by their providers.
+type ResourceCleaner interface {
+	CleanupResource(ctx context.Context) error
+}
+
+// ResourceDeleter is implemented by providers that can delete a resource they returned
+// before the provider itself is cleaned up.
+// This allows child harnesses returned by Sub to delete the resources obtained in a subtest
+// when the subtest finishes.
+type ResourceDeleter interface {
+	// DeleteResource deletes the resource r returned by the provider.
+	// It does nothing if r has not been returned by the provider, or has already been deleted.
+	DeleteResource(ctx context.Context, r any) error
+}
+
+// KeyedResource is implemented by resources that identify themselves by a key,
+// so that the copies of the same resource returned by a provider are tracked by the harness only once.
+// Resources not implementing it are identified by their addresses.
+type KeyedResource interface {
+	// ResourceKey returns the key unique among the resources of the same kind returned by the provider.
+	ResourceKey() string
+}
+
+// trackedResource is a resource obtained via the harness.
+type trackedResource struct {
+	kind     string
+	resource any
+	// provider is the provider that returned the resource.
+	provider Provider
+}
+
+// trackedResourceKey identifies a tracked resource.
+type trackedResourceKey struct {
+	kind     string
+	provider Provider
+	// key is the ResourceKey of a KeyedResource, or the resource itself otherwise.
+	key any
+}
+
+// track records the resource obtained via the harness.
+// A resource returned more than once by the same provider, like a memoized one, is recorded only once.
+func (tk *TestKit) track(kind string, r any, p Provider) {
+	key := trackedResourceKey{kind: kind, provider: p, key: r}
+	if kr, ok := r.(KeyedResource); ok {
+		key.key = kr.ResourceKey()
+	} else if !reflect.TypeOf(r).Comparable() {
+		key.key = nil
+	}
+
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	if key.key != nil {
+		if tk.trackedKeys[key] {
+			return
+		}
+
+		if tk.trackedKeys == nil {
+			tk.trackedKeys = map[trackedResourceKey]bool{}
+		}
+		tk.trackedKeys[key] = true
+	}
+
+	tk.resources = append(tk.resources, trackedResource{kind: kind, resource: r, provider: p})
+}
+
+// cleanupResources cleans up the tracked resources implementing ResourceCleaner
+// in the reverse order they were obtained.
+// A child harness also deletes the resources via their providers implementing ResourceDeleter.
+func (tk *TestKit) cleanupResources(ctx context.Context) []error {
+	tk.mu.Lock()
+	resources := tk.resources
+	tk.resources = nil
+	tk.trackedKeys = nil
+	tk.mu.Unlock()
+
+	var errs []error
+
+	ctx = trace.ContextWithSpan(ctx, tk.span)
+
+	for i := len(resources) - 1; i >= 0; i-- {
+		tr := resources[i]
+
+		if c, ok := tr.resource.(ResourceCleaner); ok {
+			ctx, span := startSpan(ctx, "cleanup "+tr.kind)
+			err := c.CleanupResource(ctx)
+			endSpan(span, err)
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to cleanup %s: %v", tr.kind, err))
+			}
+		}
+
+		if tk.parent == nil {
+			continue
+		}
+
+		if d, ok := tr.provider.(ResourceDeleter); ok {
+			ctx, span := startSpan(ctx, "delete "+tr.kind)
+			err := d.DeleteResource(ctx, tr.resource)
+			endSpan(span, err)
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete %s: %v", tr.kind, err))
+			}
+		}
+	}
+
+	return errs
+}
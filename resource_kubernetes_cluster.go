@@ -8,14 +8,37 @@ import (
 type KubernetesCluster struct {
 	// KubeconfigPath is the path to the kubeconfig file.
 	KubeconfigPath string
+	// Name is the name of the cluster, if the provider names it, like the name of a kind cluster.
+	Name string
+	// Registry is the host and the port of the registry that the cluster pulls images from, like "localhost:5001",
+	// if the provider runs one, like KindProvider with LocalRegistry.
+	// Images pushed to Registry from the host can be referenced from the manifests as Registry + "/" + repository.
+	Registry string
+}
+
+// ResourceKey returns the kubeconfig and the name of the cluster, which identifies it among the copies returned by the provider.
+func (c *KubernetesCluster) ResourceKey() string {
+	return c.KubeconfigPath + "/" + c.Name
 }
 
 type KubernetesClusterConfig struct {
 	ID string
+	// Version is the Kubernetes version of the cluster, like "v1.29" or "v1.29.2".
+	// Defaults to the version chosen by the provider.
+	// Providers that cannot choose the version fail to provide the cluster when it's set.
+	Version string
 }
 
 type KubernetesClusterOption func(*KubernetesClusterConfig)
 
+// KubernetesVersion makes the provider create or reuse the cluster of the Kubernetes version.
+// See KubernetesClusterConfig.Version.
+func KubernetesVersion(version string) KubernetesClusterOption {
+	return func(c *KubernetesClusterConfig) {
+		c.Version = version
+	}
+}
+
 type KubernetesClusterProvider interface {
 	GetKubernetesCluster(...KubernetesClusterOption) (*KubernetesCluster, error)
 }
@@ -38,18 +61,14 @@ func (tk *TestKit) KubernetesClusterProvider() (KubernetesClusterProvider, error
 	return cp, nil
 }
 
+func init() {
+	RegisterResourceKind("Kubernetes cluster", KubernetesClusterProvider.GetKubernetesCluster)
+}
+
+// KubernetesCluster returns a Kubernetes cluster from the first available provider that succeeds.
+// It fails the test with the reason reported by each provider if none succeeds.
 func (tk *TestKit) KubernetesCluster(t *testing.T, opts ...KubernetesClusterOption) *KubernetesCluster {
 	t.Helper()
 
-	cp, err := tk.KubernetesClusterProvider()
-	if err != nil {
-		t.Fatalf("unable to get kubernetes cluster provider: %v", err)
-	}
-
-	kc, err := cp.GetKubernetesCluster(opts...)
-	if err != nil {
-		t.Fatalf("unable to get kubernetes cluster: %v", err)
-	}
-
-	return kc
+	return Get[*KubernetesCluster](tk, t, opts...)
 }
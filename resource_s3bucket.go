@@ -12,33 +12,25 @@ type S3Bucket struct {
 	Region, profile, Name string
 }
 
+// ResourceKey returns the region and the name of the bucket, which identifies it among the copies returned by the provider.
+func (b *S3Bucket) ResourceKey() string {
+	return b.Region + "/" + b.Name
+}
+
 type S3BucketConfig struct {
 	ID string
 }
 
 type S3BucketOption func(*S3BucketConfig)
 
+func init() {
+	RegisterResourceKind("S3 bucket", S3BucketProvider.GetS3Bucket)
+}
+
+// S3Bucket returns an S3 bucket from the first available provider that succeeds.
+// It fails the test with the reason reported by each provider if none succeeds.
 func (tk *TestKit) S3Bucket(t *testing.T, opts ...S3BucketOption) *S3Bucket {
 	t.Helper()
 
-	var cp S3BucketProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(S3BucketProvider)
-		if ok {
-			break
-		}
-	}
-
-	if cp == nil {
-		t.Fatal("no S3BucketProvider found")
-	}
-
-	s3Bucket, err := cp.GetS3Bucket(opts...)
-	if err != nil {
-		t.Fatalf("unable to get s3 bucket: %v", err)
-	}
-
-	return s3Bucket
+	return Get[*S3Bucket](tk, t, opts...)
 }
@@ -16,35 +16,34 @@ type SlackChannel struct {
 	SlackMessaging
 }
 
+// ResourceKey returns the ID of the channel, which identifies it among the copies returned by the provider.
+func (c *SlackChannel) ResourceKey() string {
+	return c.ID
+}
+
 type SlackChannelConfig struct {
 	ID string
 }
 
 type SlackChannelOption func(*SlackChannelConfig)
 
-func (tk *TestKit) SlackChannel(t *testing.T, opts ...SlackChannelOption) *SlackChannel {
-	t.Helper()
-
-	var cp SlackChannelProvider
-	for _, p := range tk.availableProviders {
-		var ok bool
-
-		cp, ok = p.(SlackChannelProvider)
-		if ok {
-			break
+func init() {
+	RegisterResourceKind("Slack channel", func(p SlackChannelProvider, opts ...SlackChannelOption) (*SlackChannel, error) {
+		slackCh, err := p.GetSlackChannel(opts...)
+		if err != nil || slackCh == nil {
+			return slackCh, err
 		}
-	}
 
-	if cp == nil {
-		t.Fatal("no SlackChannelProvider found")
-	}
+		slackCh.SlackMessaging = NewSlackMessagingClient(slackCh.BotToken, slackCh.ID)
 
-	slackCh, err := cp.GetSlackChannel(opts...)
-	if err != nil {
-		t.Fatalf("unable to get Slack channel: %v", err)
-	}
+		return slackCh, nil
+	})
+}
 
-	slackCh.SlackMessaging = NewSlackMessagingClient(slackCh.BotToken, slackCh.ID)
+// SlackChannel returns a Slack channel from the first available provider that succeeds.
+// It fails the test with the reason reported by each provider if none succeeds.
+func (tk *TestKit) SlackChannel(t *testing.T, opts ...SlackChannelOption) *SlackChannel {
+	t.Helper()
 
-	return slackCh
+	return Get[*SlackChannel](tk, t, opts...)
 }
@@ -3,6 +3,7 @@ package testkit
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"testing"
 
@@ -62,17 +63,40 @@ func (c *S3BucketClient) GetString(t *testing.T, key string) string {
 func (c *S3BucketClient) GetLatestString(t *testing.T, prefix string) string {
 	t.Helper()
 
+	s, err := c.getLatestString(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// EventuallyLatestString polls the content of the latest object in the bucket with the given prefix
+// until ok accepts it, and returns it.
+// It fails the test if ok does not accept it within the timeout,
+// reporting the last content observed, or the last error, like that no object is found yet.
+// A nil ok accepts the content of any object, which is useful to wait for an object to be created.
+// See Eventually for the options.
+func (c *S3BucketClient) EventuallyLatestString(t *testing.T, prefix string, ok func(string) bool, opts ...PollOption) string {
+	t.Helper()
+
+	return EventuallyValue(t, func(ctx context.Context) (string, error) {
+		return c.getLatestString(ctx, prefix)
+	}, ok, opts...)
+}
+
+func (c *S3BucketClient) getLatestString(ctx context.Context, prefix string) (string, error) {
 	listObjInput := &s3.ListObjectsV2Input{
 		Bucket: &c.Bucket,
 		Prefix: aws.String(prefix),
 	}
-	o, err := c.S3Svc.ListObjectsV2(context.Background(), listObjInput)
+	o, err := c.S3Svc.ListObjectsV2(ctx, listObjInput)
 	if err != nil {
-		t.Fatal(err)
+		return "", err
 	}
 
 	if len(o.Contents) == 0 {
-		t.Fatalf("no object found with prefix %q", prefix)
+		return "", fmt.Errorf("no object found with prefix %q", prefix)
 	}
 
 	var latestObj *s3types.Object
@@ -101,14 +125,18 @@ func (c *S3BucketClient) GetLatestString(t *testing.T, prefix string) string {
 		Bucket: &c.Bucket,
 		Key:    latestObj.Key,
 	}
-	obj, err := c.S3Svc.GetObject(context.Background(), getObjInput)
+	obj, err := c.S3Svc.GetObject(ctx, getObjInput)
 	if err != nil {
-		t.Fatal(err)
+		return "", err
 	}
+	defer obj.Body.Close()
+
 	got, err := io.ReadAll(obj.Body)
-	require.NoError(t, err)
+	if err != nil {
+		return "", err
+	}
 
-	return string(got)
+	return string(got), nil
 }
 
 // ListKeys returns the keys of the objects in the bucket with the given prefix.
@@ -0,0 +1,52 @@
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSub(t *testing.T) {
+	commands := fakeCommand(t, "kubectl", "")
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, nil, 0644))
+
+	tk, err := Build(Providers(&KubectlProvider{DefaultKubeconfigPath: kubeconfig}), JournalDir(t.TempDir()))
+	require.NoError(t, err)
+	defer tk.DoCleanup()
+
+	shared := tk.KubernetesNamespace(t)
+
+	var a, b string
+
+	t.Run("a", func(t *testing.T) {
+		sub := tk.Sub(t)
+
+		a = sub.KubernetesNamespace(t).Name
+		require.Equal(t, a, sub.KubernetesNamespace(t).Name)
+		require.NotEqual(t, shared.Name, a)
+	})
+
+	require.Contains(t, commands(), "delete namespace "+a+" --wait=false")
+
+	t.Run("b", func(t *testing.T) {
+		b = tk.Sub(t).KubernetesNamespace(t).Name
+		require.NotEqual(t, a, b)
+	})
+
+	require.Contains(t, commands(), "delete namespace "+b+" --wait=false")
+	require.NotContains(t, commands(), "delete namespace "+shared.Name+" --wait=false")
+
+	// The namespace obtained via the parent harness is still memoized.
+	require.Equal(t, shared.Name, tk.KubernetesNamespace(t).Name)
+
+	require.Empty(t, tk.DoCleanup())
+	require.Contains(t, commands(), "delete namespace "+shared.Name+" --wait=false")
+
+	entries, err := tk.journal.Entries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
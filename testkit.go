@@ -21,25 +21,120 @@ package testkit
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TestKit struct {
 	Config
 
 	availableProviders []Provider
+
+	// providerGraph is the dependency graph of the available providers.
+	providerGraph *providerGraph
+
+	// journal records the resources created by the providers in this run.
+	journal *Journal
+
+	// cancel cancels the context passed to the providers on setup.
+	cancel context.CancelFunc
+
+	// setupGraph is the dependency graph of all the providers the harness tried to set up.
+	setupGraph *providerGraph
+	// setupStarted is the list of providers whose setup has been started.
+	setupStarted []Provider
+	// setupDone is closed when the setup of the providers has finished.
+	setupDone chan struct{}
+	// resources is the list of resources obtained via the harness.
+	resources []trackedResource
+	// trackedKeys is the set of the keys of the resources in resources.
+	trackedKeys map[trackedResourceKey]bool
+	// failureHooks are the hooks registered via OnFailure.
+	failureHooks []func(context.Context) Artifact
+	// collectedArtifacts maps the providers whose artifacts have been collected on failure
+	// to the directories they were collected into. It's used only on the root harness,
+	// so that the artifacts of a provider shared by the child harnesses, like the logs of a whole cluster,
+	// are collected once per run.
+	collectedArtifacts map[Provider]string
+	mu                 sync.Mutex
+
+	// helmReleases are the releases installed via the Helm returned by Helm.
+	helmReleases helmReleases
+
+	// cleanupMu prevents an interrupt from cleaning up the harness
+	// while it's being cleaned up normally, and vice versa.
+	cleanupMu sync.Mutex
+	cleanedUp bool
+
+	// report records what the harness has done for the run report.
+	report *reportRecorder
+
+	// parent is the harness this child harness was created from via Sub.
+	// It's nil for the harnesses created via New or Build.
+	parent *TestKit
+
+	// span is the root span of the operations of the harness.
+	// It's shared between the harness and its child harnesses.
+	span trace.Span
+	// shutdownTracing flushes the spans and shuts down the tracer provider.
+	shutdownTracing func(context.Context) error
+	tracingDone     sync.Once
 }
 
 type Config struct {
 	Providers                []Provider
 	RetainResources          bool
 	RetainResourcesOnFailure bool
+
+	// Dependencies maps a provider to the providers it depends on,
+	// in addition to the ones returned by DependentProvider.DependsOn.
+	Dependencies map[Provider][]Provider
+
+	// JournalDir is the directory where the journal of the resources created
+	// by the providers is stored.
+	// Defaults to DefaultJournalDir().
+	JournalDir string
+
+	// ReuseRunID is the ID of a previous run whose retained resources
+	// the providers reattach to, instead of creating new ones.
+	// Resources created in this run are recorded into the journal of the same run.
+	ReuseRunID string
+
+	// ConfigFile is the path to the harness configuration file
+	// that configures the providers when Providers is empty.
+	// Defaults to the TESTKIT_CONFIG environment variable, or DefaultConfigFile if it exists.
+	ConfigFile string
+
+	// Profile is the name of the profile in the harness configuration file to use.
+	// Defaults to the TESTKIT_PROFILE environment variable.
+	Profile string
+
+	// ReportDir is the directory to write the run report into when the cleanup finishes.
+	// The report is not written when empty.
+	ReportDir string
+
+	// ArtifactDir is the directory to collect the artifacts of failed tests into.
+	// Defaults to DefaultArtifactDir().
+	ArtifactDir string
+
+	// OTLPEndpoint is the URL of the OTLP/HTTP endpoint to export the spans of the harness to.
+	// Defaults to the standard OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+	// environment variables. No span is exported when none is set.
+	OTLPEndpoint string
+
+	// TracerProvider is the tracer provider to emit the spans of the harness via.
+	// It takes precedence over OTLPEndpoint.
+	TracerProvider trace.TracerProvider
 }
 
 type Option func(*Config)
@@ -62,6 +157,37 @@ func Providers(providers ...Provider) Option {
 	}
 }
 
+// JournalDir sets the directory where the journal of the resources is stored.
+func JournalDir(dir string) Option {
+	return func(tk *Config) {
+		tk.JournalDir = dir
+	}
+}
+
+// Reuse makes the providers reattach to the resources retained by the run
+// identified by runID, instead of creating new ones.
+// The run ID of a run is logged when its resources are retained.
+func Reuse(runID string) Option {
+	return func(tk *Config) {
+		tk.ReuseRunID = runID
+	}
+}
+
+// DependsOn declares that the provider p depends on the providers deps.
+// This is useful when p does not implement DependentProvider,
+// or when the dependency is specific to your test.
+//
+// p is set up only after all deps have been set up,
+// and cleaned up before any of deps.
+func DependsOn(p Provider, deps ...Provider) Option {
+	return func(tk *Config) {
+		if tk.Dependencies == nil {
+			tk.Dependencies = make(map[Provider][]Provider)
+		}
+		tk.Dependencies[p] = append(tk.Dependencies[p], deps...)
+	}
+}
+
 // New creates a new TestKit harness.
 // It fails the test if it cannot create the TestKit.
 // It automatically cleans up all the resources created by the TestKit
@@ -75,15 +201,24 @@ func Providers(providers ...Provider) Option {
 //
 // If the Providers option is not empty, it uses the providers specified in the option.
 //
-// If providers is empty, it uses the default providers.
+// If providers is empty, it uses the providers configured in the harness configuration file,
+// testkit.yaml in the test package directory by default. See ConfigFile and Profile.
+//
+// If the configuration file does not exist either, it uses the default providers.
 // The default providers are the providers that are available
 // in the current environment.
 // Availability of a provider is determined by the Setup method.
 // If no provider is available, it fails the test.
+//
+// The setup of the providers and the commands run by them are bounded by the test deadline,
+// leaving some time before the deadline to clean up the resources.
 func New(t *testing.T, opts ...Option) *TestKit {
 	t.Helper()
 
-	tk, err := Build(opts...)
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	tk, err := BuildContext(ctx, opts...)
 	if err != nil {
 		t.Fatalf("failed to create TestKit: %v", err)
 	}
@@ -95,6 +230,59 @@ func New(t *testing.T, opts ...Option) *TestKit {
 	return tk
 }
 
+// Sub returns a child harness for the subtest t.
+//
+// The child harness shares the providers with tk, but tracks its own resources.
+// Resources like Kubernetes namespaces and ConfigMaps obtained via the child harness are
+// separate from the ones obtained via tk and other child harnesses, even if they have the same ID,
+// and are deleted when the subtest finishes.
+// Resources whose providers do not support deleting them individually, like Kubernetes clusters,
+// are shared with tk and are cleaned up along with tk.
+//
+// RetainResources and RetainResourcesOnFailure are respected per subtest.
+//
+//	for _, tc := range testcases {
+//		t.Run(tc.name, func(t *testing.T) {
+//			ns := tk.Sub(t).KubernetesNamespace(t)
+//			...
+//		})
+//	}
+func (tk *TestKit) Sub(t *testing.T) *TestKit {
+	t.Helper()
+
+	scope := t.Name()
+
+	providers := make([]Provider, 0, len(tk.availableProviders))
+	for _, p := range tk.availableProviders {
+		if sp, ok := p.(scopedProvider); ok {
+			p = sp.withScope(scope)
+		}
+		providers = append(providers, p)
+	}
+
+	child := &TestKit{
+		Config:             tk.Config,
+		availableProviders: providers,
+		journal:            tk.journal,
+		report:             tk.report,
+		parent:             tk,
+		span:               tk.span,
+	}
+
+	t.Cleanup(func() {
+		child.Cleanup(t)
+	})
+
+	return child
+}
+
+// scopedProvider is implemented by providers that can create resources
+// separate from the ones created for other child harnesses.
+type scopedProvider interface {
+	// withScope returns the view of the provider used by the child harness for the scope.
+	withScope(scope string) Provider
+}
+
 // Build creates a new TestKit harness.
 // This is a variant of New that does not automatically clean up the resources and
 // does not fail the test if it cannot create the TestKit.
@@ -111,11 +299,22 @@ func New(t *testing.T, opts ...Option) *TestKit {
 //		if err != nil {
 //			log.Fatalf("failed to create TestKit: %v", err)
 //		}
-//		defer tk.Cleanup()
+//		defer tk.DoCleanup()
 //
 //		os.Exit(m.Run())
 //	}
 func Build(opts ...Option) (*TestKit, error) {
+	return BuildContext(context.Background(), opts...)
+}
+
+// BuildContext is a variant of Build that bounds the setup of the providers by ctx.
+// The commands run by the providers after the setup, like the ones run to create
+// Kubernetes clusters and namespaces, are bounded by ctx as well.
+//
+// When the process receives SIGINT or SIGTERM before the harness is cleaned up,
+// the harness interrupts the commands in flight, cleans up the resources it has created so far,
+// respecting RetainResources and RetainResourcesOnFailure, and exits the process.
+func BuildContext(ctx context.Context, opts ...Option) (*TestKit, error) {
 	var conf Config
 
 	for _, opt := range opts {
@@ -131,51 +330,281 @@ func Build(opts ...Option) (*TestKit, error) {
 		if retainResourcesOnFailure, ok := os.LookupEnv("TESTKIT_RETAIN_RESOURCES_ON_FAILURE"); ok && retainResourcesOnFailure == "true" {
 			conf.RetainResourcesOnFailure = true
 		}
+
+		if runID := os.Getenv(EnvReuse); runID != "" {
+			conf.ReuseRunID = runID
+		}
+
+		if dir := os.Getenv(EnvReportDir); dir != "" {
+			conf.ReportDir = dir
+		}
+	}
+
+	if conf.JournalDir == "" {
+		conf.JournalDir = DefaultJournalDir()
 	}
 
 	if len(conf.Providers) == 0 {
-		var defaultProviders []Provider
-		if len(conf.Providers) > 0 {
-			defaultProviders = conf.Providers
-		} else {
-			defaultProviders = []Provider{
-				// TODO: Omit this when cluster.yaml does not exist
-				&EKSCTLProvider{},
-				// TODO: Omit this when the terraform workspace is not specified
-				&TerraformProvider{},
-				&EnvProvider{},
-			}
+		if err := loadConfigFile(&conf); err != nil {
+			return nil, err
 		}
+	}
+
+	runID := conf.ReuseRunID
+	if runID == "" {
+		runID = newRunID()
+	}
+
+	tp, shutdownTracing, err := newTracerProvider(ctx, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tp.Tracer(tracerName).Start(ctx, "testkit", trace.WithAttributes(attribute.String("testkit.run_id", runID)))
+	ctx = withRootSpan(ctx, span)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	tk := &TestKit{
+		Config:          conf,
+		journal:         OpenJournal(conf.JournalDir, runID),
+		cancel:          cancel,
+		setupDone:       make(chan struct{}),
+		report:          newReportRecorder(),
+		span:            span,
+		shutdownTracing: shutdownTracing,
+	}
+
+	// Start handling interrupts before setting up the providers,
+	// so that an interrupt in the middle of e.g. terraform apply still cleans up.
+	tk.handleInterrupts()
+
+	if err := tk.setup(ctx); err != nil {
+		tk.stopHandlingInterrupts()
+		tk.finishTracing(err)
+		return nil, err
+	}
+
+	return tk, nil
+}
+
+// setup sets up the providers and determines the available providers.
+func (tk *TestKit) setup(ctx context.Context) error {
+	defer close(tk.setupDone)
+
+	conf := &tk.Config
 
-		var providers []Provider
+	var g *providerGraph
 
-		for _, p := range defaultProviders {
-			if err := p.Setup(); err != nil {
+	if len(conf.Providers) == 0 {
+		defaultProviders := defaultProviders()
+
+		var err error
+		g, err = newProviderGraph(defaultProviders, conf.Dependencies)
+		if err != nil {
+			return err
+		}
+
+		tk.setupGraph = g
+
+		setJournal(defaultProviders, tk.journal, conf.ReuseRunID != "")
+
+		errs := g.walk(false, true, tk.setupProvider(ctx))
+
+		var providers, failed []Provider
+
+		for i, p := range defaultProviders {
+			if err := errs[i]; err != nil {
 				log.Printf("skipped setting up failed provider %v: %v", p, err)
+				failed = append(failed, p)
 				continue
 			}
 			providers = append(providers, p)
 		}
 
+		// A failed provider may have created resources before failing,
+		// and it is not cleaned up with the available providers.
+		tk.cleanupFailedProviders(ctx, g, failed)
+
 		if len(providers) == 0 {
-			return nil, fmt.Errorf("no provider out of the default providers is available")
+			return fmt.Errorf("no provider out of the default providers is available")
 		}
 
+		// Providers that depend on a failed provider are skipped as well,
+		// so the remaining providers never depend on a skipped one.
+		g = g.subgraph(func(p Provider) bool {
+			for _, q := range providers {
+				if p == q {
+					return true
+				}
+			}
+			return false
+		})
+
 		conf.Providers = providers
 	} else {
-		for _, p := range conf.Providers {
-			if err := p.Setup(); err != nil {
-				return nil, fmt.Errorf("failed to setup provider %v: %v", p, err)
+		var err error
+		g, err = newProviderGraph(conf.Providers, conf.Dependencies)
+		if err != nil {
+			return err
+		}
+
+		tk.setupGraph = g
+
+		setJournal(conf.Providers, tk.journal, conf.ReuseRunID != "")
+
+		errs := g.walk(false, true, tk.setupProvider(ctx))
+
+		var setupErrs []error
+		for i, err := range errs {
+			if err != nil {
+				setupErrs = append(setupErrs, fmt.Errorf("failed to setup provider %v: %w", conf.Providers[i], err))
 			}
 		}
+
+		if len(setupErrs) > 0 {
+			setupErrs = append(setupErrs, tk.cleanupAfterSetupFailure(ctx, g)...)
+			return errors.Join(setupErrs...)
+		}
 	}
 
-	tk := &TestKit{
-		Config:             conf,
-		availableProviders: conf.Providers,
+	tk.availableProviders = conf.Providers
+	tk.providerGraph = g
+
+	return nil
+}
+
+// cleanupAfterSetupFailure cleans up the providers whose setup has been started when the setup of a provider failed,
+// so that the resources they created do not leak.
+// This includes the providers whose setup failed or has been interrupted,
+// as they may have created resources before failing.
+func (tk *TestKit) cleanupAfterSetupFailure(ctx context.Context, g *providerGraph) []error {
+	tk.cleanupMu.Lock()
+	defer tk.cleanupMu.Unlock()
+
+	tk.cleanedUp = true
+
+	var cleanupErrs []error
+
+	if tk.CleanupNeeded(true) {
+		sub := tk.startedSubgraph(g)
+
+		// The cleanup is not bounded by ctx, which may have been canceled.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interruptCleanupTimeout)
+		defer cancel()
+
+		cleanupErrs = tk.cleanupProviders(ctx, sub)
+	} else {
+		log.Printf("testkit: retained resources recorded in run %s. Set %s=%s to reattach to them", tk.RunID(), EnvReuse, tk.RunID())
 	}
 
-	return tk, nil
+	if err := tk.writeReport(); err != nil {
+		cleanupErrs = append(cleanupErrs, err)
+	}
+
+	return cleanupErrs
+}
+
+// cleanupFailedProviders cleans up the providers out of failed whose setup has been started,
+// when the setup of the other providers may continue.
+// The cleaned up providers are no longer considered started, so they are not cleaned up again on interrupt.
+func (tk *TestKit) cleanupFailedProviders(ctx context.Context, g *providerGraph, failed []Provider) {
+	if len(failed) == 0 || !tk.CleanupNeeded(true) {
+		return
+	}
+
+	sub := tk.startedSubgraph(g).subgraph(func(p Provider) bool {
+		for _, q := range failed {
+			if p == q {
+				return true
+			}
+		}
+		return false
+	})
+
+	// The cleanup is not bounded by ctx, which may have been canceled.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interruptCleanupTimeout)
+	defer cancel()
+
+	for _, err := range tk.cleanupProviders(ctx, sub) {
+		log.Printf("testkit: %v", err)
+	}
+
+	cleaned := make(map[Provider]bool, len(sub.providers))
+	for _, p := range sub.providers {
+		cleaned[p] = true
+	}
+
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	var started []Provider
+	for _, p := range tk.setupStarted {
+		if !cleaned[p] {
+			started = append(started, p)
+		}
+	}
+	tk.setupStarted = started
+}
+
+// startedSubgraph returns the subgraph of g consisting of the providers whose setup has been started.
+func (tk *TestKit) startedSubgraph(g *providerGraph) *providerGraph {
+	tk.mu.Lock()
+	started := tk.setupStarted
+	tk.mu.Unlock()
+
+	return g.subgraph(func(p Provider) bool {
+		for _, q := range started {
+			if p == q {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// defaultEKSCTLConfigPath is the path to the eksctl config file
+// that enables EKSCTLProvider as a default provider.
+const defaultEKSCTLConfigPath = "cluster.yaml"
+
+// defaultProviders returns the providers used when neither Providers
+// nor the harness configuration file configures any provider.
+//
+// Providers that require settings, like TerraformProvider that requires the workspace,
+// are not included. Configure them via the harness configuration file instead.
+func defaultProviders() []Provider {
+	var providers []Provider
+
+	if _, err := os.Stat(defaultEKSCTLConfigPath); err == nil {
+		providers = append(providers, &EKSCTLProvider{ConfigPath: defaultEKSCTLConfigPath})
+	}
+
+	return append(providers, &EnvProvider{})
+}
+
+// setupProvider returns a function that sets up a provider,
+// recording that the setup has been started so that the provider is cleaned up on interrupt.
+func (tk *TestKit) setupProvider(ctx context.Context) func(Provider) error {
+	return func(p Provider) error {
+		tk.mu.Lock()
+		tk.setupStarted = append(tk.setupStarted, p)
+		tk.mu.Unlock()
+
+		start := time.Now()
+		ctx, span := startSpan(ctx, "setup "+providerName(p))
+
+		var err error
+		if cp, ok := p.(ContextProvider); ok {
+			err = cp.SetupContext(ctx)
+		} else {
+			err = p.Setup()
+		}
+
+		endSpan(span, err)
+		tk.report.recordSetup(p, start, err)
+
+		return err
+	}
 }
 
 // Cleanup cleans up all the resources created by the TestKit.
@@ -183,12 +612,53 @@ func Build(opts ...Option) (*TestKit, error) {
 // typically in a defer statement.
 // If the TestKit is created with the RetainResources option,
 // this function does nothing.
+//
+// The cleanup is bounded by the test deadline.
+//
+// If the test has failed, the artifacts are collected before the cleanup. See OnFailure.
 func (tk *TestKit) Cleanup(t *testing.T) {
+	if t.Failed() {
+		ctx, cancel := context.WithTimeout(context.Background(), artifactTimeout)
+		tk.collectArtifactsOnFailure(ctx, t)
+		cancel()
+	}
+
 	if !tk.CleanupNeeded(t.Failed()) {
+		if tk.parent != nil {
+			tk.mu.Lock()
+			n := len(tk.resources)
+			tk.mu.Unlock()
+
+			if n > 0 {
+				t.Logf("retained %d resources obtained in %s", n, t.Name())
+			}
+			return
+		}
+
+		tk.stopHandlingInterrupts()
+
+		if entries, _ := tk.journal.Entries(); len(entries) > 0 {
+			t.Logf("retained %d resources recorded in run %s. Set %s=%s to reattach to them", len(entries), tk.RunID(), EnvReuse, tk.RunID())
+		}
+
+		if err := tk.writeReport(); err != nil {
+			t.Logf("%v", err)
+		}
+
+		if err := tk.finishTracing(nil); err != nil {
+			t.Logf("%v", err)
+		}
 		return
 	}
 
-	errs := tk.DoCleanup()
+	ctx := context.Background()
+	if deadline, ok := t.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	errs := tk.DoCleanupContext(ctx)
 	for _, err := range errs {
 		t.Logf("%v", err)
 	}
@@ -199,18 +669,90 @@ func (tk *TestKit) Cleanup(t *testing.T) {
 // The caller should call this function at the end of the test.
 // Note that this function does not respect the RetainResources and RetainResourcesOnFailure options.
 // If you want to respect these options, use the Cleanup function instead.
+//
+// Resources obtained via Get that implement ResourceCleaner are cleaned up first,
+// in the reverse order they were obtained.
+// Providers are cleaned up in the reverse order of their dependencies.
+// Providers that do not depend on each other are cleaned up in parallel.
+// A failure to clean up a provider does not prevent the other providers from being cleaned up.
 func (tk *TestKit) DoCleanup() []error {
+	return tk.DoCleanupContext(context.Background())
+}
+
+// DoCleanupContext is a variant of DoCleanup that bounds the cleanup by ctx.
+//
+// For a child harness returned by Sub, it cleans up only the resources obtained via the child harness.
+func (tk *TestKit) DoCleanupContext(ctx context.Context) []error {
+	if tk.parent != nil {
+		return tk.cleanupResources(ctx)
+	}
+
+	defer tk.stopHandlingInterrupts()
+
+	tk.cleanupMu.Lock()
+	defer tk.cleanupMu.Unlock()
+
+	tk.cleanedUp = true
+
+	errs := tk.cleanupResources(ctx)
+	errs = append(errs, tk.cleanupProviders(ctx, tk.providerGraph)...)
+
+	if err := tk.writeReport(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := tk.finishTracing(errors.Join(errs...)); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (tk *TestKit) cleanupProviders(ctx context.Context, g *providerGraph) []error {
 	var errs []error
 
-	for _, p := range tk.availableProviders {
-		if err := p.Cleanup(); err != nil {
-			errs = append(errs, fmt.Errorf("failed to cleanup provider %v: %v", p, err))
+	ctx = trace.ContextWithSpan(ctx, tk.span)
+
+	cleanup := func(p Provider) error {
+		start := time.Now()
+		ctx, span := startSpan(ctx, "cleanup "+providerName(p))
+
+		var err error
+		if cp, ok := p.(ContextProvider); ok {
+			err = cp.CleanupContext(ctx)
+		} else {
+			err = p.Cleanup()
+		}
+
+		endSpan(span, err)
+		tk.report.recordCleanup(p, start, err)
+
+		return err
+	}
+
+	for i, err := range g.walk(true, false, cleanup) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to cleanup provider %v: %v", g.providers[i], err))
 		}
 	}
 
 	return errs
 }
 
+// RunID returns the ID of this run, under which the resources created by the providers
+// are recorded in the journal.
+func (tk *TestKit) RunID() string {
+	return tk.journal.RunID()
+}
+
+func setJournal(providers []Provider, journal *Journal, reuse bool) {
+	for _, p := range providers {
+		if jp, ok := p.(journalingProvider); ok {
+			jp.setJournal(journal, reuse)
+		}
+	}
+}
+
 // CleanupNeeded returns true if the test harness needs to be cleaned up.
 //
 // This takes into account the RetainResources and RetainResourcesOnFailure options and the test result.
@@ -231,6 +773,22 @@ type Provider interface {
 	Cleanup() error
 }
 
+// ContextProvider is a Provider whose setup and cleanup are bounded by a context.
+//
+// The harness calls SetupContext and CleanupContext instead of Setup and Cleanup.
+// A provider should stop what it's doing and return when the context is done,
+// interrupting the commands it's running.
+type ContextProvider interface {
+	Provider
+
+	// SetupContext sets up the provider.
+	// The context also bounds what the provider does after the setup,
+	// like creating resources on request.
+	SetupContext(ctx context.Context) error
+	// CleanupContext cleans up the resources created by the provider.
+	CleanupContext(ctx context.Context) error
+}
+
 func (s *S3Bucket) AWSV2Config(t *testing.T) aws.Config {
 	t.Helper()
 	sdkConfig, err := config.LoadDefaultConfig(context.TODO())
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -112,6 +114,218 @@ func TestNew(t *testing.T) {
 	require.Equal(t, 1, cnt)
 }
 
+type dependentTestProvider struct {
+	name   string
+	deps   []testkit.Provider
+	events *testEvents
+
+	// started is closed when Setup is called.
+	started chan struct{}
+	// waitFor is a list of channels Setup waits for before returning.
+	waitFor []chan struct{}
+	// setupErr is the error Setup returns.
+	setupErr error
+}
+
+func (p *dependentTestProvider) DependsOn() []testkit.Provider {
+	return p.deps
+}
+
+func (p *dependentTestProvider) Setup() error {
+	close(p.started)
+	for _, ch := range p.waitFor {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("%s timed out waiting for a concurrent setup", p.name)
+		}
+	}
+	if p.setupErr != nil {
+		return p.setupErr
+	}
+	p.events.add("setup " + p.name)
+	return nil
+}
+
+func (p *dependentTestProvider) Cleanup() error {
+	p.events.add("cleanup " + p.name)
+	return nil
+}
+
+type testEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *testEvents) add(ev string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, ev)
+}
+
+func (e *testEvents) indexOf(ev string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, x := range e.events {
+		if x == ev {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestProviderDependencies(t *testing.T) {
+	events := &testEvents{}
+
+	newProvider := func(name string, deps ...testkit.Provider) *dependentTestProvider {
+		return &dependentTestProvider{name: name, deps: deps, events: events, started: make(chan struct{})}
+	}
+
+	cluster := newProvider("cluster")
+	infra := newProvider("infra")
+	// cluster and infra do not depend on each other,
+	// so each one's setup can complete only if they are set up in parallel.
+	cluster.waitFor = []chan struct{}{infra.started}
+	infra.waitFor = []chan struct{}{cluster.started}
+
+	kubectl := newProvider("kubectl", cluster)
+	app := newProvider("app")
+
+	tk, err := testkit.Build(testkit.Providers(kubectl, app, cluster, infra), testkit.DependsOn(app, kubectl, infra))
+	require.NoError(t, err)
+
+	require.Less(t, events.indexOf("setup cluster"), events.indexOf("setup kubectl"))
+	require.Less(t, events.indexOf("setup kubectl"), events.indexOf("setup app"))
+	require.Less(t, events.indexOf("setup infra"), events.indexOf("setup app"))
+
+	require.Empty(t, tk.DoCleanup())
+
+	require.Less(t, events.indexOf("cleanup app"), events.indexOf("cleanup kubectl"))
+	require.Less(t, events.indexOf("cleanup app"), events.indexOf("cleanup infra"))
+	require.Less(t, events.indexOf("cleanup kubectl"), events.indexOf("cleanup cluster"))
+}
+
+func TestProviderDependencies_SetupFailure(t *testing.T) {
+	events := &testEvents{}
+
+	newProvider := func(name string, deps ...testkit.Provider) *dependentTestProvider {
+		return &dependentTestProvider{name: name, deps: deps, events: events, started: make(chan struct{})}
+	}
+
+	cluster := newProvider("cluster")
+	infra := newProvider("infra")
+	kubectl := newProvider("kubectl", cluster)
+	kubectl.setupErr = fmt.Errorf("kubectl is broken")
+	app := newProvider("app", kubectl)
+
+	_, err := testkit.Build(testkit.Providers(cluster, infra, kubectl, app), testkit.JournalDir(t.TempDir()))
+	require.ErrorContains(t, err, "kubectl is broken")
+
+	// The providers whose setup has been started are cleaned up, including the failed one
+	// which may have created resources before failing, and the others are not.
+	require.NotEqual(t, -1, events.indexOf("cleanup cluster"))
+	require.NotEqual(t, -1, events.indexOf("cleanup infra"))
+	require.NotEqual(t, -1, events.indexOf("cleanup kubectl"))
+	require.Equal(t, -1, events.indexOf("cleanup app"))
+	require.Less(t, events.indexOf("cleanup kubectl"), events.indexOf("cleanup cluster"))
+}
+
+func TestProviderDependencies_Cycle(t *testing.T) {
+	a := &dependentTestProvider{name: "a", events: &testEvents{}, started: make(chan struct{})}
+	b := &dependentTestProvider{name: "b", deps: []testkit.Provider{a}, events: &testEvents{}, started: make(chan struct{})}
+	a.deps = []testkit.Provider{b}
+
+	_, err := testkit.Build(testkit.Providers(a, b))
+	require.ErrorContains(t, err, "circular dependency")
+}
+
+func TestProviderDependencies_Missing(t *testing.T) {
+	a := &dependentTestProvider{name: "a", events: &testEvents{}, started: make(chan struct{})}
+	b := &dependentTestProvider{name: "b", deps: []testkit.Provider{a}, events: &testEvents{}, started: make(chan struct{})}
+
+	_, err := testkit.Build(testkit.Providers(b))
+	require.ErrorContains(t, err, "not in the providers list")
+}
+
+// myQueue is an example of a resource kind defined outside of testkit.
+type myQueue struct {
+	name    string
+	deleted bool
+}
+
+func (q *myQueue) CleanupResource(ctx context.Context) error {
+	q.deleted = true
+	return nil
+}
+
+type myQueueConfig struct {
+	name string
+}
+
+type myQueueOption func(*myQueueConfig)
+
+type myQueueProvider interface {
+	GetMyQueue(opts ...myQueueOption) (*myQueue, error)
+}
+
+func init() {
+	testkit.RegisterResourceKind("my queue", myQueueProvider.GetMyQueue)
+}
+
+type unavailableMyQueueProvider struct {
+	testProvider
+}
+
+func (p *unavailableMyQueueProvider) GetMyQueue(opts ...myQueueOption) (*myQueue, error) {
+	return nil, fmt.Errorf("queue service unavailable")
+}
+
+type inMemoryMyQueueProvider struct {
+	testProvider
+	queues map[string]*myQueue
+}
+
+func (p *inMemoryMyQueueProvider) GetMyQueue(opts ...myQueueOption) (*myQueue, error) {
+	var conf myQueueConfig
+	for _, o := range opts {
+		o(&conf)
+	}
+
+	if p.queues == nil {
+		p.queues = make(map[string]*myQueue)
+	}
+
+	if q, ok := p.queues[conf.name]; ok {
+		return q, nil
+	}
+
+	q := &myQueue{name: conf.name}
+	p.queues[conf.name] = q
+
+	return q, nil
+}
+
+func TestGet(t *testing.T) {
+	tk, err := testkit.Build(testkit.Providers(&unavailableMyQueueProvider{}, &inMemoryMyQueueProvider{}))
+	require.NoError(t, err)
+
+	withName := func(name string) myQueueOption {
+		return func(c *myQueueConfig) {
+			c.name = name
+		}
+	}
+
+	a := testkit.Get[*myQueue](tk, t, withName("a"))
+	b := testkit.Get[*myQueue](tk, t, withName("b"))
+	require.Equal(t, "a", a.name)
+	require.Equal(t, "b", b.name)
+	require.Same(t, a, testkit.Get[*myQueue](tk, t, withName("a")))
+
+	require.Empty(t, tk.DoCleanup())
+	require.True(t, a.deleted)
+	require.True(t, b.deleted)
+}
+
 func TestKindKubectl(t *testing.T) {
 	os.Unsetenv("KUBECONFIG")
 
@@ -141,9 +355,9 @@ func TestKindKubectl(t *testing.T) {
 
 	k := testkit.NewKubernetes(kc.KubeconfigPath)
 
-	testkit.PollUntil(t, func() bool {
-		return len(k.ListReadyNodeNames(t)) == 1
-	}, 20*time.Second)
+	k.EventuallyReadyNodeNames(t, func(nodes []string) bool {
+		return len(nodes) == 1
+	}, testkit.PollTimeout(20*time.Second))
 
 	helm := testkit.NewHelm(kc.KubeconfigPath)
 	helm.UpgradeOrInstall(t, "my-release", "testdata/helm-chart")
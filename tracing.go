@@ -0,0 +1,163 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/mumoshu/testkit/internal/redact"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the name of the tracer that emits the spans of the harness.
+const tracerName = "github.com/mumoshu/testkit"
+
+// OTLPEndpoint makes the harness export the spans of its operations, like the setup of the providers,
+// the getters, the commands run by the providers, and the cleanup, to the OTLP/HTTP endpoint,
+// like "http://localhost:4318".
+//
+// The spans are exported to the endpoint specified via OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT as well, if set.
+func OTLPEndpoint(endpoint string) Option {
+	return func(tk *Config) {
+		tk.OTLPEndpoint = endpoint
+	}
+}
+
+// TracerProvider makes the harness emit the spans of its operations via tp,
+// instead of exporting them to an OTLP endpoint.
+// This is useful when your test already has its own tracer provider.
+func TracerProvider(tp trace.TracerProvider) Option {
+	return func(tk *Config) {
+		tk.TracerProvider = tp
+	}
+}
+
+// newTracerProvider returns the tracer provider configured by conf,
+// and the function to flush the spans and shut it down.
+// It returns a no-op tracer provider when tracing is not configured.
+func newTracerProvider(ctx context.Context, conf *Config) (trace.TracerProvider, func(context.Context) error, error) {
+	nop := func(context.Context) error { return nil }
+
+	if conf.TracerProvider != nil {
+		return conf.TracerProvider, nop, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if conf.OTLPEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(conf.OTLPEndpoint))
+	} else if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return noop.NewTracerProvider(), nop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create OTLP exporter: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewSchemaless(semconv.ServiceName("testkit"))),
+	)
+
+	return tp, tp.Shutdown, nil
+}
+
+// rootSpanKey is the context key of the root span of the harness.
+type rootSpanKey struct{}
+
+// withRootSpan returns ctx that carries span as the root span of the harness,
+// so that the commands run by the getters are recorded under it.
+// See providerContext.
+func withRootSpan(ctx context.Context, span trace.Span) context.Context {
+	return context.WithValue(trace.ContextWithSpan(ctx, span), rootSpanKey{}, span)
+}
+
+// finishTracing ends the root span of the harness, recording err if any,
+// and flushes the spans.
+// It does nothing for child harnesses and after the first call.
+func (tk *TestKit) finishTracing(err error) error {
+	if tk.parent != nil || tk.span == nil {
+		return nil
+	}
+
+	var shutdownErr error
+
+	tk.tracingDone.Do(func() {
+		endSpan(tk.span, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+
+		if shutdownErr = tk.shutdownTracing(ctx); shutdownErr != nil {
+			shutdownErr = fmt.Errorf("unable to export spans: %v", shutdownErr)
+		}
+	})
+
+	return shutdownErr
+}
+
+// tracingShutdownTimeout bounds the time to flush the spans on cleanup.
+const tracingShutdownTimeout = 10 * time.Second
+
+// startSpan starts a span as a child of the span in ctx,
+// using the tracer provider of the span in ctx.
+// It's a no-op when ctx has no span, like when tracing is not configured.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, recording the error if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// combinedOutput runs the command and returns its combined output,
+// recording the run as a span with the redacted args and the exit code.
+func combinedOutput(ctx context.Context, c *exec.Cmd) ([]byte, error) {
+	return traceCommand(ctx, c, c.CombinedOutput)
+}
+
+// output is a variant of combinedOutput that returns the standard output only,
+// for commands whose output is parsed or saved, like the kubeconfigs printed by some commands.
+// The standard error is available via *exec.ExitError when the command fails.
+func output(ctx context.Context, c *exec.Cmd) ([]byte, error) {
+	return traceCommand(ctx, c, c.Output)
+}
+
+func traceCommand(ctx context.Context, c *exec.Cmd, run func() ([]byte, error)) ([]byte, error) {
+	name := filepath.Base(c.Path)
+
+	_, span := startSpan(ctx, name,
+		semconv.ProcessExecutableName(name),
+		semconv.ProcessCommandArgs(redact.Args(c.Args)...),
+	)
+
+	out, err := run()
+
+	exitCode := -1
+	if c.ProcessState != nil {
+		exitCode = c.ProcessState.ExitCode()
+	}
+	span.SetAttributes(attribute.Int("process.exit_code", exitCode))
+
+	endSpan(span, err)
+
+	return out, err
+}